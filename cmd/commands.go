@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"hot-coffee/config"
+	"hot-coffee/internal/dal"
+	"hot-coffee/internal/service"
+	"hot-coffee/models"
+	"os"
+	"strings"
+)
+
+// runCommand runs the maintenance subcommand named by the arguments after the flags
+// instead of starting the server.
+func runCommand(cfg *config.Config, authService *service.AuthService) error {
+	args := cfg.Args
+	switch args[0] {
+	case "create-admin":
+		if len(args) != 2 {
+			return errors.New("usage: hot-coffee create-admin <username>")
+		}
+		if err := config.ValidateDirectory(dal.CreateDataFiles); err != nil {
+			return err
+		}
+		return createAdmin(authService, args[1])
+	case "fsck":
+		return fsck(cfg, args[1:])
+	case "backup":
+		return backup(cfg, args[1:])
+	case "restore":
+		return restore(cfg, args[1:])
+	case "gen-cert":
+		return genCert(cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// createAdmin adds an admin user. The password is read from the first line of standard
+// input so it does not end up in the shell history or the process list.
+func createAdmin(authService *service.AuthService, username string) error {
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return fmt.Errorf("reading password: %w", err)
+	}
+
+	user := models.User{Username: username, Role: models.RoleAdmin, Password: strings.TrimRight(password, "\r\n")}
+	if err := authService.AddUser(&user); err != nil {
+		return err
+	}
+	fmt.Printf("Admin %s created with ID %s\n", user.Username, user.ID)
+	return nil
+}
+
+// fsck checks the data directory and prints what it found. The directory can also be
+// given after the command, as in "hot-coffee fsck --dir data --repair". Problems left
+// unrepaired make it fail so scripts notice them.
+func fsck(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	dir := fs.String("dir", cfg.Directory, "data directory to check")
+	repair := fs.Bool("repair", false, "back up the directory, then fix what can be fixed safely")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("usage: hot-coffee fsck [--dir <path>] [--repair]")
+	}
+	config.Directory = *dir
+
+	report, err := dal.Fsck(*repair)
+	if err != nil {
+		return err
+	}
+	if report.Backup != "" {
+		fmt.Printf("Backed up %s to %s\n", *dir, report.Backup)
+	}
+
+	remaining, repairable := 0, 0
+	for _, issue := range report.Issues {
+		line := fmt.Sprintf("%s: %s", issue.File, issue.Problem)
+		switch {
+		case issue.Repaired:
+			line += " (repaired: " + issue.Fix + ")"
+		case issue.Fix != "":
+			line += " (--repair will " + issue.Fix + ")"
+			repairable++
+			remaining++
+		default:
+			remaining++
+		}
+		fmt.Println(line)
+	}
+
+	switch {
+	case len(report.Issues) == 0:
+		fmt.Printf("%s: no problems found\n", *dir)
+		return nil
+	case remaining == 0:
+		fmt.Printf("%s: %d problems repaired\n", *dir, len(report.Issues))
+		return nil
+	case repairable > 0:
+		return fmt.Errorf("%d problems found, %d can be repaired with --repair", remaining, repairable)
+	default:
+		return fmt.Errorf("%d problems need fixing by hand", remaining)
+	}
+}
+
+// backup writes an archive of the data directory, as in "hot-coffee backup --out
+// data.tar.gz". It refuses while a server uses the directory, since the server may change
+// one file between the reads of two others; POST /admin/backup holds its writes off instead.
+func backup(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	dir := fs.String("dir", cfg.Directory, "data directory to back up")
+	out := fs.String("out", "", "archive to write, e.g. data.tar.gz")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" || fs.NArg() > 0 {
+		return errors.New("usage: hot-coffee backup --out <file.tar.gz> [--dir <path>]")
+	}
+	if info, err := os.Stat(*dir); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", *dir)
+	}
+	config.Directory = *dir
+	if err := checkNoServer(*dir, "take the backup with POST /admin/backup"); err != nil {
+		return err
+	}
+
+	manifest, err := dal.WriteBackupFile(*out)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up %d files from %s to %s\n", len(manifest.Files), *dir, *out)
+	return nil
+}
+
+// restore replaces the data directory with the contents of an archive made by backup,
+// after checking every file against the manifest. The directory it replaces is kept.
+// With --verify it only checks the archive.
+func restore(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	dir := fs.String("dir", cfg.Directory, "data directory to replace")
+	in := fs.String("in", "", "archive to restore, e.g. data.tar.gz")
+	verify := fs.Bool("verify", false, "only check the archive")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" || fs.NArg() > 0 {
+		return errors.New("usage: hot-coffee restore --in <file.tar.gz> [--dir <path>] [--verify]")
+	}
+	config.Directory = *dir
+
+	if *verify {
+		manifest, err := dal.VerifyBackupFile(*in)
+		if err != nil {
+			return fmt.Errorf("%s: %w", *in, err)
+		}
+		fmt.Printf("%s: %d files taken at %s, schema version %d, all checksums match\n", *in, len(manifest.Files), manifest.CreatedAt, manifest.SchemaVersion)
+		return nil
+	}
+	if err := checkNoServer(*dir, "stop it first"); err != nil {
+		return err
+	}
+	manifest, previous, err := dal.RestoreBackupFile(*in)
+	if err != nil {
+		return fmt.Errorf("%s: %w", *in, err)
+	}
+	fmt.Printf("Restored %d files taken at %s to %s\n", len(manifest.Files), manifest.CreatedAt, *dir)
+	if previous != "" {
+		fmt.Printf("The previous contents of %s are in %s\n", *dir, previous)
+	}
+	return nil
+}
+
+// checkNoServer fails when a running server uses the data directory dir, suggesting what
+// to do instead.
+func checkNoServer(dir, instead string) error {
+	pid, err := dal.DirectoryOwner()
+	if err != nil {
+		return err
+	}
+	if pid != 0 {
+		return fmt.Errorf("%s is in use by the server running as process %d; %s", dir, pid, instead)
+	}
+	return nil
+}
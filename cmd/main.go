@@ -1,58 +1,288 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"hot-coffee/config"
 	"hot-coffee/internal/dal"
+	"hot-coffee/internal/events"
 	"hot-coffee/internal/handler"
+	"hot-coffee/internal/logging"
+	"hot-coffee/internal/metrics"
 	"hot-coffee/internal/service"
+	"hot-coffee/models"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 // ..
 func main() {
-	// Validate directory and port
-	if err := config.ValidateDirectory(); err != nil {
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error: invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(newLogger(cfg))
+	time.Local = cfg.Location
+
+	userRepo := &dal.FileUserRepository{}
+	authService := service.NewAuthService(userRepo, cfg.SessionTTL)
+	if len(cfg.Args) > 0 {
+		if err := runCommand(cfg, authService); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Validate the data directory
+	if err := config.ValidateDirectory(dal.CreateDataFiles); err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
-	// Check if the port is valid
-	port, err := strconv.Atoi(config.PortNumber)
-	if err != nil || port < 1024 || port > 49151 {
-		fmt.Printf("Error: Invalid port number %s\n", config.PortNumber)
+	// Mark the data directory as in use so that backup and restore refuse to touch it
+	releaseDirectory, err := dal.ClaimDirectory()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
-
 	}
+	// Upgrade data files written by older versions; files from a newer one stop the start
+	upgraded, backup, err := dal.Migrate()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(upgraded) > 0 {
+		slog.Info("Data files upgraded", slog.Int("schemaVersion", dal.SchemaVersion), slog.Any("files", upgraded), slog.String("backup", backup))
+	}
+
 	inventoryRepo := &dal.FileInventoryRepository{}
 	menuRepo := &dal.FileMenuRepository{}
 	orderRepo := &dal.FileOrderRepository{}
+	refundRepo := &dal.FileRefundRepository{}
+	shiftRepo := &dal.FileShiftRepository{}
+	zReportRepo := &dal.FileZReportRepository{}
+	customerRepo := &dal.FileCustomerRepository{}
+	loyaltyRepo := &dal.FileLoyaltyRepository{}
+	webhookRepo := &dal.FileWebhookRepository{}
+	idempotencyRepo := &dal.FileIdempotencyRepository{}
+	auditRepo := &dal.FileAuditRepository{}
+	backupRepo := &dal.FileBackupRepository{Dir: cfg.BackupDir}
+
+	// Order and inventory changes are published here for the /events stream
+	bus := events.NewBus(1000)
 
-	inventoryService := service.NewInventoryService(inventoryRepo)
-	menuService := service.NewMenuService(menuRepo)
-	orderService := service.NewOrderService(orderRepo, *menuService, *inventoryService)
-	reportsService := service.NewReportsService(orderRepo, *menuService)
+	// Every change to inventory, menu items and orders is appended to the audit log
+	auditService := service.NewAuditService(auditRepo)
+	inventoryService := service.NewInventoryService(inventoryRepo, bus, auditService)
+	menuService := service.NewMenuService(menuRepo, auditService)
+	loyaltyService := service.NewLoyaltyService(loyaltyRepo, customerRepo, orderRepo, *menuService, auditService)
+	orderService := service.NewOrderService(orderRepo, customerRepo, *menuService, *inventoryService, loyaltyService, bus, auditService)
+	refundService := service.NewRefundService(refundRepo, orderRepo, *menuService, *inventoryService, loyaltyService)
+	reportsService := service.NewReportsService(orderRepo, refundRepo, *menuService, models.Pricing{Currency: cfg.Currency, TaxRate: cfg.TaxRate})
+	shiftService := service.NewShiftService(shiftRepo, zReportRepo, reportsService)
+	customerService := service.NewCustomerService(customerRepo, orderRepo, refundRepo)
+	queueService := service.NewQueueService(orderRepo, *menuService, bus, auditService)
+	webhookService := service.NewWebhookService(webhookRepo, bus, &http.Client{Timeout: 10 * time.Second}, 5, time.Second)
+	webhookService.Start()
+	inventoryService.RegisterMetrics(metrics.Default)
+	healthService := service.NewHealthService(&dal.FileStorage{})
+	idempotencyService := service.NewIdempotencyService(idempotencyRepo, cfg.IdempotencyTTL)
+	backupService := service.NewBackupService(backupRepo, cfg.BackupKeep)
+	if cfg.BackupInterval > 0 {
+		backupService.Start(cfg.BackupInterval)
+	}
 
-	reportsHandler := handler.NewReportsHandler(reportsService)
+	reportsHandler := handler.NewReportsHandler(reportsService, shiftService)
+	shiftHandler := handler.NewShiftHandler(shiftService)
 	inventoryHandler := handler.NewInventoryHandler(inventoryService)
 	menuHandler := handler.NewMenuHandler(menuService)
-	orderHandler := handler.NewOrderHandler(orderService)
-
-	// Register the /inventory route to handle all methods through ServeHTTP
-	http.Handle("/inventory", inventoryHandler)
-	http.Handle("/inventory/", inventoryHandler)
-	http.Handle("/menu", menuHandler)
-	http.Handle("/menu/", menuHandler)
-	http.Handle("/orders", orderHandler)
-	http.Handle("/orders/", orderHandler)
-
-	// Register the new report routes
-	http.Handle("/reports/total-sales", reportsHandler)
-	http.Handle("/reports/popular-items", reportsHandler)
-
-	fmt.Println("Server is running on port " + config.PortNumber)
-	if err := http.ListenAndServe(":"+config.PortNumber, nil); err != nil {
+	orderHandler := handler.NewOrderHandler(orderService, refundService)
+	customerHandler := handler.NewCustomerHandler(customerService)
+	loyaltyHandler := handler.NewLoyaltyHandler(loyaltyService)
+	queueHandler := handler.NewQueueHandler(queueService)
+	eventsHandler := handler.NewEventsHandler(bus)
+	posHandler := handler.NewPOSHandler(orderService, bus, dal.HoldWrites, cfg.TLSClientCA != "")
+	webhookHandler := handler.NewWebhookHandler(webhookService)
+	authHandler := handler.NewAuthHandler(authService)
+	auditHandler := handler.NewAuditHandler(auditService)
+	docsHandler := handler.NewDocsHandler()
+	metricsHandler := handler.NewMetricsHandler(metrics.Default)
+	healthHandler := handler.NewHealthHandler(healthService)
+	backupHandler := handler.NewBackupHandler(backupService)
+
+	router := handler.NewRouter(
+		inventoryHandler,
+		menuHandler,
+		orderHandler,
+		customerHandler,
+		loyaltyHandler,
+		queueHandler,
+		eventsHandler,
+		posHandler,
+		webhookHandler,
+		reportsHandler,
+		shiftHandler,
+		docsHandler,
+		authHandler,
+		auditHandler,
+		metricsHandler,
+		healthHandler,
+		backupHandler,
+	)
+
+	// The served OpenAPI document is written by hand; point out where it no longer matches the routes
+	undocumented, missing, err := handler.CheckSpec(router.Patterns())
+	if err != nil {
+		slog.Error("Invalid OpenAPI document", slog.String("error", err.Error()))
+	}
+	for _, route := range undocumented {
+		slog.Warn("Route missing from OpenAPI document", slog.String("route", route))
+	}
+	for _, operation := range missing {
+		slog.Warn("OpenAPI operation has no route", slog.String("operation", operation))
+	}
+
+	if hasUsers, err := authService.HasUsers(); err == nil && !hasUsers {
+		slog.Warn("No users exist yet; add the first admin with: hot-coffee create-admin <username>")
+	}
+
+	// Every request gets an ID for its log records, one access log line and its count and
+	// duration in the metrics; panics below become 500s and bodies are capped before
+	// anything reads them. Requests are then authenticated, and retries of mutating
+	// requests carrying an Idempotency-Key get the original response. Backups wait for
+	// the requests changing data to finish
+	var stack http.Handler = handler.Idempotency(idempotencyService, router)
+	stack = handler.HoldWrites(dal.HoldWrites, router, stack)
+	stack = handler.Authenticate(authService, router, stack)
+	stack = handler.LimitBody(int64(cfg.MaxBodySize), stack)
+	stack = handler.Recover(stack)
+	stack = handler.RequestMetrics(router, stack)
+	stack = handler.AccessLog(router, stack)
+	stack = handler.RequestID(stack)
+
+	server := &http.Server{
+		Addr:           cfg.Addr,
+		Handler:        stack,
+		ReadTimeout:    cfg.ReadTimeout,
+		WriteTimeout:   cfg.WriteTimeout,
+		IdleTimeout:    cfg.IdleTimeout,
+		MaxHeaderBytes: cfg.MaxHeaderSize,
+	}
+	// Event streams and POS terminals never finish on their own; closing the bus tells
+	// them to go away as soon as shutdown starts instead of holding the drain open
+	server.RegisterOnShutdown(bus.Close)
+
+	if cfg.TLSEnabled() {
+		if server.TLSConfig, err = newTLSConfig(cfg); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
 		fmt.Printf("Error starting server: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg.TLSRedirectAddr != "" {
+		redirectServer := newRedirectServer(cfg)
+		redirectListener, err := net.Listen("tcp", cfg.TLSRedirectAddr)
+		if err != nil {
+			fmt.Printf("Error starting HTTP redirect: %v\n", err)
+			os.Exit(1)
+		}
+		go redirectServer.Serve(redirectListener)
+		server.RegisterOnShutdown(func() { redirectServer.Close() })
+		fmt.Println("Redirecting HTTP on " + cfg.TLSRedirectAddr + " to HTTPS")
+	}
+	if server.TLSConfig != nil {
+		fmt.Println("Server is listening for HTTPS on " + cfg.Addr)
+	} else {
+		fmt.Println("Server is listening on " + cfg.Addr)
+	}
+	code := serve(server, listener, cfg.ShutdownTimeout, webhookService, backupService)
+	releaseDirectory()
+	os.Exit(code)
+}
+
+// serve runs the server until SIGINT or SIGTERM. It then stops accepting connections and
+// gives the requests in flight, webhook deliveries, a backup being taken and file writes
+// until timeout to finish.
+// The result is the exit code: 0 after a clean shutdown, 1 if the server failed or had
+// to cut work off at the deadline.
+func serve(server *http.Server, listener net.Listener, timeout time.Duration, webhookService *service.WebhookService, backupService *service.BackupService) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	served := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			// The certificate is already in TLSConfig
+			served <- server.ServeTLS(listener, "", "")
+		} else {
+			served <- server.Serve(listener)
+		}
+	}()
+	select {
+	case err := <-served:
+		fmt.Printf("Error running server: %v\n", err)
+		return 1
+	case <-ctx.Done():
+	}
+	// A second signal kills the process straight away
+	stop()
+	slog.Info("Shutting down", slog.Duration("timeout", timeout))
+
+	drain, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	code := 0
+	if err := server.Shutdown(drain); err != nil {
+		slog.Error("Requests still in flight at the shutdown deadline were cut off", slog.String("error", err.Error()))
+		server.Close()
+		code = 1
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		webhookService.Stop()
+		backupService.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-drain.Done():
+		slog.Error("Webhook deliveries or a backup still in flight at the shutdown deadline were abandoned")
+		code = 1
+	}
+
+	if err := dal.WaitForWrites(drain); err != nil {
+		slog.Error("File writes still pending at the shutdown deadline", slog.String("error", err.Error()))
+		return 1
+	}
+	slog.Info("Server stopped")
+	return code
+}
+
+// newLogger builds the logger for the configured level and format.
+func newLogger(cfg *config.Config) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(cfg.LogLevel))
+	options := &slog.HandlerOptions{Level: level}
+	var h slog.Handler = slog.NewTextHandler(os.Stderr, options)
+	if cfg.LogFormat == "json" {
+		h = slog.NewJSONHandler(os.Stderr, options)
 	}
+	// Records logged with a request's context carry its request ID
+	return slog.New(logging.NewHandler(h))
 }
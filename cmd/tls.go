@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hot-coffee/config"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// certValidity is how long a certificate made by gen-cert stays valid.
+const certValidity = 365 * 24 * time.Hour
+
+// newTLSConfig loads the server certificate and, when POS terminals must present one,
+// the CAs their certificates are checked against.
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.TLSClientCA == "" {
+		return tlsConfig, nil
+	}
+
+	data, err := os.ReadFile(cfg.TLSClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("client CA %s holds no PEM certificates", cfg.TLSClientCA)
+	}
+	// Only /pos insists on a certificate; browsers and back-office tools sign in without one
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
+
+// newRedirectServer answers plain HTTP on the redirect address by sending clients to the
+// same URL over HTTPS.
+func newRedirectServer(cfg *config.Config) *http.Server {
+	_, tlsPort, _ := net.SplitHostPort(cfg.Addr)
+	redirect := func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	}
+	return &http.Server{
+		Addr:           cfg.TLSRedirectAddr,
+		Handler:        http.HandlerFunc(redirect),
+		ReadTimeout:    cfg.ReadTimeout,
+		WriteTimeout:   cfg.WriteTimeout,
+		IdleTimeout:    cfg.IdleTimeout,
+		MaxHeaderBytes: cfg.MaxHeaderSize,
+	}
+}
+
+// genCert writes a self-signed certificate and its key for the given host names and IP
+// addresses, to tls.cert and tls.key or cert.pem and key.pem. Existing files are kept.
+func genCert(cfg *config.Config, hosts []string) error {
+	certPath, keyPath := cfg.TLSCert, cfg.TLSKey
+	if certPath == "" {
+		certPath = "cert.pem"
+	}
+	if keyPath == "" {
+		keyPath = "key.pem"
+	}
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+		if name, err := os.Hostname(); err == nil {
+			hosts = append(hosts, name)
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Hot Coffee"}, CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := writePEM(keyPath, "PRIVATE KEY", keyDER, 0o600); err != nil {
+		return err
+	}
+	if err := writePEM(certPath, "CERTIFICATE", der, 0o644); err != nil {
+		os.Remove(keyPath)
+		return err
+	}
+	fmt.Printf("Certificate for %v written to %s, key to %s; valid until %s\n", hosts, certPath, keyPath, template.NotAfter.Format(time.DateOnly))
+	return nil
+}
+
+// writePEM creates a PEM file, refusing to overwrite one that already exists.
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists; remove it to make a new certificate", path)
+	}
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(file, &pem.Block{Type: blockType, Bytes: der}); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,362 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the name of every environment variable the configuration reads, e.g.
+// HOT_COFFEE_STORAGE_DIR for storage.dir.
+const EnvPrefix = "HOT_COFFEE_"
+
+// Config is the server configuration. Each setting comes from, in increasing order of
+// precedence: its default, the config file, the environment and the command line.
+type Config struct {
+	Addr           string
+	StorageBackend string
+	Directory      string
+
+	// TLSCert and TLSKey are PEM files; when set the server speaks HTTPS only.
+	TLSCert string
+	TLSKey  string
+	// TLSClientCA is a PEM bundle of the CAs that sign POS terminal certificates. When set,
+	// /pos only accepts terminals presenting a certificate it verifies.
+	TLSClientCA string
+	// TLSRedirectAddr, when set, serves plain HTTP there and redirects it to HTTPS.
+	TLSRedirectAddr string
+
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	IdempotencyTTL  time.Duration
+	SessionTTL      time.Duration
+
+	// BackupDir holds the archives of POST /admin/backup and the scheduled backups, which
+	// are taken every BackupInterval (never when 0). The newest BackupKeep are kept.
+	BackupDir      string
+	BackupInterval time.Duration
+	BackupKeep     int
+
+	// MaxHeaderSize bounds the request line and headers, in bytes.
+	MaxHeaderSize int
+	// MaxBodySize bounds request bodies, in bytes.
+	MaxBodySize int
+
+	LogLevel  string
+	LogFormat string
+
+	Currency string
+	Timezone string
+	// Location is Timezone loaded by Validate.
+	Location *time.Location
+	// TaxRate is the tax included in menu prices, as a fraction (0.2 for 20%).
+	TaxRate float64
+
+	// Args are the command-line arguments after the flags, naming a subcommand.
+	Args []string
+}
+
+// Default returns the configuration used when nothing is set.
+func Default() *Config {
+	c := &Config{}
+	for _, s := range settings {
+		if s.def == "" {
+			continue
+		}
+		if err := s.set(c, s.def); err != nil {
+			panic(fmt.Sprintf("config: default of %s: %v", s.key, err))
+		}
+	}
+	return c
+}
+
+// setting is one configuration key. key is its name in the config file; the environment
+// variable and flag names are derived from it unless flag is set.
+type setting struct {
+	key   string
+	flag  string
+	def   string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{key: "addr", def: ":8080", usage: "Address to listen on, host:port", set: setString(func(c *Config) *string { return &c.Addr })},
+	{key: "port", usage: "Port to listen on, shorthand for --addr :N", set: setPort},
+	{key: "storage.backend", flag: "storage", def: "file", usage: "Storage backend (file)", set: setString(func(c *Config) *string { return &c.StorageBackend })},
+	{key: "storage.dir", flag: "dir", def: "data", usage: "Path to the data directory", set: setString(func(c *Config) *string { return &c.Directory })},
+	{key: "backup.dir", def: "backups", usage: "Directory backup archives are written to", set: setString(func(c *Config) *string { return &c.BackupDir })},
+	{key: "backup.interval", def: "0", usage: "How often to take a backup automatically, e.g. 24h; 0 turns it off", set: setDuration(func(c *Config) *time.Duration { return &c.BackupInterval })},
+	{key: "backup.keep", def: "7", usage: "Number of backups kept in backup.dir; older ones are deleted", set: setInt(func(c *Config) *int { return &c.BackupKeep })},
+	{key: "tls.cert", usage: "PEM certificate file; enables HTTPS", set: setString(func(c *Config) *string { return &c.TLSCert })},
+	{key: "tls.key", usage: "PEM private key file of the certificate", set: setString(func(c *Config) *string { return &c.TLSKey })},
+	{key: "tls.client_ca", usage: "PEM file of the CAs that sign POS terminal certificates", set: setString(func(c *Config) *string { return &c.TLSClientCA })},
+	{key: "tls.redirect_addr", usage: "Address, host:port, redirecting plain HTTP to HTTPS", set: setString(func(c *Config) *string { return &c.TLSRedirectAddr })},
+	{key: "timeouts.read", def: "15s", usage: "Longest time to read a request", set: setDuration(func(c *Config) *time.Duration { return &c.ReadTimeout })},
+	{key: "timeouts.write", def: "30s", usage: "Longest time to write a response", set: setDuration(func(c *Config) *time.Duration { return &c.WriteTimeout })},
+	{key: "timeouts.idle", def: "2m", usage: "How long an idle keep-alive connection stays open", set: setDuration(func(c *Config) *time.Duration { return &c.IdleTimeout })},
+	{key: "timeouts.shutdown", def: "15s", usage: "How long to wait for requests in flight when stopping", set: setDuration(func(c *Config) *time.Duration { return &c.ShutdownTimeout })},
+	{key: "max_header_size", def: "64KB", usage: "Largest request line and headers, e.g. 64KB or 1MB", set: setSize(func(c *Config) *int { return &c.MaxHeaderSize })},
+	{key: "max_body_size", def: "1MB", usage: "Largest request body, e.g. 64KB or 1MB", set: setSize(func(c *Config) *int { return &c.MaxBodySize })},
+	{key: "idempotency_ttl", def: "24h", usage: "How long responses to Idempotency-Key requests are kept", set: setDuration(func(c *Config) *time.Duration { return &c.IdempotencyTTL })},
+	{key: "session_ttl", def: "12h", usage: "How long a sign-in token stays valid", set: setDuration(func(c *Config) *time.Duration { return &c.SessionTTL })},
+	{key: "log.level", def: "info", usage: "Lowest level logged: debug, info, warn or error", set: setString(func(c *Config) *string { return &c.LogLevel })},
+	{key: "log.format", def: "text", usage: "Log format: text or json", set: setString(func(c *Config) *string { return &c.LogFormat })},
+	{key: "currency", def: "USD", usage: "ISO 4217 code of the currency prices are in", set: setString(func(c *Config) *string { return &c.Currency })},
+	{key: "timezone", def: "Local", usage: "IANA time zone for timestamps and report dates", set: setString(func(c *Config) *string { return &c.Timezone })},
+	{key: "tax.rate", usage: "Tax included in prices, as a fraction (0.2 for 20%)", set: setTaxRate},
+}
+
+// flagName is the command-line flag of a setting, e.g. --log-level for log.level.
+func (s setting) flagName() string {
+	if s.flag != "" {
+		return s.flag
+	}
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+// envName is the environment variable of a setting, e.g. HOT_COFFEE_LOG_LEVEL for log.level.
+func (s setting) envName() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(s.key, ".", "_"))
+}
+
+// Load builds the configuration from the config file named by --config or
+// HOT_COFFEE_CONFIG, then the environment, then the command-line args, and validates it.
+func Load(args []string) (*Config, error) {
+	flags, configPath, rest, err := parseFlags(args)
+	if err != nil {
+		return nil, err
+	}
+	if configPath == "" {
+		configPath = os.Getenv(EnvPrefix + "CONFIG")
+	}
+
+	cfg := Default()
+	if configPath != "" {
+		values, err := readFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := cfg.apply(values, func(s setting) string { return s.key + " in " + configPath }); err != nil {
+			return nil, err
+		}
+	}
+
+	env := make(map[string]string)
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.envName()); ok {
+			env[s.key] = value
+		}
+	}
+	if err := cfg.apply(env, func(s setting) string { return s.envName() }); err != nil {
+		return nil, err
+	}
+	if err := cfg.apply(flags, func(s setting) string { return "--" + s.flagName() }); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg.Args = rest
+	Directory = cfg.Directory
+	return cfg, nil
+}
+
+// apply sets the values, keyed by setting key, in the order of the settings table so
+// that a later, more specific setting wins over an earlier one (--addr then --port).
+// source names where a value came from in errors.
+func (c *Config) apply(values map[string]string, source func(setting) string) error {
+	var errs []error
+	known := make(map[string]bool)
+	for _, s := range settings {
+		known[s.key] = true
+		value, ok := values[s.key]
+		if !ok {
+			continue
+		}
+		if err := s.set(c, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", source(s), err))
+		}
+	}
+	for key := range values {
+		if !known[key] {
+			errs = append(errs, fmt.Errorf("unknown setting %q", key))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks settings that are well-formed on their own but not usable together
+// or on this machine, and loads the time zone.
+func (c *Config) Validate() error {
+	var errs []error
+	if err := checkAddr(c.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("addr: %w", err))
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		errs = append(errs, errors.New("tls.cert and tls.key must be set together"))
+	}
+	if c.TLSClientCA != "" && !c.TLSEnabled() {
+		errs = append(errs, errors.New("tls.client_ca: needs tls.cert and tls.key"))
+	}
+	if c.TLSRedirectAddr != "" {
+		if !c.TLSEnabled() {
+			errs = append(errs, errors.New("tls.redirect_addr: needs tls.cert and tls.key"))
+		} else if err := checkAddr(c.TLSRedirectAddr); err != nil {
+			errs = append(errs, fmt.Errorf("tls.redirect_addr: %w", err))
+		} else if c.TLSRedirectAddr == c.Addr {
+			errs = append(errs, errors.New("tls.redirect_addr: must differ from addr"))
+		}
+	}
+	if c.StorageBackend != "file" {
+		errs = append(errs, fmt.Errorf("storage.backend: %q is not supported, use file", c.StorageBackend))
+	}
+	if c.Directory == "" {
+		errs = append(errs, errors.New("storage.dir: must not be empty"))
+	} else if isStandardPackage(c.Directory) {
+		errs = append(errs, fmt.Errorf("storage.dir: %q is one of the source directories", c.Directory))
+	}
+	if c.BackupDir == "" {
+		errs = append(errs, errors.New("backup.dir: must not be empty"))
+	} else if filepath.Clean(c.BackupDir) == filepath.Clean(c.Directory) {
+		errs = append(errs, errors.New("backup.dir: must differ from storage.dir"))
+	}
+	if c.BackupInterval < 0 || (c.BackupInterval > 0 && c.BackupInterval < time.Minute) {
+		errs = append(errs, errors.New("backup.interval: must be 0 or at least 1m"))
+	}
+	if c.BackupKeep < 1 {
+		errs = append(errs, errors.New("backup.keep: must be at least 1"))
+	}
+	for _, timeout := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"timeouts.read", c.ReadTimeout},
+		{"timeouts.write", c.WriteTimeout},
+		{"timeouts.idle", c.IdleTimeout},
+		{"timeouts.shutdown", c.ShutdownTimeout},
+		{"idempotency_ttl", c.IdempotencyTTL},
+		{"session_ttl", c.SessionTTL},
+	} {
+		if timeout.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s: must be greater than zero", timeout.key))
+		}
+	}
+	if c.MaxHeaderSize <= 0 {
+		errs = append(errs, errors.New("max_header_size: must be greater than zero"))
+	}
+	if c.MaxBodySize <= 0 {
+		errs = append(errs, errors.New("max_body_size: must be greater than zero"))
+	}
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("log.level: %q is not debug, info, warn or error", c.LogLevel))
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		errs = append(errs, fmt.Errorf("log.format: %q is not text or json", c.LogFormat))
+	}
+	if len(c.Currency) != 3 || strings.ToUpper(c.Currency) != c.Currency || strings.ContainsFunc(c.Currency, func(r rune) bool { return r < 'A' || r > 'Z' }) {
+		errs = append(errs, fmt.Errorf("currency: %q is not a three-letter ISO 4217 code such as USD", c.Currency))
+	}
+	location, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("timezone: %q is not a known time zone", c.Timezone))
+	}
+	c.Location = location
+	return errors.Join(errs...)
+}
+
+// TLSEnabled reports whether the server serves HTTPS.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCert != "" && c.TLSKey != ""
+}
+
+// checkAddr checks that addr is host:port with a port that needs no privileges.
+func checkAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%q is not host:port", addr)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1024 || n > 49151 {
+		return fmt.Errorf("port %s must be a number between 1024 and 49151", port)
+	}
+	return nil
+}
+
+func setString(field func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = strings.TrimSpace(value)
+		return nil
+	}
+}
+
+func setDuration(field func(c *Config) *time.Duration) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s or 5m", value)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func setInt(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+// setSize reads a byte count, either plain or with a KB or MB suffix (multiples of 1024).
+func setSize(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		number, unit := strings.TrimSpace(value), 1
+		if n, ok := strings.CutSuffix(strings.ToUpper(number), "KB"); ok {
+			number, unit = n, 1<<10
+		} else if n, ok := strings.CutSuffix(strings.ToUpper(number), "MB"); ok {
+			number, unit = n, 1<<20
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(number))
+		if err != nil {
+			return fmt.Errorf("%q is not a size such as 512, 64KB or 1MB", value)
+		}
+		*field(c) = n * unit
+		return nil
+	}
+}
+
+func setPort(c *Config, value string) error {
+	port, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("%q is not a port number", value)
+	}
+	host, _, err := net.SplitHostPort(c.Addr)
+	if err != nil {
+		host = ""
+	}
+	c.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	return nil
+}
+
+func setTaxRate(c *Config, value string) error {
+	rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || rate < 0 || rate >= 1 {
+		return fmt.Errorf("%q is not a fraction between 0 and 1", value)
+	}
+	c.TaxRate = rate
+	return nil
+}
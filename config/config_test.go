@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// load runs Load with the config file holding contents, when given, and restores the
+// data directory it sets.
+func load(t *testing.T, contents string, args ...string) (*Config, error) {
+	t.Helper()
+	previous := Directory
+	t.Cleanup(func() { Directory = previous })
+	if contents != "" {
+		path := filepath.Join(t.TempDir(), "hot-coffee.yaml")
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		args = append([]string{"--config", path}, args...)
+	}
+	return Load(args)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name                  string
+		file, env, flag, want string
+	}{
+		{name: "default", want: "USD"},
+		{name: "file over default", file: "EUR", want: "EUR"},
+		{name: "environment over default", env: "GBP", want: "GBP"},
+		{name: "environment over file", file: "EUR", env: "GBP", want: "GBP"},
+		{name: "flag over file", file: "EUR", flag: "JPY", want: "JPY"},
+		{name: "flag over environment", file: "EUR", env: "GBP", flag: "JPY", want: "JPY"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			contents := ""
+			if test.file != "" {
+				contents = "currency: " + test.file + "\n"
+			}
+			if test.env != "" {
+				t.Setenv(EnvPrefix+"CURRENCY", test.env)
+			}
+			var args []string
+			if test.flag != "" {
+				args = append(args, "--currency", test.flag)
+			}
+			cfg, err := load(t, contents, args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Currency != test.want {
+				t.Errorf("currency = %s, want %s", cfg.Currency, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadLayersSettingsFromEachSource(t *testing.T) {
+	t.Setenv(EnvPrefix+"LOG_LEVEL", "warn")
+	cfg, err := load(t, "log:\n  level: debug\n  format: json\nstorage:\n  dir: shop\n", "--dir", "till", "serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LogFormat != "json" || cfg.LogLevel != "warn" || cfg.Directory != "till" || cfg.Addr != ":8080" {
+		t.Errorf("log.format = %s, log.level = %s, storage.dir = %s, addr = %s; want json, warn, till, :8080", cfg.LogFormat, cfg.LogLevel, cfg.Directory, cfg.Addr)
+	}
+	if Directory != "till" {
+		t.Errorf("Directory = %s, want till", Directory)
+	}
+	if len(cfg.Args) != 1 || cfg.Args[0] != "serve" {
+		t.Errorf("args = %v, want [serve]", cfg.Args)
+	}
+}
+
+func TestLoadPortAfterAddr(t *testing.T) {
+	cfg, err := load(t, "addr: 127.0.0.1:9000\n", "--port", "9090")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != "127.0.0.1:9090" {
+		t.Errorf("addr = %s, want 127.0.0.1:9090", cfg.Addr)
+	}
+}
+
+func TestLoadNamesTheSourceOfBadValues(t *testing.T) {
+	tests := []struct {
+		name, file, env string
+		args            []string
+		want            string
+	}{
+		{name: "unknown key in the file", file: "colour: blue\n", want: `unknown setting "colour"`},
+		{name: "bad value in the file", file: "backup:\n  keep: few\n", want: `backup.keep in `},
+		{name: "bad value in the environment", env: "soon", want: EnvPrefix + `TIMEOUTS_READ: "soon" is not a duration`},
+		{name: "bad flag value", args: []string{"--max-body-size", "big"}, want: `--max-body-size: "big" is not a size`},
+		{name: "invalid setting", file: "log:\n  level: loud\n", want: `log.level: "loud" is not debug, info, warn or error`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.env != "" {
+				t.Setenv(EnvPrefix+"TIMEOUTS_READ", test.env)
+			}
+			_, err := load(t, test.file, test.args...)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("error = %v, want it to mention %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"errors"
+	"os"
+)
+
+// Directory is the data directory the file repositories read and write. Load sets it.
+var Directory string
+
+// ValidateDirectory checks the data directory. When it does not exist yet it is created
+// and filled by initialize, which writes the empty data files.
+func ValidateDirectory(initialize func() error) error {
+	// checking that --dir=path exists
+	if _, err := os.Stat(Directory); os.IsNotExist(err) {
+		err = os.Mkdir(Directory, 0o755)
+		if err != nil {
+			return errors.New("Error: " + err.Error())
+		}
+		// Automatically create the necessary JSON files
+		if err := initialize(); err != nil {
+			return err
+		}
+	}
+	// checking that '--dir=' is standard or not
+	if isStandardPackage(Directory) {
+		return errors.New("Error: directory(--dir=) cannot be one of the used ones {'cmd', 'config', 'internal', 'models'}.")
+	}
+	return nil
+}
+
+// DataFiles are the collection files of the data directory, which ValidateDirectory
+// creates with no entries when the directory does not exist yet.
+var DataFiles = []string{"orders.json", "menu_items.json", "inventory.json", "refunds.json", "shifts.json", "z_reports.json", "customers.json", "loyalty_ledger.json", "webhooks.json", "webhook_deliveries.json", "idempotency_keys.json"}
+
+func isStandardPackage(packageName string) bool {
+	return packageName == "cmd" || packageName == "config" || packageName == "internal" || packageName == "models"
+}
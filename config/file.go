@@ -0,0 +1,126 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readFile reads a JSON or YAML config file into setting values keyed like
+// "storage.dir". Files ending in .json are JSON; anything else is YAML.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	var values map[string]string
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		values, err = parseJSON(data)
+	} else {
+		values, err = parseYAML(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// parseJSON flattens nested objects into dotted keys.
+func parseJSON(data []byte) (map[string]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var document map[string]any
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	if err := flattenJSON("", document, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func flattenJSON(prefix string, object map[string]any, values map[string]string) error {
+	for name, value := range object {
+		key := prefix + name
+		switch value := value.(type) {
+		case map[string]any:
+			if err := flattenJSON(key+".", value, values); err != nil {
+				return err
+			}
+		case string:
+			values[key] = value
+		case json.Number:
+			values[key] = value.String()
+		case bool:
+			values[key] = fmt.Sprint(value)
+		default:
+			return fmt.Errorf("%s: must be a string, number, boolean or object", key)
+		}
+	}
+	return nil
+}
+
+// parseYAML reads the subset of YAML a config file needs: "key: value" pairs, optionally
+// grouped one level deep under a "section:" line, with # comments and quoted strings.
+func parseYAML(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for number := 1; scanner.Scan(); number++ {
+		line := stripComment(scanner.Text())
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indented := line[0] == ' ' || line[0] == '\t'
+		name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" || strings.HasPrefix(name, "- ") {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", number)
+		}
+
+		switch {
+		case !indented && value == "":
+			section = name
+		case !indented:
+			section = ""
+			values[name] = unquote(value)
+		case section == "":
+			return nil, fmt.Errorf("line %d: indented key %q is not inside a section", number, name)
+		case value == "":
+			return nil, fmt.Errorf("line %d: sections can only be one level deep", number)
+		default:
+			values[section+"."+name] = unquote(value)
+		}
+	}
+	return values, scanner.Err()
+}
+
+// stripComment removes a # comment that is not inside quotes.
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
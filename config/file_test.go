@@ -0,0 +1,94 @@
+package config
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:  "top-level keys",
+			input: "addr: :9090\ncurrency: EUR\n",
+			want:  map[string]string{"addr": ":9090", "currency": "EUR"},
+		},
+		{
+			name:  "sections",
+			input: "storage:\n  dir: /var/lib/hot-coffee\n  backend: file\nlog:\n\tlevel: debug\ncurrency: EUR\n",
+			want:  map[string]string{"storage.dir": "/var/lib/hot-coffee", "storage.backend": "file", "log.level": "debug", "currency": "EUR"},
+		},
+		{
+			name:  "comments and blank lines",
+			input: "# hot-coffee\n\nlog:   # logging\n  level: warn # quieter\n\n  format: json\n",
+			want:  map[string]string{"log.level": "warn", "log.format": "json"},
+		},
+		{
+			name:  "hash without a space before it is part of the value",
+			input: "storage:\n  dir: data#1\n",
+			want:  map[string]string{"storage.dir": "data#1"},
+		},
+		{
+			name:  "quoted values",
+			input: "addr: \":9090\"\ntimezone: 'Europe/Paris'\nstorage:\n  dir: \"my data # not a comment\"\n",
+			want:  map[string]string{"addr": ":9090", "timezone": "Europe/Paris", "storage.dir": "my data # not a comment"},
+		},
+		{
+			name:  "unmatched quote is kept",
+			input: "currency: \"EUR\n",
+			want:  map[string]string{"currency": "\"EUR"},
+		},
+		{
+			name:  "colon in the value",
+			input: "addr: 127.0.0.1:9090\n",
+			want:  map[string]string{"addr": "127.0.0.1:9090"},
+		},
+		{
+			name:  "empty file",
+			input: "# nothing set\n",
+			want:  map[string]string{},
+		},
+		{name: "line without a colon", input: "addr 9090\n", wantErr: "line 1: expected \"key: value\""},
+		{name: "list item", input: "log:\n  - level: debug\n", wantErr: "line 2: expected \"key: value\""},
+		{name: "missing key", input: ": debug\n", wantErr: "line 1: expected \"key: value\""},
+		{name: "indented key outside a section", input: "  addr: :9090\n", wantErr: "line 1: indented key \"addr\" is not inside a section"},
+		{name: "nested section", input: "tls:\n  client:\n    ca: ca.pem\n", wantErr: "line 2: sections can only be one level deep"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(test.input))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, test.want) {
+				t.Errorf("values = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	got, err := parseJSON([]byte(`{"addr": ":9090", "storage": {"dir": "data"}, "backup": {"keep": 3}, "tax": {"rate": 0.2}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"addr": ":9090", "storage.dir": "data", "backup.keep": "3", "tax.rate": "0.2"}
+	if !maps.Equal(got, want) {
+		t.Errorf("values = %v, want %v", got, want)
+	}
+
+	if _, err := parseJSON([]byte(`{"addr": [":9090"]}`)); err == nil || !strings.Contains(err.Error(), "addr: must be") {
+		t.Errorf("error for an array value = %v", err)
+	}
+}
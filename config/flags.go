@@ -1,91 +1,80 @@
 package config
 
 import (
-	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 )
 
-var (
-	PortNumber string
-	Directory  string
-)
-
-func init() {
-	flag.StringVar(&PortNumber, "port", "8080", "Port number")
-	flag.StringVar(&Directory, "dir", "data", "Path to the directory")
-
-	helpMessage := `Coffee Shop Management System
+const helpMessage = `Coffee Shop Management System
 
 Usage:
-  hot-coffee [--port <N>] [--dir <S>] 
+  hot-coffee [--config <file>] [options]
+  hot-coffee [options] create-admin <username>
+  hot-coffee [options] gen-cert [<host>...]
+  hot-coffee fsck [--dir <path>] [--repair]
+  hot-coffee backup --out <file.tar.gz> [--dir <path>]
+  hot-coffee restore --in <file.tar.gz> [--dir <path>] [--verify]
   hot-coffee --help
 
+Commands:
+  create-admin           Add an admin user, reading the password from standard input.
+  fsck                   Check the data directory for missing, unknown and broken files and
+                         inconsistent records. --repair backs it up, then fixes what it safely can.
+  backup                 Write the data directory to a gzipped tar archive with a manifest of
+                         checksums. Stop the server first, or use POST /admin/backup.
+  restore                Check an archive made by backup and replace the data directory with it;
+                         the old directory is kept. Stop the server first.
+  gen-cert               Write a self-signed certificate for the hosts (default localhost and
+                         this machine) to --tls-cert and --tls-key, or cert.pem and key.pem.
+
 Options:
-  --help       Show this screen.
-  --port N     Port number.
-  --dir S      Path to the data directory.`
+  --help                 Show this screen.
+  --config FILE          JSON or YAML config file (also HOT_COFFEE_CONFIG).
+`
+
+// parseFlags reads the command line. It returns the settings given as flags keyed by
+// setting key, the config file path and the arguments after the flags.
+// --help is reported as flag.ErrHelp.
+func parseFlags(args []string) (map[string]string, string, []string, error) {
+	fs := flag.NewFlagSet("hot-coffee", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
 
-	flag.Usage = func() {
-		fmt.Println(helpMessage)
+	configPath := fs.String("config", "", "")
+	byFlag := make(map[string]setting)
+	for _, s := range settings {
+		fs.String(s.flagName(), "", s.usage)
+		byFlag[s.flagName()] = s
 	}
-	flag.Parse()
-}
 
-func ValidateDirectory() error {
-	// checking that --dir=path exists
-	if _, err := os.Stat(Directory); os.IsNotExist(err) {
-		err = os.Mkdir(Directory, 0o755)
-		if err != nil {
-			return errors.New("Error: " + err.Error())
-		}
-		// Automatically create the necessary JSON files
-		if err := createEmptyJSONFiles(Directory); err != nil {
-			return err
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			PrintUsage(os.Stdout)
 		}
+		return nil, "", nil, err
 	}
-	// checking that '--dir=' is standard or not
-	if isStandardPackage(Directory) {
-		return errors.New("Error: directory(--dir=) cannot be one of the used ones {'cmd', 'config', 'internal', 'models'}.")
-	}
-	return nil
-}
 
-func createEmptyJSONFiles(directory string) error {
-	// Define the list of files to create
-	files := []string{"orders.json", "menu_items.json", "inventory.json"}
-
-	for _, file := range files {
-		filePath := fmt.Sprintf("%s/%s", directory, file)
-		// Create and initialize each file with an empty array
-		if err := createFileWithEmptyArray(filePath); err != nil {
-			return err
+	values := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		if s, ok := byFlag[f.Name]; ok {
+			values[s.key] = f.Value.String()
 		}
-	}
-	return nil
+	})
+	return values, *configPath, fs.Args(), nil
 }
 
-func createFileWithEmptyArray(filePath string) error {
-	// Open the file for writing (create it if it doesn't exist)
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create file %s: %v", filePath, err)
-	}
-	defer file.Close()
-
-	// Write an empty array into the file
-	emptyArray := []interface{}{}
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ") // Optional: format the JSON output nicely
-	if err := encoder.Encode(emptyArray); err != nil {
-		return fmt.Errorf("failed to write empty array to file %s: %v", filePath, err)
+// PrintUsage writes the help screen, listing every setting with its flag, environment
+// variable and default.
+func PrintUsage(w io.Writer) {
+	fmt.Fprint(w, helpMessage)
+	for _, s := range settings {
+		line := fmt.Sprintf("  --%s VALUE", s.flagName())
+		fmt.Fprintf(w, "%-24s %s", line, s.usage)
+		if s.def != "" {
+			fmt.Fprintf(w, " (default %s)", s.def)
+		}
+		fmt.Fprintf(w, "\n%24s Config file: %s, environment: %s\n", "", s.key, s.envName())
 	}
-
-	return nil
-}
-
-func isStandardPackage(packageName string) bool {
-	return packageName == "cmd" || packageName == "config" || packageName == "internal" || packageName == "models"
 }
@@ -0,0 +1,117 @@
+package dal
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"hot-coffee/config"
+	"hot-coffee/models"
+	"os"
+	"time"
+)
+
+// maxAuditLineSize bounds one entry of the audit log; an order with many lines stays far below it.
+const maxAuditLineSize = 4 << 20
+
+type AuditRepository interface {
+	AppendEntry(entry *models.AuditEntry) error
+	GetAllEntries() ([]models.AuditEntry, error)
+	QueryEntries(query models.AuditQuery) ([]models.AuditEntry, models.PageInfo, error)
+}
+
+// FileAuditRepository keeps the audit log as JSON Lines, one entry per line, only ever
+// appended to.
+type FileAuditRepository struct{}
+
+func (r *FileAuditRepository) AppendEntry(entry *models.AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	defer beginWrite()()
+	defer timeStorage("audit.jsonl", "append")()
+
+	file, err := os.OpenFile(config.Directory+"/audit.jsonl", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func (r *FileAuditRepository) GetAllEntries() ([]models.AuditEntry, error) {
+	defer timeStorage("audit.jsonl", "read")()
+	entries := []models.AuditEntry{}
+	file, err := os.Open(config.Directory + "/audit.jsonl")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxAuditLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry models.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("audit log line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// QueryEntries returns one page of the entries matching the query, oldest first unless
+// sorted otherwise.
+func (r *FileAuditRepository) QueryEntries(query models.AuditQuery) ([]models.AuditEntry, models.PageInfo, error) {
+	var from, to time.Time
+	var err error
+	if query.From != "" {
+		if from, err = parseTimeBound(query.From, false); err != nil {
+			return nil, models.PageInfo{}, err
+		}
+	}
+	if query.To != "" {
+		if to, err = parseTimeBound(query.To, true); err != nil {
+			return nil, models.PageInfo{}, err
+		}
+	}
+
+	entries, err := r.GetAllEntries()
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	matching := []models.AuditEntry{}
+	for _, entry := range entries {
+		if (query.EntityType != "" && entry.EntityType != query.EntityType) ||
+			(query.EntityID != "" && entry.EntityID != query.EntityID) ||
+			(query.Actor != "" && entry.Actor != query.Actor) ||
+			(query.Action != "" && entry.Action != query.Action) {
+			continue
+		}
+		if !from.IsZero() || !to.IsZero() {
+			at, err := time.Parse(time.RFC3339Nano, entry.Time)
+			if err != nil || (!from.IsZero() && at.Before(from)) || (!to.IsZero() && at.After(to)) {
+				continue
+			}
+		}
+		matching = append(matching, entry)
+	}
+
+	err = sortBy(matching, query.Sort, map[string]func(a, b models.AuditEntry) int{
+		"seq": func(a, b models.AuditEntry) int { return cmp.Compare(a.Seq, b.Seq) },
+	})
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+	return paginate(matching, query.Page)
+}
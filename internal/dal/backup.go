@@ -0,0 +1,364 @@
+package dal
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hot-coffee/config"
+	"hot-coffee/models"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	manifestName = "manifest.json"
+	// backupPrefix and backupSuffix make up the names of the archives in the backup directory.
+	backupPrefix = "hot-coffee-"
+	backupSuffix = ".tar.gz"
+)
+
+// requestWrites is held for reading by changes spanning several files, such as an order
+// taking stock from the inventory, and for writing by snapshot, so a backup never holds
+// half of such a change.
+var requestWrites sync.RWMutex
+
+// HoldWrites keeps snapshots from being taken until the returned func is called. Requests
+// that change data hold it for as long as they run.
+func HoldWrites() func() {
+	requestWrites.RLock()
+	return requestWrites.RUnlock
+}
+
+type snapshotFile struct {
+	name string
+	data []byte
+}
+
+// snapshot reads every data file present once the changes in progress have finished. New
+// changes wait until it is done, which is only as long as reading the files takes.
+func snapshot() ([]snapshotFile, error) {
+	requestWrites.Lock()
+	defer requestWrites.Unlock()
+	fileWrites.Lock()
+	defer fileWrites.Unlock()
+
+	var files []snapshotFile
+	for _, name := range knownFiles() {
+		data, err := os.ReadFile(filepath.Join(config.Directory, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, snapshotFile{name: name, data: data})
+	}
+	return files, nil
+}
+
+// WriteBackup takes a snapshot of the data directory and writes it to w as a gzipped tar
+// archive: manifest.json first, then the data files.
+func WriteBackup(w io.Writer) (*models.BackupManifest, error) {
+	files, err := snapshot()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	manifest := &models.BackupManifest{SchemaVersion: dataVersion(files), CreatedAt: now.Format(time.RFC3339), Files: []models.BackupFile{}}
+	for _, file := range files {
+		sum := sha256.Sum256(file.data)
+		manifest.Files = append(manifest.Files, models.BackupFile{Name: file.name, Size: int64(len(file.data)), SHA256: hex.EncodeToString(sum[:])})
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	compressed := gzip.NewWriter(w)
+	archive := tar.NewWriter(compressed)
+	for _, file := range slices.Insert(files, 0, snapshotFile{name: manifestName, data: manifestData}) {
+		header := &tar.Header{Name: file.name, Mode: 0o600, Size: int64(len(file.data)), ModTime: now, Typeflag: tar.TypeReg}
+		if err := archive.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := archive.Write(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, compressed.Close()
+}
+
+// dataVersion is the schema version of the oldest collection file, which restoring the
+// files needs the code to understand. The files are only older than SchemaVersion when
+// they have not been upgraded by starting the server yet.
+func dataVersion(files []snapshotFile) int {
+	version := SchemaVersion
+	for _, file := range files {
+		if !isVersioned(file.name) {
+			continue
+		}
+		if _, v, err := readItems(file.name, file.data); err == nil && v < version {
+			version = v
+		}
+	}
+	return version
+}
+
+// WriteBackupFile writes a backup archive to path, which must not exist yet.
+func WriteBackupFile(path string) (*models.BackupManifest, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := writeBackupTo(file)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// writeBackupTo writes a backup archive to file, syncs it and closes it.
+func writeBackupTo(file *os.File) (*models.BackupManifest, error) {
+	manifest, err := WriteBackup(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return manifest, file.Close()
+}
+
+// readBackup reads a backup archive and verifies it: the manifest must be there, name
+// only data files and match them in size and checksum, and have a schema version this
+// code knows.
+func readBackup(r io.Reader) (*models.BackupManifest, []snapshotFile, error) {
+	compressed, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a gzipped archive: %w", err)
+	}
+	archive := tar.NewReader(compressed)
+
+	var manifest *models.BackupManifest
+	var files []snapshotFile
+	known := knownFiles()
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("archive is damaged: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, nil, fmt.Errorf("archive entry %s is not a regular file", header.Name)
+		}
+		if header.Name != manifestName && !slices.Contains(known, header.Name) {
+			return nil, nil, fmt.Errorf("archive entry %s is not a data file", header.Name)
+		}
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, nil, fmt.Errorf("archive is damaged: %s: %w", header.Name, err)
+		}
+
+		if header.Name != manifestName {
+			if slices.ContainsFunc(files, func(f snapshotFile) bool { return f.name == header.Name }) {
+				return nil, nil, fmt.Errorf("archive holds %s more than once", header.Name)
+			}
+			files = append(files, snapshotFile{name: header.Name, data: data})
+			continue
+		}
+		if manifest != nil {
+			return nil, nil, errors.New("archive holds more than one manifest")
+		}
+		manifest = &models.BackupManifest{}
+		if err := json.Unmarshal(data, manifest); err != nil {
+			return nil, nil, fmt.Errorf("manifest does not decode: %w", err)
+		}
+	}
+	if manifest == nil {
+		return nil, nil, errors.New("archive has no manifest; it was not made by hot-coffee backup")
+	}
+	if manifest.SchemaVersion < 1 || manifest.SchemaVersion > SchemaVersion {
+		return nil, nil, fmt.Errorf("archive has schema version %d, this version of hot-coffee reads up to %d", manifest.SchemaVersion, SchemaVersion)
+	}
+
+	if len(manifest.Files) != len(files) {
+		return nil, nil, fmt.Errorf("manifest lists %d files, archive holds %d", len(manifest.Files), len(files))
+	}
+	for _, listed := range manifest.Files {
+		i := slices.IndexFunc(files, func(f snapshotFile) bool { return f.name == listed.Name })
+		if i < 0 {
+			return nil, nil, fmt.Errorf("%s is in the manifest but not in the archive", listed.Name)
+		}
+		sum := sha256.Sum256(files[i].data)
+		if int64(len(files[i].data)) != listed.Size || hex.EncodeToString(sum[:]) != listed.SHA256 {
+			return nil, nil, fmt.Errorf("%s does not match its checksum in the manifest", listed.Name)
+		}
+	}
+	return manifest, files, nil
+}
+
+// VerifyBackupFile reads the archive at path and checks it against its manifest.
+func VerifyBackupFile(path string) (*models.BackupManifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	manifest, _, err := readBackup(file)
+	return manifest, err
+}
+
+// RestoreBackupFile verifies the archive at path and replaces config.Directory with its
+// contents. The files are unpacked into a new directory next to it first, and only once
+// they are all written are the two swapped; the old directory is kept under a new name,
+// which is returned ("" if there was none). The server must not be running.
+func RestoreBackupFile(path string) (*models.BackupManifest, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	manifest, files, err := readBackup(file)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dir := filepath.Clean(config.Directory)
+	staging, err := os.MkdirTemp(filepath.Dir(dir), "."+filepath.Base(dir)+".restore-*")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(staging)
+	for _, f := range files {
+		if err := writeSynced(filepath.Join(staging, f.name), f.data, filePerm(f.name)); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := os.Chmod(staging, 0o755); err != nil {
+		return nil, "", err
+	}
+
+	previous := ""
+	if _, err := os.Stat(dir); err == nil {
+		previous = fmt.Sprintf("%s.before-restore-%s", dir, time.Now().Format("20060102-150405"))
+		if err := os.Rename(dir, previous); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		if previous != "" {
+			os.Rename(previous, dir)
+		}
+		return nil, "", err
+	}
+	return manifest, previous, nil
+}
+
+func writeSynced(path string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return errors.Join(file.Sync(), file.Close())
+}
+
+// FileBackupRepository keeps backup archives in a directory of their own, named after the
+// time they were taken.
+type FileBackupRepository struct {
+	Dir string
+}
+
+// CreateBackup writes a new archive. It is written under a temporary name and renamed
+// once complete, so the directory never lists a partial archive.
+func (r *FileBackupRepository) CreateBackup() (*models.Backup, error) {
+	if err := os.MkdirAll(r.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(r.Dir, ".backup.*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	tmpName := file.Name()
+	defer os.Remove(tmpName)
+
+	manifest, err := writeBackupTo(file)
+	if err != nil {
+		return nil, err
+	}
+	// Linking fails rather than replacing an archive taken in the same second
+	created, _ := time.Parse(time.RFC3339, manifest.CreatedAt)
+	stem := backupPrefix + created.Format("20060102-150405")
+	name := stem + backupSuffix
+	for n := 2; ; n++ {
+		err := os.Link(tmpName, filepath.Join(r.Dir, name))
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		name = fmt.Sprintf("%s-%d%s", stem, n, backupSuffix)
+	}
+	info, err := os.Stat(filepath.Join(r.Dir, name))
+	if err != nil {
+		return nil, err
+	}
+	return &models.Backup{Name: name, Size: info.Size(), CreatedAt: manifest.CreatedAt, Manifest: manifest}, nil
+}
+
+// GetAllBackups lists the archives in the directory, oldest first.
+func (r *FileBackupRepository) GetAllBackups() ([]models.Backup, error) {
+	backups := []models.Backup{}
+	entries, err := os.ReadDir(r.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return backups, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var infos []os.FileInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	// Archives taken in the same second share the start of their name, so go by time
+	slices.SortStableFunc(infos, func(a, b os.FileInfo) int {
+		return a.ModTime().Compare(b.ModTime())
+	})
+	for _, info := range infos {
+		backups = append(backups, models.Backup{Name: info.Name(), Size: info.Size(), CreatedAt: info.ModTime().Format(time.RFC3339)})
+	}
+	return backups, nil
+}
+
+func (r *FileBackupRepository) DeleteBackup(name string) error {
+	return os.Remove(filepath.Join(r.Dir, filepath.Base(name)))
+}
@@ -0,0 +1,58 @@
+package dal
+
+import (
+	"fmt"
+	"hot-coffee/config"
+	"hot-coffee/models"
+	"os"
+	"sync"
+)
+
+type CustomerRepository interface {
+	AddCustomer(customer *models.Customer) error
+	GetAllCustomers() ([]models.Customer, error)
+	SaveCustomers(customers []models.Customer) error
+}
+
+// FileCustomerRepository keeps the customers in customers.json. Its mutex is held from
+// loading the customers to saving them, including the check for duplicate contact details.
+type FileCustomerRepository struct {
+	sync.Mutex
+}
+
+func (r *FileCustomerRepository) AddCustomer(customer *models.Customer) error {
+	customers, err := r.GetAllCustomers()
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range customers {
+		if existing.ID == customer.ID {
+			return models.ConflictError("duplicate_id", fmt.Sprintf("customer with ID %s already exists", customer.ID))
+		}
+	}
+	customers = append(customers, *customer)
+	return r.SaveCustomers(customers)
+}
+
+func (r *FileCustomerRepository) GetAllCustomers() ([]models.Customer, error) {
+	defer timeStorage("customers.json", "read")()
+	var customers []models.Customer
+	file, err := os.Open(config.Directory + "/customers.json")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return customers, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	if err = decodeDataFile(file, &customers); err != nil {
+		return nil, err
+	}
+	return customers, nil
+}
+
+func (r *FileCustomerRepository) SaveCustomers(customers []models.Customer) error {
+	return writeJSONFile("customers.json", customers, 0o644)
+}
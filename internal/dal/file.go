@@ -0,0 +1,129 @@
+package dal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hot-coffee/config"
+	"hot-coffee/internal/metrics"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// writes counts the file writes in progress so shutdown can wait for them.
+	writes sync.WaitGroup
+	// fileWrites is held for reading by every file write and for writing by snapshot.
+	fileWrites sync.RWMutex
+)
+
+// beginWrite registers a file write; call the result when it is done. While a snapshot
+// is being taken the write waits for it.
+func beginWrite() func() {
+	writes.Add(1)
+	fileWrites.RLock()
+	return func() {
+		fileWrites.RUnlock()
+		writes.Done()
+	}
+}
+
+var storageDuration = metrics.Default.NewHistogram("hotcoffee_storage_operation_duration_seconds",
+	"Time taken to read or write a data file.", metrics.DefaultBuckets, "file", "operation")
+
+// timeStorage starts timing an operation on a data file; call the result when it is done.
+func timeStorage(name, operation string) func() {
+	start := time.Now()
+	return func() {
+		storageDuration.Observe(time.Since(start).Seconds(), name, operation)
+	}
+}
+
+// writeJSONFile replaces a file in the data directory with v encoded as JSON, in an
+// envelope with the current schema version for collection files. The data goes to a
+// temporary file that is synced and then renamed over the old one, so a crash or a kill
+// leaves either the old contents or the new ones, never half of each.
+func writeJSONFile(name string, v any, perm os.FileMode) error {
+	defer beginWrite()()
+	defer timeStorage(name, "write")()
+	if isVersioned(name) {
+		v = envelope{SchemaVersion: SchemaVersion, Items: v}
+	}
+
+	file, err := os.CreateTemp(config.Directory, "."+name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := file.Name()
+	// Once the rename succeeds there is nothing left to remove
+	defer os.Remove(tmpName)
+
+	if err := file.Chmod(perm); err != nil {
+		file.Close()
+		return err
+	}
+	if err := json.NewEncoder(file).Encode(v); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, filepath.Join(config.Directory, name))
+}
+
+// WaitForWrites blocks until the file writes in progress have finished or ctx is done.
+func WaitForWrites(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		writes.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FileStorage is the data directory as a whole.
+type FileStorage struct{}
+
+// CheckWritable creates and removes a file in the data directory.
+func (s *FileStorage) CheckWritable() error {
+	file, err := os.CreateTemp(config.Directory, ".health.*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString("ok"); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// CheckDecodes reads the file of a collection, e.g. orders.json for "orders", and decodes
+// it into v. Unlike the repositories it treats a missing file as an error, since
+// ValidateDirectory creates every file at startup.
+func (s *FileStorage) CheckDecodes(collection string, v any) error {
+	name := collection + ".json"
+	defer timeStorage(name, "read")()
+	file, err := os.Open(filepath.Join(config.Directory, name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := decodeDataFile(file, v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,428 @@
+package dal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hot-coffee/config"
+	"hot-coffee/models"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// credentialFiles hold password, key and token hashes and are readable by the owner only.
+var credentialFiles = []string{"users.json", "api_keys.json", "sessions.json"}
+
+// privateFiles are readable by the owner only, like the credential files: the stored
+// responses to Idempotency-Key requests, and the webhooks with their signing secrets.
+var privateFiles = []string{"idempotency_keys.json", "webhooks.json"}
+
+// filePerm is the mode a data file is written with.
+func filePerm(name string) os.FileMode {
+	if slices.Contains(credentialFiles, name) || slices.Contains(privateFiles, name) {
+		return 0o600
+	}
+	return 0o644
+}
+
+// optionalFiles are written the first time they are needed rather than at startup.
+var optionalFiles = []string{"loyalty_settings.json", "audit.jsonl"}
+
+// Issue is one problem Fsck found in the data directory.
+type Issue struct {
+	File    string
+	Problem string
+	// Fix says what --repair does about the problem; it is empty when a person has to
+	// decide, e.g. which of two different orders with the same ID is the real one.
+	Fix      string
+	Repaired bool
+}
+
+// FsckReport lists the problems found and, after a repair, where the data was backed up.
+type FsckReport struct {
+	Issues []Issue
+	Backup string
+}
+
+// fsck holds the state of one check of config.Directory.
+type fsck struct {
+	report *FsckReport
+	// sources maps a file name to the file its contents are read from, when a misnamed
+	// file is to be renamed.
+	sources map[string]string
+	// fixes are run in order once every check is done and the data is backed up.
+	fixes []fsckFix
+	// dirty are files whose repaired contents must be written, with their values.
+	dirty map[string]any
+}
+
+type fsckFix struct {
+	issue int
+	apply func() error
+}
+
+// Fsck checks the data directory for unknown and missing files, JSON that does not
+// decode, duplicate IDs, negative quantities, orders and menu items referring to
+// products or ingredients that do not exist and orders with an unknown status. With
+// repair set it copies the directory to a backup next to it and then fixes what can be
+// fixed without guessing.
+func Fsck(repair bool) (*FsckReport, error) {
+	info, err := os.Stat(config.Directory)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", config.Directory)
+	}
+
+	f := &fsck{report: &FsckReport{}, sources: make(map[string]string), dirty: make(map[string]any)}
+	if err := f.checkFiles(); err != nil {
+		return nil, err
+	}
+	f.checkContents()
+
+	if !repair || (len(f.fixes) == 0 && len(f.dirty) == 0) {
+		return f.report, nil
+	}
+	backup, err := backupDirectory(config.Directory)
+	if err != nil {
+		return nil, fmt.Errorf("backing up before repair: %w", err)
+	}
+	f.report.Backup = backup
+	for _, fix := range f.fixes {
+		if err := fix.apply(); err != nil {
+			return f.report, fmt.Errorf("repairing %s: %w", f.report.Issues[fix.issue].File, err)
+		}
+	}
+	for name, value := range f.dirty {
+		if err := writeJSONFile(name, value, filePerm(name)); err != nil {
+			return f.report, fmt.Errorf("repairing %s: %w", name, err)
+		}
+	}
+	for i := range f.report.Issues {
+		if f.report.Issues[i].Fix != "" {
+			f.report.Issues[i].Repaired = true
+		}
+	}
+	return f.report, nil
+}
+
+// add records an issue. apply, when given, makes the fix after the backup; fixes to
+// file contents are made to the decoded values right away and written at the end.
+func (f *fsck) add(file, problem, fix string, apply func() error) {
+	f.report.Issues = append(f.report.Issues, Issue{File: file, Problem: problem, Fix: fix})
+	if apply != nil {
+		f.fixes = append(f.fixes, fsckFix{issue: len(f.report.Issues) - 1, apply: apply})
+	}
+}
+
+func knownFiles() []string {
+	return slices.Concat(config.DataFiles, credentialFiles, optionalFiles)
+}
+
+// checkFiles looks for unknown files, leftovers of interrupted writes and missing files.
+func (f *fsck) checkFiles() error {
+	entries, err := os.ReadDir(config.Directory)
+	if err != nil {
+		return err
+	}
+	present := make(map[string]bool)
+	for _, entry := range entries {
+		present[entry.Name()] = true
+	}
+
+	known := knownFiles()
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(config.Directory, name)
+		switch {
+		case slices.Contains(known, name), name == pidFile:
+		case entry.IsDir():
+			f.add(name, "unknown directory", "", nil)
+		case strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".tmp"):
+			f.add(name, "temporary file left behind by an interrupted write", "remove it", func() error {
+				return os.Remove(path)
+			})
+		default:
+			target := misnamedFile(name, present)
+			if target == "" || f.sources[target] != "" {
+				f.add(name, "unknown file; the server does not read it", "", nil)
+				continue
+			}
+			f.sources[target] = name
+			f.add(name, "unknown file; the server reads "+target+" instead", "rename it to "+target, func() error {
+				return os.Rename(path, filepath.Join(config.Directory, target))
+			})
+		}
+	}
+
+	for _, name := range config.DataFiles {
+		if present[name] || f.sources[name] != "" {
+			continue
+		}
+		f.add(name, "missing", "create it with no entries", func() error {
+			return writeJSONFile(name, []any{}, filePerm(name))
+		})
+	}
+	return nil
+}
+
+// misnamedFile returns the data file an unknown file was probably meant to be, such as
+// menu_items.json for menu.json, when that file is missing or empty.
+func misnamedFile(name string, present map[string]bool) string {
+	stem, ext := strings.TrimSuffix(name, filepath.Ext(name)), filepath.Ext(name)
+	if stem == "" {
+		return ""
+	}
+	for _, known := range config.DataFiles {
+		knownStem := strings.TrimSuffix(known, filepath.Ext(known))
+		if ext != filepath.Ext(known) || !(strings.HasPrefix(knownStem, stem) || strings.HasPrefix(stem, knownStem)) {
+			continue
+		}
+		if !present[known] || isEmptyArrayFile(known) {
+			return known
+		}
+	}
+	return ""
+}
+
+func isEmptyArrayFile(name string) bool {
+	var values []json.RawMessage
+	data, err := os.ReadFile(filepath.Join(config.Directory, name))
+	if err != nil {
+		return false
+	}
+	items, _, err := readItems(name, data)
+	return err == nil && json.Unmarshal(items, &values) == nil && len(values) == 0
+}
+
+// load decodes a data file, or the misnamed file it will be renamed from, into v. It
+// reports whether v holds the contents; missing files have been reported already.
+// Collection files of an older schema version are upgraded in memory and marked for
+// rewriting.
+func (f *fsck) load(name string, v any) bool {
+	source := name
+	if f.sources[name] != "" {
+		source = f.sources[name]
+	}
+	data, err := os.ReadFile(filepath.Join(config.Directory, source))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			f.add(source, "cannot be read: "+err.Error(), "", nil)
+		}
+		return false
+	}
+
+	if !isVersioned(name) {
+		if err := json.Unmarshal(data, v); err != nil {
+			f.add(source, "does not decode: "+err.Error(), "", nil)
+			return false
+		}
+		return true
+	}
+	items, version, err := readItems(name, data)
+	if errors.Is(err, ErrNewerSchema) {
+		f.add(source, fmt.Sprintf("has schema version %d, newer than the %d this version of hot-coffee understands", version, SchemaVersion), "", nil)
+		return false
+	}
+	if err == nil {
+		err = json.Unmarshal(items, v)
+	}
+	if err != nil {
+		f.add(source, "does not decode: "+err.Error(), "", nil)
+		return false
+	}
+	if version < SchemaVersion {
+		f.add(source, fmt.Sprintf("has schema version %d; the server upgrades it when it starts", version), fmt.Sprintf("upgrade it to version %d", SchemaVersion), nil)
+		// Written as upgraded rather than re-encoded from v, which would drop any field
+		// the models do not know
+		f.dirty[name] = items
+	}
+	return true
+}
+
+func (f *fsck) checkContents() {
+	var inventory []models.InventoryItem
+	inventoryOK := f.load("inventory.json", &inventory)
+	if inventoryOK {
+		inventory = dedupe(f, "inventory.json", "ingredient", inventory, func(item models.InventoryItem) string { return item.IngredientID })
+		for i, item := range inventory {
+			if item.Quantity < 0 {
+				inventory[i].Quantity = 0
+				f.add("inventory.json", fmt.Sprintf("ingredient %s has a negative quantity %g", item.IngredientID, item.Quantity), "set it to 0", nil)
+				f.dirty["inventory.json"] = inventory
+			}
+		}
+	}
+	ingredients := make(map[string]bool)
+	for _, item := range inventory {
+		ingredients[item.IngredientID] = true
+	}
+
+	var menu []models.MenuItem
+	menuOK := f.load("menu_items.json", &menu)
+	if menuOK {
+		menu = dedupe(f, "menu_items.json", "product", menu, func(item models.MenuItem) string { return item.ID })
+		for _, item := range menu {
+			if item.Price < 0 {
+				f.add("menu_items.json", fmt.Sprintf("product %s has a negative price %g", item.ID, item.Price), "", nil)
+			}
+			for _, ingredient := range item.Ingredients {
+				if ingredient.Quantity < 0 {
+					f.add("menu_items.json", fmt.Sprintf("product %s needs a negative quantity %g of %s", item.ID, ingredient.Quantity, ingredient.IngredientID), "", nil)
+				}
+				if inventoryOK && !ingredients[ingredient.IngredientID] {
+					f.add("menu_items.json", fmt.Sprintf("product %s refers to unknown ingredient %s", item.ID, ingredient.IngredientID), "", nil)
+				}
+			}
+		}
+	}
+	products := make(map[string]bool)
+	for _, item := range menu {
+		products[item.ID] = true
+	}
+
+	var orders []models.Order
+	if f.load("orders.json", &orders) {
+		orders = dedupe(f, "orders.json", "order", orders, func(order models.Order) string { return order.ID })
+		for i, order := range orders {
+			if order.Status != models.OrderOpen && order.Status != models.OrderClosed {
+				normalized := strings.ToLower(strings.TrimSpace(order.Status))
+				if normalized == models.OrderOpen || normalized == models.OrderClosed {
+					orders[i].Status = normalized
+					f.add("orders.json", fmt.Sprintf("order %s has status %q", order.ID, order.Status), "change it to "+normalized, nil)
+					f.dirty["orders.json"] = orders
+				} else {
+					f.add("orders.json", fmt.Sprintf("order %s has unknown status %q", order.ID, order.Status), "", nil)
+				}
+			}
+			for _, item := range order.Items {
+				if item.Quantity <= 0 {
+					f.add("orders.json", fmt.Sprintf("order %s has quantity %d of %s", order.ID, item.Quantity, item.ProductID), "", nil)
+				}
+				if menuOK && !products[item.ProductID] {
+					f.add("orders.json", fmt.Sprintf("order %s refers to unknown product %s", order.ID, item.ProductID), "", nil)
+				}
+			}
+		}
+	}
+
+	var refunds []models.Refund
+	if f.load("refunds.json", &refunds) {
+		dedupe(f, "refunds.json", "refund", refunds, func(refund models.Refund) string { return refund.ID })
+		for _, refund := range refunds {
+			for _, item := range refund.Items {
+				if item.Quantity <= 0 {
+					f.add("refunds.json", fmt.Sprintf("refund %s has quantity %d of %s", refund.ID, item.Quantity, item.ProductID), "", nil)
+				}
+			}
+		}
+	}
+
+	var customers []models.Customer
+	if f.load("customers.json", &customers) {
+		dedupe(f, "customers.json", "customer", customers, func(customer models.Customer) string { return customer.ID })
+	}
+	var shifts []models.Shift
+	if f.load("shifts.json", &shifts) {
+		dedupe(f, "shifts.json", "shift", shifts, func(shift models.Shift) string { return shift.ID })
+	}
+	var webhooks []models.Webhook
+	if f.load("webhooks.json", &webhooks) {
+		dedupe(f, "webhooks.json", "webhook", webhooks, func(webhook models.Webhook) string { return webhook.ID })
+	}
+	var users []models.User
+	if f.load("users.json", &users) {
+		users = dedupe(f, "users.json", "user", users, func(user models.User) string { return user.ID })
+		dedupe(f, "users.json", "username", users, func(user models.User) string { return user.Username })
+	}
+
+	// The remaining files only need to decode
+	f.load("z_reports.json", &[]models.ZReport{})
+	f.load("loyalty_ledger.json", &[]models.LoyaltyEntry{})
+	f.load("loyalty_settings.json", &models.LoyaltySettings{})
+	f.load("webhook_deliveries.json", &[]models.WebhookDelivery{})
+	f.load("idempotency_keys.json", &[]models.IdempotencyRecord{})
+	f.load("api_keys.json", &[]models.APIKey{})
+	f.load("sessions.json", &[]models.Session{})
+	if _, err := (&FileAuditRepository{}).GetAllEntries(); err != nil {
+		f.add("audit.jsonl", "does not decode: "+err.Error(), "", nil)
+	}
+}
+
+// dedupe reports IDs used more than once. Copies identical to the first are dropped in
+// the returned slice and the file is marked for rewriting; records that differ are left
+// for a person to sort out.
+func dedupe[T any](f *fsck, file, kind string, items []T, id func(T) string) []T {
+	first := make(map[string]int)
+	kept := make([]T, 0, len(items))
+	dropped := false
+	for _, item := range items {
+		key := id(item)
+		i, seen := first[key]
+		switch {
+		case !seen:
+			first[key] = len(kept)
+			kept = append(kept, item)
+		case reflect.DeepEqual(kept[i], item):
+			f.add(file, fmt.Sprintf("%s %s appears more than once", kind, key), "drop the identical copy", nil)
+			dropped = true
+		default:
+			f.add(file, fmt.Sprintf("%s %s is used by different records", kind, key), "", nil)
+			kept = append(kept, item)
+		}
+	}
+	if !dropped {
+		return items
+	}
+	f.dirty[file] = kept
+	return kept
+}
+
+// backupDirectory copies the files of dir to a new directory next to it, named after
+// dir and the current time.
+func backupDirectory(dir string) (string, error) {
+	backup := fmt.Sprintf("%s.backup-%s", filepath.Clean(dir), time.Now().Format("20060102-150405"))
+	if err := os.Mkdir(backup, 0o700); err != nil {
+		return "", err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := copyFile(filepath.Join(dir, entry.Name()), filepath.Join(backup, entry.Name())); err != nil {
+			return "", err
+		}
+	}
+	return backup, nil
+}
+
+func copyFile(from, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+	target, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close()
+		return err
+	}
+	return errors.Join(target.Sync(), target.Close())
+}
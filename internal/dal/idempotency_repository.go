@@ -0,0 +1,36 @@
+package dal
+
+import (
+	"hot-coffee/config"
+	"hot-coffee/models"
+	"os"
+)
+
+type IdempotencyRepository interface {
+	GetAllRecords() ([]models.IdempotencyRecord, error)
+	SaveRecords(records []models.IdempotencyRecord) error
+}
+
+type FileIdempotencyRepository struct{}
+
+func (r *FileIdempotencyRepository) GetAllRecords() ([]models.IdempotencyRecord, error) {
+	defer timeStorage("idempotency_keys.json", "read")()
+	var records []models.IdempotencyRecord
+	file, err := os.Open(config.Directory + "/idempotency_keys.json")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	if err = decodeDataFile(file, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func (r *FileIdempotencyRepository) SaveRecords(records []models.IdempotencyRecord) error {
+	return writeJSONFile("idempotency_keys.json", records, filePerm("idempotency_keys.json"))
+}
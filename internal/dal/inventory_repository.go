@@ -1,12 +1,13 @@
 package dal
 
 import (
-	"encoding/json"
-	"errors"
+	"cmp"
 	"fmt"
 	"hot-coffee/config"
 	"hot-coffee/models"
 	"os"
+	"strings"
+	"sync"
 )
 
 type InventoryRepository interface {
@@ -14,9 +15,14 @@ type InventoryRepository interface {
 	GetAllItems() ([]models.InventoryItem, error)
 	SaveItems(items []models.InventoryItem) error
 	AddInventory(ingredientID string, quantity float64) error
+	QueryItems(query models.InventoryQuery) ([]models.InventoryItem, models.PageInfo, error)
 }
 
-type FileInventoryRepository struct{}
+// FileInventoryRepository keeps the inventory in inventory.json. Stock is taken and
+// returned with its mutex held, so concurrent orders cannot both spend the same stock.
+type FileInventoryRepository struct {
+	sync.Mutex
+}
 
 // AddItem adds a new inventory item to the repository.
 // It reads the existing items, checks for duplicates, and then saves the new item.
@@ -29,7 +35,7 @@ func (r *FileInventoryRepository) AddItem(item *models.InventoryItem) error {
 	// Check for duplicate ingredient ID
 	for _, existingItem := range items {
 		if existingItem.IngredientID == item.IngredientID {
-			return fmt.Errorf("item with Ingredient ID %s already exists", item.IngredientID)
+			return models.ConflictError("duplicate_id", fmt.Sprintf("item with Ingredient ID %s already exists", item.IngredientID))
 		}
 	}
 
@@ -40,6 +46,7 @@ func (r *FileInventoryRepository) AddItem(item *models.InventoryItem) error {
 
 // GetAllItems retrieves all inventory items from the repository.
 func (r *FileInventoryRepository) GetAllItems() ([]models.InventoryItem, error) {
+	defer timeStorage("inventory.json", "read")()
 	var items []models.InventoryItem
 	file, err := os.Open(config.Directory + "/inventory.json")
 	if err != nil {
@@ -51,24 +58,24 @@ func (r *FileInventoryRepository) GetAllItems() ([]models.InventoryItem, error)
 	}
 	defer file.Close()
 
-	err = json.NewDecoder(file).Decode(&items)
+	err = decodeDataFile(file, &items)
 	if err != nil {
 		return nil, err
 	}
 
+	// Items written before versioning count as version 1
+	for i := range items {
+		if items[i].Version == 0 {
+			items[i].Version = 1
+		}
+	}
 	return items, nil
 }
 
 // saveItems saves the inventory items to the JSON file.
 func (r *FileInventoryRepository) saveItems(items []models.InventoryItem) error {
-	file, err := os.OpenFile(config.Directory+"/inventory.json", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
 	// Write the inventory items back to the file as JSON
-	return json.NewEncoder(file).Encode(items)
+	return writeJSONFile("inventory.json", items, 0o644)
 }
 
 // dal/file_inventory_repository.go
@@ -78,18 +85,10 @@ func (r *FileInventoryRepository) SaveItems(items []models.InventoryItem) error
 }
 
 func (r *FileInventoryRepository) AddInventory(ingredientID string, quantity float64) error {
-	var inventoryItems []models.InventoryItem
-
-	// Open inventory.json and decode it
-	file, err := os.OpenFile(config.Directory+"/inventory.json", os.O_RDWR, 0o644)
+	inventoryItems, err := r.GetAllItems()
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	if err := json.NewDecoder(file).Decode(&inventoryItems); err != nil {
-		return err
-	}
 
 	// Track if we updated any item
 	itemFound := false
@@ -98,6 +97,7 @@ func (r *FileInventoryRepository) AddInventory(ingredientID string, quantity flo
 	for i, item := range inventoryItems {
 		if item.IngredientID == ingredientID {
 			inventoryItems[i].Quantity += quantity
+			inventoryItems[i].Version = max(item.Version, 1) + 1
 			itemFound = true
 			break
 		}
@@ -105,11 +105,40 @@ func (r *FileInventoryRepository) AddInventory(ingredientID string, quantity flo
 
 	// If no matching ingredient was found, return an error
 	if !itemFound {
-		return errors.New("ingredient not found in inventory")
+		return models.ErrIngredientNotFound
 	}
 
 	// Write the updated inventory back to the file
-	file.Seek(0, 0)
-	file.Truncate(0) // Clear existing data
-	return json.NewEncoder(file).Encode(inventoryItems)
+	return r.saveItems(inventoryItems)
+}
+
+var inventorySortFields = map[string]func(a, b models.InventoryItem) int{
+	"ingredient_id": func(a, b models.InventoryItem) int { return cmp.Compare(a.IngredientID, b.IngredientID) },
+	"name":          func(a, b models.InventoryItem) int { return compareFold(a.Name, b.Name) },
+	"quantity":      func(a, b models.InventoryItem) int { return cmp.Compare(a.Quantity, b.Quantity) },
+}
+
+// QueryItems returns one page of the inventory items matching the query.
+func (r *FileInventoryRepository) QueryItems(query models.InventoryQuery) ([]models.InventoryItem, models.PageInfo, error) {
+	items, err := r.GetAllItems()
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	name := strings.ToLower(query.Name)
+	matching := []models.InventoryItem{}
+	for _, item := range items {
+		if name != "" && !strings.Contains(strings.ToLower(item.Name), name) {
+			continue
+		}
+		if query.LowStock && !item.IsLowStock() {
+			continue
+		}
+		matching = append(matching, item)
+	}
+
+	if err := sortBy(matching, query.Sort, inventorySortFields); err != nil {
+		return nil, models.PageInfo{}, err
+	}
+	return paginate(matching, query.Page)
 }
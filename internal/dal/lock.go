@@ -0,0 +1,82 @@
+package dal
+
+import (
+	"errors"
+	"fmt"
+	"hot-coffee/config"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// pidFile is written to the data directory by a running server and holds its process ID,
+// so that backup and restore can tell the directory is in use. It is not a data file and
+// is left out of backups.
+const pidFile = "server.pid"
+
+// ErrDirectoryInUse is returned when a running server already uses the data directory.
+var ErrDirectoryInUse = errors.New("the data directory is in use by a running server")
+
+// ClaimDirectory marks the data directory as used by this process. It fails with
+// ErrDirectoryInUse when another running server has claimed it; a pid file left by a
+// server that is gone is replaced. Call the returned func to release the directory.
+func ClaimDirectory() (func(), error) {
+	path := filepath.Join(config.Directory, pidFile)
+	for attempt := 0; ; attempt++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = file.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) || attempt > 0 {
+			return nil, err
+		}
+
+		pid, err := DirectoryOwner()
+		if err != nil {
+			return nil, err
+		}
+		if pid != 0 && pid != os.Getpid() {
+			return nil, fmt.Errorf("%w (process %d)", ErrDirectoryInUse, pid)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+}
+
+// DirectoryOwner returns the process ID of the running server that claimed the data
+// directory, or 0 when no running server has.
+func DirectoryOwner() (int, error) {
+	data, err := os.ReadFile(filepath.Join(config.Directory, pidFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 || !isRunning(pid) {
+		return 0, nil
+	}
+	return pid, nil
+}
+
+// isRunning reports whether a process exists, by sending it the null signal.
+func isRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,83 @@
+package dal
+
+import (
+	"errors"
+	"hot-coffee/config"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestClaimDirectory(t *testing.T) {
+	previous := config.Directory
+	config.Directory = t.TempDir()
+	t.Cleanup(func() { config.Directory = previous })
+
+	release, err := ClaimDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid, err := DirectoryOwner(); err != nil || pid != os.Getpid() {
+		t.Errorf("owner = %d, %v; want %d", pid, err, os.Getpid())
+	}
+	report, err := Fsck(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range report.Issues {
+		if issue.File == pidFile {
+			t.Errorf("fsck reports the pid file: %s", issue.Problem)
+		}
+	}
+
+	release()
+	if pid, err := DirectoryOwner(); err != nil || pid != 0 {
+		t.Errorf("owner after release = %d, %v; want 0", pid, err)
+	}
+}
+
+func TestClaimDirectoryInUse(t *testing.T) {
+	previous := config.Directory
+	config.Directory = t.TempDir()
+	t.Cleanup(func() { config.Directory = previous })
+
+	// The parent of the test binary, such as go test itself, stands in for another server
+	path := filepath.Join(config.Directory, pidFile)
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getppid())+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ClaimDirectory(); !errors.Is(err, ErrDirectoryInUse) {
+		t.Errorf("claiming a directory in use: error = %v, want %v", err, ErrDirectoryInUse)
+	}
+	if pid, err := DirectoryOwner(); err != nil || pid != os.Getppid() {
+		t.Errorf("owner = %d, %v; want %d", pid, err, os.Getppid())
+	}
+}
+
+func TestClaimDirectoryLeftByAStoppedServer(t *testing.T) {
+	previous := config.Directory
+	config.Directory = t.TempDir()
+	t.Cleanup(func() { config.Directory = previous })
+
+	exited := exec.Command(os.Args[0], "-test.run=^$")
+	if err := exited.Run(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(config.Directory, pidFile)
+	if err := os.WriteFile(path, []byte(strconv.Itoa(exited.Process.Pid)+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if pid, err := DirectoryOwner(); err != nil || pid != 0 {
+		t.Errorf("owner = %d, %v; want 0", pid, err)
+	}
+	release, err := ClaimDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if pid, err := DirectoryOwner(); err != nil || pid != os.Getpid() {
+		t.Errorf("owner = %d, %v; want %d", pid, err, os.Getpid())
+	}
+}
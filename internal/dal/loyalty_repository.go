@@ -0,0 +1,76 @@
+package dal
+
+import (
+	"hot-coffee/config"
+	"hot-coffee/models"
+	"os"
+	"sync"
+)
+
+type LoyaltyRepository interface {
+	GetAllEntries() ([]models.LoyaltyEntry, error)
+	AddEntries(entries ...models.LoyaltyEntry) error
+	GetSettings() (*models.LoyaltySettings, error)
+	SaveSettings(settings *models.LoyaltySettings) error
+}
+
+// FileLoyaltyRepository keeps the ledger in loyalty_ledger.json. Its mutex is held while a
+// balance is worked out and the entries that depend on it are appended.
+type FileLoyaltyRepository struct {
+	sync.Mutex
+}
+
+func (r *FileLoyaltyRepository) GetAllEntries() ([]models.LoyaltyEntry, error) {
+	defer timeStorage("loyalty_ledger.json", "read")()
+	var entries []models.LoyaltyEntry
+	file, err := os.Open(config.Directory + "/loyalty_ledger.json")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	if err = decodeDataFile(file, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// AddEntries appends entries to the ledger. The ledger is never rewritten otherwise.
+func (r *FileLoyaltyRepository) AddEntries(entries ...models.LoyaltyEntry) error {
+	existing, err := r.GetAllEntries()
+	if err != nil {
+		return err
+	}
+
+	return writeJSONFile("loyalty_ledger.json", append(existing, entries...), 0o644)
+}
+
+// GetSettings reads the loyalty program settings, falling back to the defaults when none were saved.
+func (r *FileLoyaltyRepository) GetSettings() (*models.LoyaltySettings, error) {
+	settings := &models.LoyaltySettings{
+		PointsPerCurrencyUnit: 1,
+		PointValue:            0.05,
+		ExpiryDays:            365,
+	}
+	defer timeStorage("loyalty_settings.json", "read")()
+	file, err := os.Open(config.Directory + "/loyalty_settings.json")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return settings, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	if err = decodeDataFile(file, settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (r *FileLoyaltyRepository) SaveSettings(settings *models.LoyaltySettings) error {
+	return writeJSONFile("loyalty_settings.json", settings, 0o644)
+}
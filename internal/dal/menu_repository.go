@@ -1,20 +1,27 @@
 package dal
 
 import (
-	"encoding/json"
+	"cmp"
 	"fmt"
 	"hot-coffee/config"
 	"hot-coffee/models"
 	"os"
+	"slices"
+	"sync"
 )
 
 type MenuRepository interface {
 	AddItem(item *models.MenuItem) error
 	GetAllItems() ([]models.MenuItem, error)
 	SaveItems(items []models.MenuItem) error
+	QueryItems(query models.MenuQuery) ([]models.MenuItem, models.PageInfo, error)
 }
 
-type FileMenuRepository struct{}
+// FileMenuRepository keeps the menu in menu_items.json. Lock it around a change to the
+// menu so the version checked is still the one saved over.
+type FileMenuRepository struct {
+	sync.Mutex
+}
 
 func (r *FileMenuRepository) AddItem(item *models.MenuItem) error {
 	items, err := r.GetAllItems()
@@ -24,7 +31,7 @@ func (r *FileMenuRepository) AddItem(item *models.MenuItem) error {
 
 	for _, existingItem := range items {
 		if existingItem.ID == item.ID {
-			return fmt.Errorf("item with this ID %s already exists", item.ID)
+			return models.ConflictError("duplicate_id", fmt.Sprintf("item with this ID %s already exists", item.ID))
 		}
 	}
 	items = append(items, *item)
@@ -32,6 +39,7 @@ func (r *FileMenuRepository) AddItem(item *models.MenuItem) error {
 }
 
 func (r *FileMenuRepository) GetAllItems() ([]models.MenuItem, error) {
+	defer timeStorage("menu_items.json", "read")()
 	var items []models.MenuItem
 	file, err := os.Open(config.Directory + "/menu_items.json")
 	if err != nil {
@@ -42,22 +50,58 @@ func (r *FileMenuRepository) GetAllItems() ([]models.MenuItem, error) {
 	}
 	defer file.Close()
 
-	if err = json.NewDecoder(file).Decode(&items); err != nil {
+	if err = decodeDataFile(file, &items); err != nil {
 		return nil, err
 	}
+
+	// Items written before versioning count as version 1
+	for i := range items {
+		if items[i].Version == 0 {
+			items[i].Version = 1
+		}
+	}
 	return items, nil
 }
 
 func (r *FileMenuRepository) saveItems(items []models.MenuItem) error {
-	file, err := os.OpenFile(config.Directory+"/menu_items.json", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	return json.NewEncoder(file).Encode(items)
+	return writeJSONFile("menu_items.json", items, 0o644)
 }
 
 func (r *FileMenuRepository) SaveItems(items []models.MenuItem) error {
 	return r.saveItems(items)
 }
+
+var menuSortFields = map[string]func(a, b models.MenuItem) int{
+	"product_id": func(a, b models.MenuItem) int { return cmp.Compare(a.ID, b.ID) },
+	"name":       func(a, b models.MenuItem) int { return compareFold(a.Name, b.Name) },
+	"price":      func(a, b models.MenuItem) int { return cmp.Compare(a.Price, b.Price) },
+}
+
+// QueryItems returns one page of the menu items matching the query.
+func (r *FileMenuRepository) QueryItems(query models.MenuQuery) ([]models.MenuItem, models.PageInfo, error) {
+	items, err := r.GetAllItems()
+	if err != nil {
+		return nil, models.PageInfo{}, err
+	}
+
+	matching := []models.MenuItem{}
+	for _, item := range items {
+		if query.MinPrice != nil && item.Price < *query.MinPrice {
+			continue
+		}
+		if query.MaxPrice != nil && item.Price > *query.MaxPrice {
+			continue
+		}
+		if query.IngredientID != "" && !slices.ContainsFunc(item.Ingredients, func(ingredient models.MenuItemIngredient) bool {
+			return ingredient.IngredientID == query.IngredientID
+		}) {
+			continue
+		}
+		matching = append(matching, item)
+	}
+
+	if err := sortBy(matching, query.Sort, menuSortFields); err != nil {
+		return nil, models.PageInfo{}, err
+	}
+	return paginate(matching, query.Page)
+}
@@ -1,12 +1,15 @@
 package dal
 
 import (
-	"encoding/json"
-	"errors"
+	"cmp"
 	"fmt"
 	"hot-coffee/config"
 	"hot-coffee/models"
 	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 )
 
 type OrderRepository interface {
@@ -14,29 +17,27 @@ type OrderRepository interface {
 	GetAllOrders() ([]models.Order, error)
 	GetOrderByID(id string) (*models.Order, error)
 	UpdateOrder(order *models.Order) error
+	QueryOrders(query models.OrderQuery) ([]models.Order, models.PageInfo, error)
 }
 
-type FileOrderRepository struct{}
+// FileOrderRepository keeps the orders in orders.json. Its mutex is held by whichever
+// service is changing an order, from loading the orders to saving them.
+type FileOrderRepository struct {
+	sync.Mutex
+}
 
 func (repo *FileOrderRepository) SaveOrder(order *models.Order) error {
-	var orders []models.Order
-
-	file, err := os.OpenFile(config.Directory+"/orders.json", os.O_RDWR|os.O_CREATE, 0o644)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	if err = json.NewDecoder(file).Decode(&orders); err != nil && err != os.ErrNotExist {
+	orders, err := repo.GetAllOrders()
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
 	orders = append(orders, *order)
-	file.Seek(0, 0)
-	return json.NewEncoder(file).Encode(orders)
+	return writeJSONFile("orders.json", orders, 0o644)
 }
 
 func (r *FileOrderRepository) GetAllOrders() ([]models.Order, error) {
+	defer timeStorage("orders.json", "read")()
 	var orders []models.Order
 	file, err := os.Open(config.Directory + "/orders.json")
 	if err != nil {
@@ -44,10 +45,11 @@ func (r *FileOrderRepository) GetAllOrders() ([]models.Order, error) {
 	}
 	defer file.Close()
 
-	err = json.NewDecoder(file).Decode(&orders)
+	err = decodeDataFile(file, &orders)
 	if err != nil {
 		return nil, err
 	}
+	normalizeOrderVersions(orders)
 	return orders, nil
 }
 
@@ -62,7 +64,7 @@ func (r *FileOrderRepository) GetOrderByID(id string) (*models.Order, error) {
 			return &order, nil
 		}
 	}
-	return nil, errors.New("order not found")
+	return nil, models.ErrOrderNotFound
 }
 
 func (r *FileOrderRepository) UpdateOrder(order *models.Order) error {
@@ -81,6 +83,9 @@ func (r *FileOrderRepository) UpdateOrder(order *models.Order) error {
 	for i, o := range orders {
 		if o.ID == order.ID {
 			// Update only the specified fields
+			if order.CustomerID != "" {
+				orders[i].CustomerID = order.CustomerID
+			}
 			if order.CustomerName != "" {
 				orders[i].CustomerName = order.CustomerName
 			}
@@ -90,6 +95,7 @@ func (r *FileOrderRepository) UpdateOrder(order *models.Order) error {
 			if order.CreatedAt != "" { // Check if CreatedAt is set (not empty string)
 				orders[i].CreatedAt = order.CreatedAt
 			}
+			orders[i].Version = order.Version
 			updated = true
 			break
 		}
@@ -97,7 +103,7 @@ func (r *FileOrderRepository) UpdateOrder(order *models.Order) error {
 
 	// If no order found with the given ID, return an error
 	if !updated {
-		return fmt.Errorf("order not found")
+		return models.ErrOrderNotFound
 	}
 
 	// Save the updated list of orders back to the file, only modified orders
@@ -108,7 +114,7 @@ func (r *FileOrderRepository) UpdateOrder(order *models.Order) error {
 func (r *FileOrderRepository) CheckNonNegativeQuantities(order *models.Order) error {
 	for _, item := range order.Items {
 		if item.Quantity < 0 {
-			return fmt.Errorf("quantity for item %s is less than zero", item.ProductID)
+			return models.ValidationError("invalid_quantity", fmt.Sprintf("quantity for item %s is less than zero", item.ProductID))
 		}
 	}
 	return nil
@@ -117,6 +123,7 @@ func (r *FileOrderRepository) CheckNonNegativeQuantities(order *models.Order) er
 func (r *FileOrderRepository) LoadOrders() ([]models.Order, error) {
 	var orders []models.Order
 
+	defer timeStorage("orders.json", "read")()
 	file, err := os.Open(config.Directory + "/orders.json")
 	if err != nil {
 		// If the file does not exist, return an empty slice (this is valid)
@@ -127,23 +134,27 @@ func (r *FileOrderRepository) LoadOrders() ([]models.Order, error) {
 	}
 	defer file.Close()
 
-	err = json.NewDecoder(file).Decode(&orders)
+	err = decodeDataFile(file, &orders)
 	if err != nil {
 		return nil, err
 	}
+	normalizeOrderVersions(orders)
 
 	return orders, nil
 }
 
-func (r *FileOrderRepository) SaveOrders(orders []models.Order) error {
-	file, err := os.OpenFile(config.Directory+"/orders.json", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
-	if err != nil {
-		return err
+// normalizeOrderVersions counts orders written before versioning as version 1.
+func normalizeOrderVersions(orders []models.Order) {
+	for i := range orders {
+		if orders[i].Version == 0 {
+			orders[i].Version = 1
+		}
 	}
-	defer file.Close()
+}
 
+func (r *FileOrderRepository) SaveOrders(orders []models.Order) error {
 	// Write the updated orders to the file
-	return json.NewEncoder(file).Encode(orders)
+	return writeJSONFile("orders.json", orders, 0o644)
 }
 
 func (r *FileOrderRepository) DeleteOrder(orderID string) error {
@@ -162,15 +173,64 @@ func (r *FileOrderRepository) DeleteOrder(orderID string) error {
 
 	// Check if order was found
 	if len(orders) == len(updatedOrders) {
-		return errors.New("order not found")
+		return models.ErrOrderNotFound
 	}
 
 	// Write the updated orders back to file
-	file, err := os.OpenFile(config.Directory+"/orders.json", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	return writeJSONFile("orders.json", updatedOrders, 0o644)
+}
+
+var orderSortFields = map[string]func(a, b models.Order) int{
+	"created_at":    func(a, b models.Order) int { return cmp.Compare(a.CreatedAt, b.CreatedAt) },
+	"customer_name": func(a, b models.Order) int { return compareFold(a.CustomerName, b.CustomerName) },
+	"status":        func(a, b models.Order) int { return cmp.Compare(a.Status, b.Status) },
+	"total":         func(a, b models.Order) int { return cmp.Compare(a.Total, b.Total) },
+}
+
+// QueryOrders returns one page of the orders matching the query.
+func (r *FileOrderRepository) QueryOrders(query models.OrderQuery) ([]models.Order, models.PageInfo, error) {
+	var from, to time.Time
+	var err error
+	if query.From != "" {
+		if from, err = parseTimeBound(query.From, false); err != nil {
+			return nil, models.PageInfo{}, err
+		}
+	}
+	if query.To != "" {
+		if to, err = parseTimeBound(query.To, true); err != nil {
+			return nil, models.PageInfo{}, err
+		}
+	}
+
+	orders, err := r.LoadOrders()
 	if err != nil {
-		return err
+		return nil, models.PageInfo{}, err
 	}
-	defer file.Close()
 
-	return json.NewEncoder(file).Encode(updatedOrders)
+	matching := []models.Order{}
+	for _, order := range orders {
+		if query.Status != "" && order.Status != query.Status {
+			continue
+		}
+		if query.Customer != "" && order.CustomerID != query.Customer && !strings.EqualFold(order.CustomerName, query.Customer) {
+			continue
+		}
+		if query.ProductID != "" && !slices.ContainsFunc(order.Items, func(item models.OrderItem) bool {
+			return item.ProductID == query.ProductID
+		}) {
+			continue
+		}
+		if !from.IsZero() || !to.IsZero() {
+			createdAt, err := time.Parse(time.RFC3339, order.CreatedAt)
+			if err != nil || (!from.IsZero() && createdAt.Before(from)) || (!to.IsZero() && createdAt.After(to)) {
+				continue
+			}
+		}
+		matching = append(matching, order)
+	}
+
+	if err := sortBy(matching, query.Sort, orderSortFields); err != nil {
+		return nil, models.PageInfo{}, err
+	}
+	return paginate(matching, query.Page)
 }
@@ -0,0 +1,80 @@
+package dal
+
+import (
+	"encoding/base64"
+	"fmt"
+	"hot-coffee/models"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// paginate cuts one page out of items, which must already be filtered and sorted.
+// Cursors are opaque to clients; for the file store they encode an offset.
+func paginate[T any](items []T, page models.Page) ([]T, models.PageInfo, error) {
+	limit := page.Limit
+	if limit <= 0 {
+		limit = models.DefaultPageLimit
+	}
+	limit = min(limit, models.MaxPageLimit)
+
+	offset := 0
+	if page.Cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(page.Cursor)
+		if err == nil {
+			offset, err = strconv.Atoi(string(decoded))
+		}
+		if err != nil || offset < 0 {
+			return nil, models.PageInfo{}, fmt.Errorf("%w: malformed cursor", models.ErrInvalidQuery)
+		}
+	}
+	offset = min(offset, len(items))
+	end := min(offset+limit, len(items))
+
+	info := models.PageInfo{Limit: limit, Total: len(items)}
+	if end < len(items) {
+		info.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	}
+	return append([]T{}, items[offset:end]...), info, nil
+}
+
+// sortBy sorts items with the comparison registered for the requested field, keeping
+// the stored order between equal items.
+func sortBy[T any](items []T, sort models.Sort, fields map[string]func(a, b T) int) error {
+	if sort.Field == "" {
+		return nil
+	}
+	compare, ok := fields[sort.Field]
+	if !ok {
+		return fmt.Errorf("%w: cannot sort by %s", models.ErrInvalidQuery, sort.Field)
+	}
+	slices.SortStableFunc(items, func(a, b T) int {
+		if sort.Desc {
+			return compare(b, a)
+		}
+		return compare(a, b)
+	})
+	return nil
+}
+
+// compareFold compares strings ignoring case.
+func compareFold(a, b string) int {
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// parseTimeBound reads a date (2006-01-02) or RFC 3339 time. A date used as an upper
+// bound covers the whole day.
+func parseTimeBound(value string, upper bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %q is not a date or RFC 3339 time", models.ErrInvalidQuery, value)
+	}
+	if upper {
+		return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+	return day, nil
+}
@@ -0,0 +1,65 @@
+package dal
+
+import (
+	"hot-coffee/config"
+	"hot-coffee/models"
+	"os"
+	"sync"
+)
+
+type RefundRepository interface {
+	SaveRefund(refund *models.Refund) error
+	GetAllRefunds() ([]models.Refund, error)
+	GetRefundsByOrderID(orderID string) ([]models.Refund, error)
+}
+
+// FileRefundRepository keeps the refunds in refunds.json. Its mutex is held while a refund
+// is checked against the earlier refunds of its order and saved.
+type FileRefundRepository struct {
+	sync.Mutex
+}
+
+// SaveRefund appends a refund record to refunds.json. Refunds are never updated or removed.
+func (r *FileRefundRepository) SaveRefund(refund *models.Refund) error {
+	refunds, err := r.GetAllRefunds()
+	if err != nil {
+		return err
+	}
+
+	refunds = append(refunds, *refund)
+	return writeJSONFile("refunds.json", refunds, 0o644)
+}
+
+func (r *FileRefundRepository) GetAllRefunds() ([]models.Refund, error) {
+	defer timeStorage("refunds.json", "read")()
+	var refunds []models.Refund
+	file, err := os.Open(config.Directory + "/refunds.json")
+	if err != nil {
+		// No refunds have been issued yet
+		if os.IsNotExist(err) {
+			return refunds, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	if err = decodeDataFile(file, &refunds); err != nil {
+		return nil, err
+	}
+	return refunds, nil
+}
+
+func (r *FileRefundRepository) GetRefundsByOrderID(orderID string) ([]models.Refund, error) {
+	refunds, err := r.GetAllRefunds()
+	if err != nil {
+		return nil, err
+	}
+
+	var orderRefunds []models.Refund
+	for _, refund := range refunds {
+		if refund.OrderID == orderID {
+			orderRefunds = append(orderRefunds, refund)
+		}
+	}
+	return orderRefunds, nil
+}
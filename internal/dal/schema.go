@@ -0,0 +1,178 @@
+package dal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hot-coffee/config"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ErrNewerSchema is returned for data files written by a newer version of hot-coffee,
+// which this one must not read or overwrite.
+var ErrNewerSchema = errors.New("written by a newer version of hot-coffee")
+
+// migration upgrades the collection files from version-1 to version.
+type migration struct {
+	version     int
+	description string
+	// upgrade changes the items of one file, named by file. It is nil when the version
+	// only changed the envelope.
+	upgrade func(file string, items []json.RawMessage) ([]json.RawMessage, error)
+}
+
+// migrations are applied in order to every file older than their version. A change to a
+// model that existing items must follow, such as a new field of models.Order that needs a
+// value, gets a migration appended here whose upgrade fills it in.
+var migrations = []migration{
+	{version: 2, description: "wrap each collection file in a {schema_version, items} envelope"},
+}
+
+// SchemaVersion is the version of the collection files this code reads and writes: that
+// of the last migration. Files from before version 2 hold a bare array.
+var SchemaVersion = migrations[len(migrations)-1].version
+
+// envelope is the layout of a collection file from version 2 on.
+type envelope struct {
+	SchemaVersion int `json:"schema_version"`
+	Items         any `json:"items"`
+}
+
+// CreateDataFiles writes the collection files of a new data directory, each holding no
+// items in an envelope of the current schema version. It is what config.ValidateDirectory
+// runs when it creates the directory.
+func CreateDataFiles() error {
+	for _, name := range config.DataFiles {
+		if err := writeJSONFile(name, []any{}, filePerm(name)); err != nil {
+			return fmt.Errorf("failed to create file %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// isVersioned reports whether a data file is a collection kept in an envelope. The
+// loyalty settings are a single object and the audit log is appended to line by line,
+// so neither is.
+func isVersioned(name string) bool {
+	return slices.Contains(config.DataFiles, name) || slices.Contains(credentialFiles, name)
+}
+
+// readItems returns the items of a collection file upgraded to SchemaVersion, and the
+// version the file was written at.
+func readItems(name string, data []byte) (json.RawMessage, int, error) {
+	version, items := 1, json.RawMessage(bytes.TrimSpace(data))
+	if !bytes.HasPrefix(items, []byte("[")) {
+		var stored struct {
+			SchemaVersion int             `json:"schema_version"`
+			Items         json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return nil, 0, err
+		}
+		if stored.SchemaVersion < 2 || stored.Items == nil {
+			return nil, 0, fmt.Errorf("%s holds neither an array nor a schema_version and items", name)
+		}
+		version, items = stored.SchemaVersion, stored.Items
+	}
+	if version > SchemaVersion {
+		return nil, version, fmt.Errorf("%s has schema version %d, this version of hot-coffee reads up to %d: %w", name, version, SchemaVersion, ErrNewerSchema)
+	}
+
+	for _, m := range migrations {
+		if m.version <= version || m.upgrade == nil {
+			continue
+		}
+		var list []json.RawMessage
+		if err := json.Unmarshal(items, &list); err != nil {
+			return nil, version, err
+		}
+		list, err := m.upgrade(name, list)
+		if err != nil {
+			return nil, version, fmt.Errorf("upgrading %s to schema version %d: %w", name, m.version, err)
+		}
+		if items, err = json.Marshal(list); err != nil {
+			return nil, version, err
+		}
+	}
+	return items, version, nil
+}
+
+// decodeDataFile decodes a data file opened by a repository into v. Collection files are
+// taken out of their envelope, and files the startup migration has not upgraded yet,
+// e.g. one restored by hand, are upgraded in memory first.
+func decodeDataFile(file *os.File, v any) error {
+	name := filepath.Base(file.Name())
+	if !isVersioned(name) {
+		return json.NewDecoder(file).Decode(v)
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	items, _, err := readItems(name, data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(items, v)
+}
+
+// Migrate upgrades the collection files older than SchemaVersion. Before it changes a
+// file holding any items it copies the data directory to a backup next to it, like fsck
+// --repair. It returns the files upgraded and the backup, "" when none was needed. Files
+// from a newer version make it fail with ErrNewerSchema before anything is changed;
+// files that do not decode are left for fsck and /readyz to report.
+func Migrate() ([]string, string, error) {
+	type pending struct {
+		name  string
+		items json.RawMessage
+	}
+	var upgrades []pending
+	needsBackup := false
+	for _, name := range knownFiles() {
+		if !isVersioned(name) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(config.Directory, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		items, version, err := readItems(name, data)
+		if errors.Is(err, ErrNewerSchema) {
+			return nil, "", err
+		}
+		if err != nil || version == SchemaVersion {
+			continue
+		}
+		upgrades = append(upgrades, pending{name: name, items: items})
+		var list []json.RawMessage
+		if json.Unmarshal(items, &list) != nil || len(list) > 0 {
+			needsBackup = true
+		}
+	}
+	if len(upgrades) == 0 {
+		return nil, "", nil
+	}
+
+	backup := ""
+	if needsBackup {
+		var err error
+		if backup, err = backupDirectory(config.Directory); err != nil {
+			return nil, "", fmt.Errorf("backing up before upgrading the data files: %w", err)
+		}
+	}
+	var upgraded []string
+	for _, upgrade := range upgrades {
+		if err := writeJSONFile(upgrade.name, upgrade.items, filePerm(upgrade.name)); err != nil {
+			return upgraded, backup, fmt.Errorf("upgrading %s: %w", upgrade.name, err)
+		}
+		upgraded = append(upgraded, upgrade.name)
+	}
+	return upgraded, backup, nil
+}
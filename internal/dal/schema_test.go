@@ -0,0 +1,52 @@
+package dal
+
+import (
+	"encoding/json"
+	"hot-coffee/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewDataDirectoryIsAtCurrentSchema(t *testing.T) {
+	previous := config.Directory
+	config.Directory = filepath.Join(t.TempDir(), "data")
+	t.Cleanup(func() { config.Directory = previous })
+	if err := config.ValidateDirectory(CreateDataFiles); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range config.DataFiles {
+		path := filepath.Join(config.Directory, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stored struct {
+			SchemaVersion int               `json:"schema_version"`
+			Items         []json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(data, &stored); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if stored.SchemaVersion != SchemaVersion || stored.Items == nil || len(stored.Items) != 0 {
+			t.Errorf("%s = %s, want an empty envelope at schema version %d", name, data, SchemaVersion)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != filePerm(name) {
+			t.Errorf("%s has mode %v, want %v", name, info.Mode().Perm(), filePerm(name))
+		}
+	}
+
+	report, err := Fsck(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 0 {
+		t.Errorf("fsck of a new data directory found %+v", report.Issues)
+	}
+}
@@ -0,0 +1,41 @@
+package dal
+
+import (
+	"hot-coffee/config"
+	"hot-coffee/models"
+	"os"
+	"sync"
+)
+
+type ShiftRepository interface {
+	GetAllShifts() ([]models.Shift, error)
+	SaveShifts(shifts []models.Shift) error
+}
+
+// FileShiftRepository keeps the shifts in shifts.json. Its mutex is held while a shift is
+// opened or closed, so there is never more than one open shift.
+type FileShiftRepository struct {
+	sync.Mutex
+}
+
+func (r *FileShiftRepository) GetAllShifts() ([]models.Shift, error) {
+	defer timeStorage("shifts.json", "read")()
+	var shifts []models.Shift
+	file, err := os.Open(config.Directory + "/shifts.json")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return shifts, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	if err = decodeDataFile(file, &shifts); err != nil {
+		return nil, err
+	}
+	return shifts, nil
+}
+
+func (r *FileShiftRepository) SaveShifts(shifts []models.Shift) error {
+	return writeJSONFile("shifts.json", shifts, 0o644)
+}
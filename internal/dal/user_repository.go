@@ -0,0 +1,90 @@
+package dal
+
+import (
+	"fmt"
+	"hot-coffee/config"
+	"hot-coffee/models"
+	"os"
+)
+
+type UserRepository interface {
+	AddUser(user *models.User) error
+	GetAllUsers() ([]models.User, error)
+	SaveUsers(users []models.User) error
+	GetAllAPIKeys() ([]models.APIKey, error)
+	SaveAPIKeys(keys []models.APIKey) error
+	GetAllSessions() ([]models.Session, error)
+	SaveSessions(sessions []models.Session) error
+}
+
+// FileUserRepository stores users, API keys and sessions. The files hold password and
+// key hashes, so only the server's own account may read them.
+type FileUserRepository struct{}
+
+func (r *FileUserRepository) AddUser(user *models.User) error {
+	users, err := r.GetAllUsers()
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range users {
+		if existing.ID == user.ID {
+			return models.ConflictError("duplicate_id", fmt.Sprintf("user with ID %s already exists", user.ID))
+		}
+	}
+	return r.SaveUsers(append(users, *user))
+}
+
+func (r *FileUserRepository) GetAllUsers() ([]models.User, error) {
+	var users []models.User
+	if err := readCredentialFile("users.json", &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *FileUserRepository) SaveUsers(users []models.User) error {
+	return writeCredentialFile("users.json", users)
+}
+
+func (r *FileUserRepository) GetAllAPIKeys() ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := readCredentialFile("api_keys.json", &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *FileUserRepository) SaveAPIKeys(keys []models.APIKey) error {
+	return writeCredentialFile("api_keys.json", keys)
+}
+
+func (r *FileUserRepository) GetAllSessions() ([]models.Session, error) {
+	var sessions []models.Session
+	if err := readCredentialFile("sessions.json", &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *FileUserRepository) SaveSessions(sessions []models.Session) error {
+	return writeCredentialFile("sessions.json", sessions)
+}
+
+func readCredentialFile(name string, v any) error {
+	defer timeStorage(name, "read")()
+	file, err := os.Open(config.Directory + "/" + name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	return decodeDataFile(file, v)
+}
+
+func writeCredentialFile(name string, v any) error {
+	return writeJSONFile(name, v, 0o600)
+}
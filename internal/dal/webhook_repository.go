@@ -0,0 +1,95 @@
+package dal
+
+import (
+	"fmt"
+	"hot-coffee/config"
+	"hot-coffee/models"
+	"os"
+	"sync"
+)
+
+// maxWebhookDeliveries bounds the delivery log; the oldest attempts are dropped first.
+const maxWebhookDeliveries = 1000
+
+type WebhookRepository interface {
+	AddWebhook(webhook *models.Webhook) error
+	GetAllWebhooks() ([]models.Webhook, error)
+	SaveWebhooks(webhooks []models.Webhook) error
+	AddDelivery(delivery *models.WebhookDelivery) error
+	GetAllDeliveries() ([]models.WebhookDelivery, error)
+}
+
+type FileWebhookRepository struct {
+	// deliveries are recorded from several goroutines at once
+	deliveryMu sync.Mutex
+}
+
+func (r *FileWebhookRepository) AddWebhook(webhook *models.Webhook) error {
+	webhooks, err := r.GetAllWebhooks()
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range webhooks {
+		if existing.ID == webhook.ID {
+			return models.ConflictError("duplicate_id", fmt.Sprintf("webhook with ID %s already exists", webhook.ID))
+		}
+	}
+	return r.SaveWebhooks(append(webhooks, *webhook))
+}
+
+func (r *FileWebhookRepository) GetAllWebhooks() ([]models.Webhook, error) {
+	defer timeStorage("webhooks.json", "read")()
+	var webhooks []models.Webhook
+	file, err := os.Open(config.Directory + "/webhooks.json")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return webhooks, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	if err = decodeDataFile(file, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (r *FileWebhookRepository) SaveWebhooks(webhooks []models.Webhook) error {
+	return writeJSONFile("webhooks.json", webhooks, filePerm("webhooks.json"))
+}
+
+func (r *FileWebhookRepository) AddDelivery(delivery *models.WebhookDelivery) error {
+	r.deliveryMu.Lock()
+	defer r.deliveryMu.Unlock()
+
+	deliveries, err := r.GetAllDeliveries()
+	if err != nil {
+		return err
+	}
+	deliveries = append(deliveries, *delivery)
+	if len(deliveries) > maxWebhookDeliveries {
+		deliveries = deliveries[len(deliveries)-maxWebhookDeliveries:]
+	}
+
+	return writeJSONFile("webhook_deliveries.json", deliveries, 0o644)
+}
+
+func (r *FileWebhookRepository) GetAllDeliveries() ([]models.WebhookDelivery, error) {
+	defer timeStorage("webhook_deliveries.json", "read")()
+	var deliveries []models.WebhookDelivery
+	file, err := os.Open(config.Directory + "/webhook_deliveries.json")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return deliveries, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	if err = decodeDataFile(file, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,71 @@
+package dal
+
+import (
+	"fmt"
+	"hot-coffee/config"
+	"hot-coffee/models"
+	"os"
+	"sync"
+)
+
+type ZReportRepository interface {
+	SaveZReport(report *models.ZReport) error
+	GetAllZReports() ([]models.ZReport, error)
+	GetZReportsByDate(date string) ([]models.ZReport, error)
+}
+
+// FileZReportRepository keeps the Z reports in z_reports.json. Its mutex is held from
+// checking that a shift has no report yet to saving the report.
+type FileZReportRepository struct {
+	sync.Mutex
+}
+
+// SaveZReport appends a report to z_reports.json. Existing reports are never rewritten.
+func (r *FileZReportRepository) SaveZReport(report *models.ZReport) error {
+	reports, err := r.GetAllZReports()
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range reports {
+		if existing.ID == report.ID {
+			return fmt.Errorf("z report %s already exists", report.ID)
+		}
+	}
+
+	reports = append(reports, *report)
+	return writeJSONFile("z_reports.json", reports, 0o644)
+}
+
+func (r *FileZReportRepository) GetAllZReports() ([]models.ZReport, error) {
+	defer timeStorage("z_reports.json", "read")()
+	var reports []models.ZReport
+	file, err := os.Open(config.Directory + "/z_reports.json")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return reports, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	if err = decodeDataFile(file, &reports); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+func (r *FileZReportRepository) GetZReportsByDate(date string) ([]models.ZReport, error) {
+	reports, err := r.GetAllZReports()
+	if err != nil {
+		return nil, err
+	}
+
+	var dayReports []models.ZReport
+	for _, report := range reports {
+		if report.Date == date {
+			dayReports = append(dayReports, report)
+		}
+	}
+	return dayReports, nil
+}
@@ -0,0 +1,162 @@
+package events
+
+import (
+	"hot-coffee/internal/metrics"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types published by the services.
+const (
+	OrderCreated       = "order.created"
+	OrderUpdated       = "order.updated"
+	OrderStatusChanged = "order.status_changed"
+	OrderClosed        = "order.closed"
+	OrderDeleted       = "order.deleted"
+	StockChanged       = "inventory.stock_changed"
+	LowStock           = "inventory.low_stock"
+)
+
+// Types lists every event type the services publish.
+var Types = []string{
+	OrderCreated,
+	OrderUpdated,
+	OrderStatusChanged,
+	OrderClosed,
+	OrderDeleted,
+	StockChanged,
+	LowStock,
+}
+
+var dropped = metrics.Default.NewCounter("hotcoffee_events_dropped_total",
+	"Events a subscriber missed because it was not keeping up, by event type.", "type")
+
+type Event struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+	Time string `json:"time"`
+	Data any    `json:"data"`
+}
+
+// Bus is an in-process publish/subscribe hub. It keeps the most recent events in a
+// bounded buffer so subscribers that reconnect can catch up on what they missed.
+// A nil *Bus is valid and drops everything published to it.
+type Bus struct {
+	mu          sync.Mutex
+	nextID      int64
+	buffer      []Event
+	capacity    int
+	subscribers map[int]chan Event
+	nextSub     int
+	closed      bool
+}
+
+func NewBus(capacity int) *Bus {
+	return &Bus{
+		capacity:    capacity,
+		subscribers: make(map[int]chan Event),
+	}
+}
+
+// Publish records an event and hands it to every subscriber. Subscribers that are not
+// keeping up miss the event rather than blocking the publisher; each miss is logged.
+func (b *Bus) Publish(eventType string, data any) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	event := Event{
+		ID:   b.nextID,
+		Type: eventType,
+		Time: time.Now().Format(time.RFC3339Nano),
+		Data: data,
+	}
+	b.buffer = append(b.buffer, event)
+	if len(b.buffer) > b.capacity {
+		b.buffer = b.buffer[len(b.buffer)-b.capacity:]
+	}
+
+	for id, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			dropped.Inc(event.Type)
+			slog.Warn("Event dropped for a subscriber that is not keeping up", slog.Int("subscriber", id),
+				slog.Int64("eventID", event.ID), slog.String("type", event.Type))
+		}
+	}
+}
+
+// Subscribe registers a new subscriber and returns the buffered events published after
+// lastID (none when lastID is 0), the channel for new events and a function to unsubscribe.
+func (b *Bus) Subscribe(lastID int64) ([]Event, <-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var replay []Event
+	if lastID > 0 {
+		for _, event := range b.buffer {
+			if event.ID > lastID {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	ch := make(chan Event, 64)
+	if b.closed {
+		close(ch)
+		return replay, ch, func() {}
+	}
+	id := b.nextSub
+	b.nextSub++
+	b.subscribers[id] = ch
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[id]; ok {
+			delete(b.subscribers, id)
+			close(ch)
+		}
+	}
+	return replay, ch, unsubscribe
+}
+
+// Close ends every subscription by closing its channel, so event streams and other
+// subscribers finish when the server stops. Later subscriptions start out closed;
+// events published after Close are still buffered.
+func (b *Bus) Close() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for id, ch := range b.subscribers {
+		delete(b.subscribers, id)
+		close(ch)
+	}
+}
+
+// Matches reports whether eventType is selected by filters. An empty filter list selects
+// everything; a filter ending in ".*" selects a whole family such as "order.*".
+func Matches(filters []string, eventType string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, filter := range filters {
+		if filter == eventType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(filter, "*"); ok && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
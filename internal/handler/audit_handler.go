@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"hot-coffee/internal/service"
+	"hot-coffee/models"
+	"log/slog"
+	"net/http"
+)
+
+type AuditHandler struct {
+	service *service.AuditService
+}
+
+func NewAuditHandler(service *service.AuditService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+// RegisterRoutes adds the audit log routes to mux.
+func (h *AuditHandler) RegisterRoutes(mux Mux) {
+	mux.HandleFunc("GET /audit", h.GetEntries)
+	mux.HandleFunc("GET /audit/verify", h.Verify)
+}
+
+// GetEntries lists audit entries, oldest first, filtered by entity_type, entity_id, actor,
+// action and a from/to time range.
+func (h *AuditHandler) GetEntries(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := models.AuditQuery{
+		EntityType: params.Get("entity_type"),
+		EntityID:   params.Get("entity_id"),
+		Actor:      params.Get("actor"),
+		Action:     params.Get("action"),
+		From:       params.Get("from"),
+		To:         params.Get("to"),
+		Sort:       parseSort(r),
+	}
+	page, err := parsePage(r)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	query.Page = page
+
+	entries, err := h.service.QueryEntries(query)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving audit entries", slog.Any("error", err))
+		respondWithServiceError(w, err)
+		return
+	}
+	respondWithJSON(w, entries, http.StatusOK)
+}
+
+// Verify checks the hash chain of the whole audit log.
+func (h *AuditHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	result, err := h.service.Verify()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error verifying audit log", slog.Any("error", err))
+		respondWithServiceError(w, err)
+		return
+	}
+	if !result.Valid {
+		slog.WarnContext(r.Context(), "Audit log failed verification", slog.Int64("seq", result.BadSeq), slog.String("problem", result.Problem))
+	}
+	respondWithJSON(w, result, http.StatusOK)
+}
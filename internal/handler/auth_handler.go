@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"encoding/json"
+	"hot-coffee/internal/service"
+	"hot-coffee/models"
+	"log/slog"
+	"net/http"
+)
+
+type AuthHandler struct {
+	service *service.AuthService
+}
+
+func NewAuthHandler(service *service.AuthService) *AuthHandler {
+	return &AuthHandler{service: service}
+}
+
+// RegisterRoutes adds the sign-in, API key and user management routes to mux.
+func (h *AuthHandler) RegisterRoutes(mux Mux) {
+	mux.HandleFunc("POST /auth/login", h.Login)
+	mux.HandleFunc("POST /auth/logout", h.Logout)
+	mux.HandleFunc("GET /auth/me", h.GetCurrentUser)
+	mux.HandleFunc("POST /auth/api-keys", h.AddAPIKey)
+	mux.HandleFunc("GET /auth/api-keys", h.GetAPIKeys)
+	mux.HandleFunc("DELETE /auth/api-keys/{id}", h.DeleteAPIKey)
+	mux.HandleFunc("POST /users", h.AddUser)
+	mux.HandleFunc("GET /users", h.GetAllUsers)
+	mux.HandleFunc("GET /users/{id}", h.GetUser)
+	mux.HandleFunc("PUT /users/{id}", h.UpdateUser)
+	mux.HandleFunc("DELETE /users/{id}", h.DeleteUser)
+}
+
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var credentials models.Credentials
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		respondWithError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.Login(credentials)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed sign-in", slog.String("username", credentials.Username), slog.Any("error", err))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "User signed in", slog.String("userID", result.User.ID))
+	result.User.PasswordHash = ""
+	// The token must not be cached, nor stored for Idempotency-Key retries
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, result, http.StatusOK)
+}
+
+// Logout ends the session of the bearer token the request was made with.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.Logout(requestToken(r)); err != nil {
+		slog.ErrorContext(r.Context(), "Error signing out", slog.Any("error", err))
+		respondWithServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user := *currentUser(r)
+	user.PasswordHash = ""
+	respondWithJSON(w, user, http.StatusOK)
+}
+
+// AddAPIKey creates an API key for the signed-in user. The key itself is only in this response.
+func (h *AuthHandler) AddAPIKey(w http.ResponseWriter, r *http.Request) {
+	var request models.APIKey
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondWithError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	user := currentUser(r)
+	key, err := h.service.AddAPIKey(user.ID, request.Name)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error adding API key", slog.String("userID", user.ID), slog.Any("error", err))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "API key added", slog.String("userID", user.ID), slog.String("keyID", key.ID))
+	key.Hash = ""
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, key, http.StatusCreated)
+}
+
+func (h *AuthHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.service.GetAPIKeys(currentUser(r).ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving API keys", slog.Any("error", err))
+		respondWithServiceError(w, err)
+		return
+	}
+	for i := range keys {
+		keys[i].Hash = ""
+	}
+	respondWithJSON(w, keys, http.StatusOK)
+}
+
+func (h *AuthHandler) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	id := r.PathValue("id")
+	if err := h.service.DeleteAPIKey(user.ID, id); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting API key", slog.String("keyID", id), slog.Any("error", err))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "API key deleted", slog.String("userID", user.ID), slog.String("keyID", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AuthHandler) AddUser(w http.ResponseWriter, r *http.Request) {
+	var user models.User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		respondWithError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.AddUser(&user); err != nil {
+		slog.ErrorContext(r.Context(), "Error adding user", slog.Any("error", err))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "User added", slog.String("userID", user.ID), slog.String("role", user.Role))
+	user.PasswordHash = ""
+	respondWithJSON(w, user, http.StatusCreated)
+}
+
+func (h *AuthHandler) GetAllUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.service.GetAllUsers()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving users", slog.Any("error", err))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	redacted := []models.User{}
+	for _, user := range users {
+		user.PasswordHash = ""
+		redacted = append(redacted, user)
+	}
+	respondWithJSON(w, redacted, http.StatusOK)
+}
+
+func (h *AuthHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.service.GetUserByID(r.PathValue("id"))
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	user.PasswordHash = ""
+	respondWithJSON(w, user, http.StatusOK)
+}
+
+// UpdateUser changes a user's role and, when a password is given, resets it.
+func (h *AuthHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	var user models.User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		respondWithError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	user.ID = r.PathValue("id")
+	if err := h.service.UpdateUser(&user); err != nil {
+		slog.ErrorContext(r.Context(), "Error updating user", slog.String("userID", user.ID), slog.Any("error", err))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "User updated", slog.String("userID", user.ID), slog.String("role", user.Role))
+	user.PasswordHash = ""
+	respondWithJSON(w, user, http.StatusOK)
+}
+
+func (h *AuthHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := h.service.DeleteUser(id); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting user", slog.String("userID", id), slog.Any("error", err))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "User deleted", slog.String("userID", id))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"hot-coffee/models"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// roleChecker runs requests through Authenticate, in front of a handler that only reports
+// that it was reached, signed in as a user of each role.
+type roleChecker struct {
+	router  *Router
+	handler http.Handler
+	tokens  map[string]string
+}
+
+func newRoleChecker(t *testing.T) *roleChecker {
+	t.Helper()
+	server := newTestServer(t)
+	reached := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	checker := &roleChecker{router: server.router, handler: Authenticate(server.auth, server.router, reached), tokens: make(map[string]string)}
+	for _, role := range []string{models.RoleCashier, models.RoleBarista, models.RoleManager, models.RoleAdmin} {
+		user := &models.User{Username: role + "-user", Password: "correct-horse", Role: role}
+		if err := server.auth.AddUser(user); err != nil {
+			t.Fatal(err)
+		}
+		login, err := server.auth.Login(models.Credentials{Username: user.Username, Password: "correct-horse"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checker.tokens[role] = login.Token
+	}
+	return checker
+}
+
+// allowed reports whether a user of role gets through to the handler of pattern.
+func (c *roleChecker) allowed(t *testing.T, role, pattern string) bool {
+	t.Helper()
+	method, path, _ := strings.Cut(pattern, " ")
+	req := httptest.NewRequest(method, samplePath(path), nil)
+	req.Header.Set("Authorization", "Bearer "+c.tokens[role])
+	rec := httptest.NewRecorder()
+	c.handler.ServeHTTP(rec, req)
+	switch rec.Code {
+	case http.StatusTeapot:
+		return true
+	case http.StatusForbidden:
+		return false
+	}
+	t.Fatalf("%s as %s: status %d", pattern, role, rec.Code)
+	return false
+}
+
+func TestRolesOnRoutes(t *testing.T) {
+	checker := newRoleChecker(t)
+	tests := []struct {
+		route                     string
+		cashier, barista, manager bool
+	}{
+		{"GET /orders", true, true, true},
+		{"POST /orders", true, false, true},
+		{"POST /orders/{id}/close", true, false, true},
+		{"DELETE /orders/{id}", false, false, true},
+		{"POST /orders/{id}/refunds", false, false, true},
+		{"PUT /inventory/{id}", false, true, true},
+		{"POST /queue/{id}/lines/{line}/done", false, true, true},
+		{"GET /customers", true, false, true},
+		{"PUT /loyalty/settings", false, false, true},
+		{"GET /reports/z/{date}", false, false, true},
+		{"GET /metrics", false, false, true},
+		// Routes missing from routePermissions are for admins only
+		{"GET /users", false, false, false},
+		{"POST /webhooks", false, false, false},
+		{"POST /admin/backup", false, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.route, func(t *testing.T) {
+			want := map[string]bool{
+				models.RoleCashier: test.cashier,
+				models.RoleBarista: test.barista,
+				models.RoleManager: test.manager,
+				models.RoleAdmin:   true,
+			}
+			for role, want := range want {
+				if got := checker.allowed(t, role, test.route); got != want {
+					t.Errorf("%s allowed = %v, want %v", role, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUnlistedRoutesAreForAdminsOnly(t *testing.T) {
+	checker := newRoleChecker(t)
+	for _, pattern := range checker.router.Patterns() {
+		if publicRoutes[pattern] || routePermissions[pattern] != nil {
+			continue
+		}
+		for role := range checker.tokens {
+			if got, want := checker.allowed(t, role, pattern), role == models.RoleAdmin; got != want {
+				t.Errorf("%s: %s allowed = %v, want %v", pattern, role, got, want)
+			}
+		}
+	}
+}
+
+func TestPermissionTablesNameRegisteredRoutes(t *testing.T) {
+	patterns := newTestServer(t).router.Patterns()
+	for pattern := range routePermissions {
+		if !slices.Contains(patterns, pattern) {
+			t.Errorf("routePermissions lists %s, which is not a route", pattern)
+		}
+	}
+	for pattern := range publicRoutes {
+		if !slices.Contains(patterns, pattern) {
+			t.Errorf("publicRoutes lists %s, which is not a route", pattern)
+		}
+	}
+}
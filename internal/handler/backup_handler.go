@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"hot-coffee/internal/service"
+	"net/http"
+)
+
+// BackupHandler lets an admin take a backup of the data directory on demand.
+type BackupHandler struct {
+	service *service.BackupService
+}
+
+func NewBackupHandler(service *service.BackupService) *BackupHandler {
+	return &BackupHandler{service: service}
+}
+
+// RegisterRoutes adds the backup route to mux.
+func (h *BackupHandler) RegisterRoutes(mux Mux) {
+	mux.HandleFunc("POST /admin/backup", h.CreateBackup)
+}
+
+// CreateBackup writes an archive to the backup directory and answers with its name and
+// manifest. Requests changing data wait while the snapshot is read.
+func (h *BackupHandler) CreateBackup(w http.ResponseWriter, r *http.Request) {
+	backup, err := h.service.CreateBackup(r.Context())
+	if err != nil {
+		respondWithError(w, "Failed to take backup", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, backup, http.StatusCreated)
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"encoding/json"
+	"hot-coffee/internal/service"
+	"hot-coffee/models"
+	"log/slog"
+	"net/http"
+)
+
+type CustomerHandler struct {
+	service *service.CustomerService
+}
+
+func NewCustomerHandler(service *service.CustomerService) *CustomerHandler {
+	return &CustomerHandler{service: service}
+}
+
+// RegisterRoutes adds the customer routes to mux.
+func (h *CustomerHandler) RegisterRoutes(mux Mux) {
+	mux.HandleFunc("POST /customers", h.AddCustomer)
+	mux.HandleFunc("GET /customers", h.GetAllCustomers)
+	mux.HandleFunc("GET /customers/{id}", h.GetCustomer)
+	mux.HandleFunc("PUT /customers/{id}", h.UpdateCustomer)
+	mux.HandleFunc("DELETE /customers/{id}", h.DeleteCustomer)
+	mux.HandleFunc("GET /customers/{id}/orders", h.GetCustomerOrders)
+	mux.HandleFunc("GET /customers/{id}/stats", h.GetCustomerStats)
+}
+
+func (h *CustomerHandler) AddCustomer(w http.ResponseWriter, r *http.Request) {
+	var customer models.Customer
+	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
+		slog.ErrorContext(r.Context(), "Error decoding request body", slog.Any("error", err))
+		respondWithError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.AddCustomer(&customer); err != nil {
+		slog.ErrorContext(r.Context(), "Error adding customer", slog.Any("error", err))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Customer added", slog.String("customerID", customer.ID))
+	respondWithJSON(w, customer, http.StatusCreated)
+}
+
+func (h *CustomerHandler) GetAllCustomers(w http.ResponseWriter, r *http.Request) {
+	customers, err := h.service.GetAllCustomers()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving customers", slog.Any("error", err))
+		respondWithError(w, "Failed to retrieve customers", http.StatusInternalServerError)
+		return
+	}
+	if customers == nil {
+		customers = []models.Customer{}
+	}
+
+	slog.InfoContext(r.Context(), "Retrieved all customers", slog.Int("count", len(customers)))
+	respondWithJSON(w, customers, http.StatusOK)
+}
+
+func (h *CustomerHandler) GetCustomer(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	customer, err := h.service.GetCustomerByID(id)
+	if err != nil {
+		respondWithCustomerError(w, id, err)
+		return
+	}
+	respondWithJSON(w, customer, http.StatusOK)
+}
+
+func (h *CustomerHandler) UpdateCustomer(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var customer models.Customer
+	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
+		slog.ErrorContext(r.Context(), "Error decoding request body for update", slog.Any("error", err))
+		respondWithError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	customer.ID = id
+	if err := h.service.UpdateCustomer(&customer); err != nil {
+		respondWithCustomerError(w, id, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Customer updated", slog.String("customerID", id))
+	respondWithJSON(w, customer, http.StatusOK)
+}
+
+func (h *CustomerHandler) DeleteCustomer(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := h.service.DeleteCustomer(id); err != nil {
+		respondWithCustomerError(w, id, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Customer deleted", slog.String("customerID", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *CustomerHandler) GetCustomerOrders(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	orders, err := h.service.GetCustomerOrders(id)
+	if err != nil {
+		respondWithCustomerError(w, id, err)
+		return
+	}
+	respondWithJSON(w, orders, http.StatusOK)
+}
+
+func (h *CustomerHandler) GetCustomerStats(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	stats, err := h.service.GetCustomerStats(id)
+	if err != nil {
+		respondWithCustomerError(w, id, err)
+		return
+	}
+	respondWithJSON(w, stats, http.StatusOK)
+}
+
+func respondWithCustomerError(w http.ResponseWriter, id string, err error) {
+	slog.Error("Customer request failed", slog.String("customerID", id), slog.Any("error", err))
+	respondWithServiceError(w, err)
+}
@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"hot-coffee/models"
+	"net/http"
+	"testing"
+)
+
+func TestDeleteCustomerWithOpenOrders(t *testing.T) {
+	server := newTestServer(t)
+	resp, body := server.do(t, http.MethodPost, "/customers", `{"name":"Ann"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create customer status = %d: %s", resp.StatusCode, body)
+	}
+	customerID := decode[models.Customer](t, body).ID
+	orderID := createOrder(t, server, customerID, `{"product_id":"latte","quantity":1}`)
+
+	resp, body = server.do(t, http.MethodDelete, "/customers/"+customerID, "")
+	if resp.StatusCode != http.StatusConflict || decode[problem](t, body).Code != "customer_has_open_orders" {
+		t.Fatalf("delete with an open order = %d: %s, want a customer_has_open_orders 409", resp.StatusCode, body)
+	}
+	// The order can still be edited and closed
+	if resp, body := server.do(t, http.MethodPut, "/orders/"+orderID, `{"items":[{"product_id":"latte","quantity":2}]}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("edit status = %d: %s", resp.StatusCode, body)
+	}
+	if resp, body := server.do(t, http.MethodPost, "/orders/"+orderID+"/close", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("close status = %d: %s", resp.StatusCode, body)
+	}
+
+	if resp, body := server.do(t, http.MethodDelete, "/customers/"+customerID, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete once the order is closed = %d: %s, want 204", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// openAPISpec is the OpenAPI 3 description of every route; keep it in step with the
+// RegisterRoutes methods.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+type DocsHandler struct{}
+
+func NewDocsHandler() *DocsHandler {
+	return &DocsHandler{}
+}
+
+// RegisterRoutes adds the API description to mux.
+func (h *DocsHandler) RegisterRoutes(mux Mux) {
+	mux.HandleFunc("GET /openapi.json", h.GetSpec)
+}
+
+func (h *DocsHandler) GetSpec(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPISpec)
+}
+
+// CheckSpec compares the registered route patterns with the operations in the OpenAPI
+// document. It returns the routes the document does not describe and the documented
+// operations no route serves, both as "METHOD /path".
+func CheckSpec(patterns []string) (undocumented, missing []string, err error) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		return nil, nil, fmt.Errorf("parsing OpenAPI document: %w", err)
+	}
+
+	documented := make(map[string]bool)
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	routed := make(map[string]bool)
+	for _, pattern := range patterns {
+		routed[pattern] = true
+		if !documented[pattern] {
+			undocumented = append(undocumented, pattern)
+		}
+	}
+	for operation := range documented {
+		if !routed[operation] {
+			missing = append(missing, operation)
+		}
+	}
+	sort.Strings(missing)
+	return undocumented, missing, nil
+}
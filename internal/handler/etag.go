@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hot-coffee/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// versionETag is the strong ETag for a record at the given version.
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatchVersion returns the version a PUT or DELETE expects from its If-Match header,
+// given the record's current version. It returns 0 when the header is absent or lists
+// "*", meaning any version is accepted, and models.ErrVersionConflict when none of the
+// ETags listed is current. The service compares the version again under its lock.
+func ifMatchVersion(r *http.Request, current int) (int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, nil
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" {
+			return 0, nil
+		}
+		if candidate == versionETag(current) {
+			return current, nil
+		}
+	}
+	return 0, models.ErrVersionConflict
+}
+
+// notModified reports whether the request's If-None-Match header already lists etag.
+func notModified(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// respondWithETag writes data with the given ETag, or 304 Not Modified when the client's copy is current.
+func respondWithETag(w http.ResponseWriter, r *http.Request, data interface{}, etag string) {
+	w.Header().Set("ETag", etag)
+	if notModified(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	respondWithJSON(w, data, http.StatusOK)
+}
+
+// respondWithListETag is respondWithETag for collections, whose ETag is a hash of the body.
+func respondWithListETag(w http.ResponseWriter, r *http.Request, data interface{}) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		respondWithError(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(body)
+	respondWithETag(w, r, json.RawMessage(body), `"`+hex.EncodeToString(sum[:16])+`"`)
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/events"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// keepAliveInterval is how often an idle event stream gets a comment line so proxies keep it open.
+const keepAliveInterval = 15 * time.Second
+
+type EventsHandler struct {
+	bus *events.Bus
+}
+
+func NewEventsHandler(bus *events.Bus) *EventsHandler {
+	return &EventsHandler{bus: bus}
+}
+
+// RegisterRoutes adds the event stream to mux.
+func (h *EventsHandler) RegisterRoutes(mux Mux) {
+	mux.Handle("GET /events", h)
+}
+
+// ServeHTTP streams events as Server-Sent Events. Clients choose event types with
+// ?types=order.created,inventory.* and resume after a reconnect with the Last-Event-ID
+// header (or ?last_event_id=) from the events still held in the replay buffer.
+func (h *EventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	// The stream outlives the server's write timeout; keep-alives detect dead clients instead
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	var filters []string
+	if types := r.URL.Query().Get("types"); types != "" {
+		filters = strings.Split(types, ",")
+	}
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var since int64
+	if lastID != "" {
+		var err error
+		if since, err = strconv.ParseInt(lastID, 10, 64); err != nil {
+			respondWithError(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	replay, stream, unsubscribe := h.bus.Subscribe(since)
+	defer unsubscribe()
+	slog.InfoContext(r.Context(), "Event stream opened", slog.String("remote", r.RemoteAddr), slog.Any("types", filters), slog.Int64("since", since))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for _, event := range replay {
+		if events.Matches(filters, event.Type) {
+			writeEvent(w, event)
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			slog.InfoContext(r.Context(), "Event stream closed", slog.String("remote", r.RemoteAddr))
+			return
+		case event, ok := <-stream:
+			if !ok {
+				return
+			}
+			if !events.Matches(filters, event.Type) {
+				continue
+			}
+			writeEvent(w, event)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Failed to encode event", slog.Int64("id", event.ID), slog.String("error", err.Error()))
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"context"
+	"hot-coffee/internal/service"
+	"hot-coffee/models"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// readinessTimeout bounds a readiness probe; supervisors usually give up after a few seconds.
+const readinessTimeout = 2 * time.Second
+
+// HealthHandler answers the process supervisor's liveness and readiness probes.
+type HealthHandler struct {
+	service *service.HealthService
+}
+
+func NewHealthHandler(service *service.HealthService) *HealthHandler {
+	return &HealthHandler{service: service}
+}
+
+// RegisterRoutes adds the probe routes to mux.
+func (h *HealthHandler) RegisterRoutes(mux Mux) {
+	mux.HandleFunc("GET /healthz", h.Live)
+	mux.HandleFunc("GET /readyz", h.Ready)
+}
+
+// Live reports that the process is up and serving requests; it checks nothing else.
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, map[string]string{"status": models.HealthOK}, http.StatusOK)
+}
+
+// Ready runs the storage checks and answers 503 when any of them fails.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	report := h.service.Check(ctx)
+	status := http.StatusOK
+	if report.Status != models.HealthOK {
+		status = http.StatusServiceUnavailable
+		for _, check := range report.Checks {
+			if check.Status != models.HealthOK {
+				slog.WarnContext(r.Context(), "Readiness check failed", slog.String("check", check.Name), slog.String("error", check.Error))
+			}
+		}
+	}
+	respondWithJSON(w, report, status)
+}
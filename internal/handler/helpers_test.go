@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"hot-coffee/config"
+	"hot-coffee/internal/dal"
+	"hot-coffee/internal/events"
+	"hot-coffee/internal/metrics"
+	"hot-coffee/internal/service"
+	"hot-coffee/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServer serves the handlers and middleware wired the way cmd/main.go wires them,
+// over a fresh data directory holding a latte and the espresso it is made from.
+type testServer struct {
+	*httptest.Server
+	router *Router
+	bus    *events.Bus
+	orders *service.OrderService
+	auth   *service.AuthService
+	// token signs requests in as an admin
+	token string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	previous := config.Directory
+	config.Directory = filepath.Join(t.TempDir(), "data")
+	t.Cleanup(func() { config.Directory = previous })
+	if err := config.ValidateDirectory(dal.CreateDataFiles); err != nil {
+		t.Fatal(err)
+	}
+
+	orderRepo := &dal.FileOrderRepository{}
+	refundRepo := &dal.FileRefundRepository{}
+	customerRepo := &dal.FileCustomerRepository{}
+	bus := events.NewBus(100)
+	t.Cleanup(bus.Close)
+
+	audit := service.NewAuditService(&dal.FileAuditRepository{})
+	authService := service.NewAuthService(&dal.FileUserRepository{}, time.Hour)
+	inventoryService := service.NewInventoryService(&dal.FileInventoryRepository{}, bus, audit)
+	menuService := service.NewMenuService(&dal.FileMenuRepository{}, audit)
+	loyaltyService := service.NewLoyaltyService(&dal.FileLoyaltyRepository{}, customerRepo, orderRepo, *menuService, audit)
+	orderService := service.NewOrderService(orderRepo, customerRepo, *menuService, *inventoryService, loyaltyService, bus, audit)
+	refundService := service.NewRefundService(refundRepo, orderRepo, *menuService, *inventoryService, loyaltyService)
+	reportsService := service.NewReportsService(orderRepo, refundRepo, *menuService, models.Pricing{Currency: "USD"})
+	shiftService := service.NewShiftService(&dal.FileShiftRepository{}, &dal.FileZReportRepository{}, reportsService)
+	webhookService := service.NewWebhookService(&dal.FileWebhookRepository{}, bus, http.DefaultClient, 1, time.Millisecond)
+
+	router := NewRouter(
+		NewInventoryHandler(inventoryService),
+		NewMenuHandler(menuService),
+		NewOrderHandler(orderService, refundService),
+		NewCustomerHandler(service.NewCustomerService(customerRepo, orderRepo, refundRepo)),
+		NewLoyaltyHandler(loyaltyService),
+		NewQueueHandler(service.NewQueueService(orderRepo, *menuService, bus, audit)),
+		NewEventsHandler(bus),
+		NewPOSHandler(orderService, bus, dal.HoldWrites, false),
+		NewWebhookHandler(webhookService),
+		NewReportsHandler(reportsService, shiftService),
+		NewShiftHandler(shiftService),
+		NewDocsHandler(),
+		NewAuthHandler(authService),
+		NewAuditHandler(audit),
+		NewMetricsHandler(metrics.Default),
+		NewHealthHandler(service.NewHealthService(&dal.FileStorage{})),
+		NewBackupHandler(service.NewBackupService(&dal.FileBackupRepository{Dir: t.TempDir()}, 1)),
+	)
+	var stack http.Handler = Idempotency(service.NewIdempotencyService(&dal.FileIdempotencyRepository{}, time.Hour), router)
+	stack = HoldWrites(dal.HoldWrites, router, stack)
+	stack = Authenticate(authService, router, stack)
+	stack = LimitBody(1<<20, stack)
+	stack = Recover(stack)
+	stack = RequestMetrics(router, stack)
+	stack = RequestID(stack)
+	server := httptest.NewServer(stack)
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	if err := inventoryService.AddItem(ctx, &models.InventoryItem{IngredientID: "espresso_shot", Name: "Espresso Shot", Quantity: 100, Unit: "shots"}); err != nil {
+		t.Fatal(err)
+	}
+	latte := &models.MenuItem{ID: "latte", Name: "Latte", Description: "Espresso with steamed milk", Price: 4,
+		Ingredients: []models.MenuItemIngredient{{IngredientID: "espresso_shot", Quantity: 1}}}
+	if err := menuService.AddItem(ctx, latte); err != nil {
+		t.Fatal(err)
+	}
+	if err := authService.AddUser(&models.User{Username: "admin", Password: "correct-horse", Role: models.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	login, err := authService.Login(models.Credentials{Username: "admin", Password: "correct-horse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testServer{Server: server, router: router, bus: bus, orders: orderService, auth: authService, token: login.Token}
+}
+
+// do sends a request signed in as the admin and returns the response with its body read.
+func (s *testServer) do(t *testing.T, method, path, body string, header ...string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, data
+}
+
+// decode unmarshals a response body, failing the test when it is not valid JSON.
+func decode[T any](t *testing.T, data []byte) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("response %q does not decode: %v", data, err)
+	}
+	return v
+}
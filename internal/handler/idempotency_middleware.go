@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hot-coffee/internal/service"
+	"hot-coffee/models"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// Idempotency makes mutating requests sent with an Idempotency-Key header safe to retry.
+// The first response for a key is stored and replayed for retries by the same user with
+// the same method, path and body; reusing the key for a different request is rejected
+// with 422. Responses marked Cache-Control: no-store carry a credential, such as a new
+// API key, and are never stored: a retry repeats the request.
+func Idempotency(idempotencyService *service.IdempotencyService, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || !isMutating(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			respondWithError(w, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if isBodyTooLarge(err) {
+			respondWithError(w, "Request body is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			respondWithError(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		userID := ""
+		if user := currentUser(r); user != nil {
+			userID = user.ID
+		}
+		hash := sha256.Sum256([]byte(userID + "\n" + r.Method + " " + r.URL.RequestURI() + "\n" + string(body)))
+		requestHash := hex.EncodeToString(hash[:])
+
+		record, err := idempotencyService.Begin(userID, key, requestHash)
+		switch {
+		case err != nil:
+			slog.ErrorContext(r.Context(), "Failed to look up idempotency key", slog.String("key", key), slog.String("error", err.Error()))
+			respondWithServiceError(w, err)
+			return
+		case record != nil:
+			slog.InfoContext(r.Context(), "Replaying idempotent response", slog.String("key", key), slog.Int("status", record.StatusCode))
+			// The replay keeps the X-Request-ID of this request
+			for name, values := range record.Header {
+				if name != http.CanonicalHeaderKey("X-Request-ID") {
+					w.Header()[name] = values
+				}
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.StatusCode)
+			w.Write(record.Body)
+			return
+		}
+
+		// The key is given up unless a response is stored for it, also when the handler
+		// panics: Recover sits outside this middleware, and a key left claimed would turn
+		// every retry away with 409
+		completing := false
+		defer func() {
+			if !completing {
+				idempotencyService.Release(userID, key)
+			}
+		}()
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		// Server errors are not remembered so the client can retry them for real
+		if recorder.status >= http.StatusInternalServerError || recorder.Header().Get("Cache-Control") == "no-store" {
+			return
+		}
+		completing = true
+		header := recorder.Header().Clone()
+		header.Del("X-Request-ID")
+		err = idempotencyService.Complete(&models.IdempotencyRecord{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: requestHash,
+			StatusCode:  recorder.status,
+			Header:      header,
+			Body:        recorder.body.Bytes(),
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to store idempotent response", slog.String("key", key), slog.String("error", err.Error()))
+		}
+	})
+}
+
+func isMutating(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch || method == http.MethodDelete
+}
+
+// responseRecorder passes a response through while keeping a copy of its status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.status = status
+	r.wroteHeader = true
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"hot-coffee/config"
+	"hot-coffee/internal/dal"
+	"hot-coffee/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyReleasesKeyWhenHandlerPanics(t *testing.T) {
+	previous := config.Directory
+	config.Directory = filepath.Join(t.TempDir(), "data")
+	t.Cleanup(func() { config.Directory = previous })
+	if err := config.ValidateDirectory(dal.CreateDataFiles); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			panic("storage went away")
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"order_1"}`))
+	})
+	stack := Recover(Idempotency(service.NewIdempotencyService(&dal.FileIdempotencyRepository{}, time.Hour), handler))
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{}`))
+		req.Header.Set("Idempotency-Key", "retry-me")
+		rec := httptest.NewRecorder()
+		stack.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("panicking request got %d, want 500", rec.Code)
+	}
+	// The retry runs the handler again instead of waiting on a claim nobody holds
+	rec := send()
+	if rec.Code != http.StatusCreated || calls != 2 {
+		t.Fatalf("retry got %d after %d handler calls, want 201 after 2", rec.Code, calls)
+	}
+	if rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("the retry was answered from a stored response")
+	}
+	// The successful response is what is kept for the key
+	rec = send()
+	if rec.Code != http.StatusCreated || calls != 2 || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("second retry got %d after %d handler calls, want the stored 201 replayed", rec.Code, calls)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"hot-coffee/models"
 	"log/slog"
 	"net/http"
-	"strings"
 )
 
 type InventoryHandler struct {
@@ -17,136 +16,132 @@ func NewInventoryHandler(service *service.InventoryService) *InventoryHandler {
 	return &InventoryHandler{service: service}
 }
 
-// respondWithError formats an error message in JSON format and writes it to the response.
-func respondWithError(w http.ResponseWriter, message string, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
+// RegisterRoutes adds the inventory routes to mux.
+func (h *InventoryHandler) RegisterRoutes(mux Mux) {
+	mux.HandleFunc("POST /inventory", h.AddInventoryItem)
+	mux.HandleFunc("GET /inventory", h.GetAllInventoryItems)
+	mux.HandleFunc("GET /inventory/{id}", h.GetInventoryItem)
+	mux.HandleFunc("PUT /inventory/{id}", h.UpdateInventoryItem)
+	mux.HandleFunc("DELETE /inventory/{id}", h.DeleteInventoryItem)
 }
 
-func (h *InventoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	path := r.URL.Path
-	slog.Info("Request received", "method", r.Method, "path", path)
-	switch r.Method {
-	case http.MethodPost:
-		if strings.HasPrefix(path, "/inventory/") {
-			slog.Error("Invalid POST request - unexpected URL path")
-			respondWithError(w, "Invalid request", http.StatusBadRequest)
-		} else {
-			h.AddInventoryItem(w, r)
-		}
-
-	case http.MethodGet:
-		if strings.HasPrefix(path, "/inventory/") {
-			id := strings.TrimPrefix(path, "/inventory/")
-			h.GetInventoryItem(w, r, id)
-		} else {
-			h.GetAllInventoryItems(w, r)
-		}
-
-	case http.MethodPut:
-		if strings.HasPrefix(path, "/inventory/") {
-			id := strings.TrimPrefix(path, "/inventory/")
-			h.UpdateInventoryItem(w, r, id)
-		} else {
-			slog.Error("Invalid PUT request - unexpected URL path")
-			respondWithError(w, "Invalid request", http.StatusBadRequest)
-		}
-
-	case http.MethodDelete:
-		if strings.HasPrefix(path, "/inventory/") {
-			id := strings.TrimPrefix(path, "/inventory/")
-			h.DeleteInventoryItem(w, r, id)
-		} else {
-			slog.Error("Invalid DELETE request - unexpected URL path")
-			respondWithError(w, "Invalid request", http.StatusBadRequest)
-		}
-
-	default:
-		slog.Warn("Method not allowed", "method", r.Method)
-		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+func (h *InventoryHandler) DeleteInventoryItem(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	slog.InfoContext(r.Context(), "Deleting inventory item", "id", id)
+	current, err := h.service.GetInventoryItemByID(id)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
 	}
-}
-
-func (h *InventoryHandler) DeleteInventoryItem(w http.ResponseWriter, r *http.Request, id string) {
-	slog.Info("Deleting inventory item", "id", id)
-	if err := h.service.DeleteItem(id); err != nil {
-		slog.Error("Error deleting inventory item", "id", id, "error", err)
-		respondWithError(w, err.Error(), http.StatusNotFound)
+	version, err := ifMatchVersion(r, current.Version)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	if err := h.service.DeleteItem(r.Context(), id, version); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting inventory item", "id", id, "error", err)
+		respondWithServiceError(w, err)
 		return
 	}
-	slog.Info("Inventory item deleted", "id", id)
+	slog.InfoContext(r.Context(), "Inventory item deleted", "id", id)
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (h *InventoryHandler) AddInventoryItem(w http.ResponseWriter, r *http.Request) {
 	var item models.InventoryItem
 
-	slog.Info("Decoding JSON for new inventory item")
+	slog.InfoContext(r.Context(), "Decoding JSON for new inventory item")
 	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
-		slog.Error("Error decoding JSON", "error", err)
+		slog.ErrorContext(r.Context(), "Error decoding JSON", "error", err)
 		respondWithError(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
-	if err := h.service.AddItem(&item); err != nil {
-		slog.Error("Error adding inventory item", "error", err)
-		respondWithError(w, err.Error(), http.StatusInternalServerError)
+	if err := h.service.AddItem(r.Context(), &item); err != nil {
+		slog.ErrorContext(r.Context(), "Error adding inventory item", "error", err)
+		respondWithServiceError(w, err)
 		return
 	}
 
-	slog.Info("Inventory item added", "id", item.IngredientID)
+	slog.InfoContext(r.Context(), "Inventory item added", "id", item.IngredientID)
+	w.Header().Set("ETag", versionETag(item.Version))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(item)
 }
 
-func (h *InventoryHandler) GetInventoryItem(w http.ResponseWriter, r *http.Request, id string) {
-	slog.Info("Retrieving inventory item", "id", id)
+func (h *InventoryHandler) GetInventoryItem(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	slog.InfoContext(r.Context(), "Retrieving inventory item", "id", id)
 	item, err := h.service.GetInventoryItemByID(id)
 	if err != nil {
-		slog.Error("Error retrieving inventory item", "id", id, "error", err)
-		respondWithError(w, err.Error(), http.StatusNotFound)
+		slog.ErrorContext(r.Context(), "Error retrieving inventory item", "id", id, "error", err)
+		respondWithServiceError(w, err)
 		return
 	}
 
-	slog.Info("Inventory item retrieved", "id", id)
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(item)
+	slog.InfoContext(r.Context(), "Inventory item retrieved", "id", id)
+	respondWithETag(w, r, item, versionETag(item.Version))
 }
 
-func (h *InventoryHandler) UpdateInventoryItem(w http.ResponseWriter, r *http.Request, id string) {
+func (h *InventoryHandler) UpdateInventoryItem(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
 	var updatedItem models.InventoryItem
 
-	slog.Info("Updating inventory item", "id", id)
+	slog.InfoContext(r.Context(), "Updating inventory item", "id", id)
 	if err := json.NewDecoder(r.Body).Decode(&updatedItem); err != nil {
-		slog.Error("Error decoding JSON", "error", err)
+		slog.ErrorContext(r.Context(), "Error decoding JSON", "error", err)
 		respondWithError(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
+	current, err := h.service.GetInventoryItemByID(id)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	// If-Match takes precedence over a version in the body
+	version, err := ifMatchVersion(r, current.Version)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	if version != 0 {
+		updatedItem.Version = version
+	}
+
 	updatedItem.IngredientID = id
-	if err := h.service.UpdateItem(&updatedItem); err != nil {
-		slog.Error("Error updating inventory item", "id", id, "error", err)
-		respondWithError(w, err.Error(), http.StatusInternalServerError)
+	if err := h.service.UpdateItem(r.Context(), &updatedItem); err != nil {
+		slog.ErrorContext(r.Context(), "Error updating inventory item", "id", id, "error", err)
+		respondWithServiceError(w, err)
 		return
 	}
 
-	slog.Info("Inventory item updated", "id", id)
+	slog.InfoContext(r.Context(), "Inventory item updated", "id", id)
+	w.Header().Set("ETag", versionETag(updatedItem.Version))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(updatedItem)
 }
 
+// GetAllInventoryItems lists inventory items, filtered by a name substring and low_stock.
 func (h *InventoryHandler) GetAllInventoryItems(w http.ResponseWriter, r *http.Request) {
-	slog.Info("Retrieving all inventory items")
-	items, err := h.service.GetAllItems()
+	slog.InfoContext(r.Context(), "Retrieving inventory items", "query", r.URL.RawQuery)
+	query := models.InventoryQuery{Name: r.URL.Query().Get("name"), Sort: parseSort(r)}
+	var err error
+	if query.Page, err = parsePage(r); err == nil {
+		query.LowStock, err = parseOptionalBool(r, "low_stock")
+	}
 	if err != nil {
-		slog.Error("Error retrieving all items", "error", err)
-		respondWithError(w, "Failed to retrieve inventory items", http.StatusInternalServerError)
+		respondWithServiceError(w, err)
 		return
 	}
 
-	slog.Info("Inventory items retrieved", "count", len(items))
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(items)
+	items, err := h.service.QueryItems(query)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving inventory items", "error", err)
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Inventory items retrieved", "count", len(items.Data), "total", items.Pagination.Total)
+	respondWithListETag(w, r, items)
 }
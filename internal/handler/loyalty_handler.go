@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+	"hot-coffee/internal/service"
+	"hot-coffee/models"
+	"log/slog"
+	"net/http"
+)
+
+type LoyaltyHandler struct {
+	service *service.LoyaltyService
+}
+
+func NewLoyaltyHandler(service *service.LoyaltyService) *LoyaltyHandler {
+	return &LoyaltyHandler{service: service}
+}
+
+// RegisterRoutes adds the loyalty routes to mux.
+func (h *LoyaltyHandler) RegisterRoutes(mux Mux) {
+	mux.HandleFunc("GET /loyalty/settings", h.GetSettings)
+	mux.HandleFunc("PUT /loyalty/settings", h.UpdateSettings)
+	mux.HandleFunc("GET /loyalty/customers/{id}", h.GetBalance)
+	mux.HandleFunc("GET /loyalty/customers/{id}/history", h.GetHistory)
+	mux.HandleFunc("POST /loyalty/customers/{id}/redeem", h.Redeem)
+}
+
+func (h *LoyaltyHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.service.GetSettings()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to read loyalty settings", slog.String("error", err.Error()))
+		respondWithError(w, "Failed to read loyalty settings", http.StatusInternalServerError)
+		return
+	}
+	respondWithJSON(w, settings, http.StatusOK)
+}
+
+func (h *LoyaltyHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	var settings models.LoyaltySettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to decode loyalty settings", slog.String("error", err.Error()))
+		respondWithError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.UpdateSettings(&settings); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to update loyalty settings", slog.String("error", err.Error()))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Loyalty settings updated")
+	respondWithJSON(w, settings, http.StatusOK)
+}
+
+func (h *LoyaltyHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
+	customerID := r.PathValue("id")
+	balance, err := h.service.GetBalance(customerID)
+	if err != nil {
+		respondWithLoyaltyError(w, customerID, err)
+		return
+	}
+	respondWithJSON(w, balance, http.StatusOK)
+}
+
+func (h *LoyaltyHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	customerID := r.PathValue("id")
+	entries, err := h.service.GetHistory(customerID)
+	if err != nil {
+		respondWithLoyaltyError(w, customerID, err)
+		return
+	}
+	respondWithJSON(w, entries, http.StatusOK)
+}
+
+func (h *LoyaltyHandler) Redeem(w http.ResponseWriter, r *http.Request) {
+	customerID := r.PathValue("id")
+	var redemption models.LoyaltyRedemption
+	if err := json.NewDecoder(r.Body).Decode(&redemption); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to decode redemption", slog.String("error", err.Error()))
+		respondWithError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.service.Redeem(r.Context(), customerID, &redemption)
+	if err != nil {
+		respondWithLoyaltyError(w, customerID, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Loyalty points redeemed", slog.String("customerID", customerID), slog.String("orderID", order.ID))
+	respondWithJSON(w, order, http.StatusOK)
+}
+
+func respondWithLoyaltyError(w http.ResponseWriter, customerID string, err error) {
+	slog.Error("Loyalty request failed", slog.String("customerID", customerID), slog.String("error", err.Error()))
+	respondWithServiceError(w, err)
+}
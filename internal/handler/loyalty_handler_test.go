@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"fmt"
+	"hot-coffee/models"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// loyalCustomer sets up a loyalty program and a customer who has earned 40 points on a
+// closed order of one latte, and returns the customer's ID.
+func loyalCustomer(t *testing.T, server *testServer, name string) string {
+	t.Helper()
+	steps := []struct{ method, path, body string }{
+		{http.MethodPut, "/loyalty/settings", `{"points_per_currency_unit":10,"point_value":0.1,"free_item_points":{"latte":30},"expiry_days":0}`},
+		{http.MethodPost, "/customers", `{"name":"` + name + `"}`},
+	}
+	var customerID string
+	for _, step := range steps {
+		resp, body := server.do(t, step.method, step.path, step.body)
+		if resp.StatusCode >= 300 {
+			t.Fatalf("%s %s status = %d: %s", step.method, step.path, resp.StatusCode, body)
+		}
+		if step.path == "/customers" {
+			customerID = decode[models.Customer](t, body).ID
+		}
+	}
+	orderID := createOrder(t, server, customerID, `{"product_id":"latte","quantity":1}`)
+	if resp, body := server.do(t, http.MethodPost, "/orders/"+orderID+"/close", `{"payment_type":"card"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("close status = %d: %s", resp.StatusCode, body)
+	}
+	if points := balance(t, server, customerID); points != 40 {
+		t.Fatalf("balance after the first order = %d, want 40", points)
+	}
+	return customerID
+}
+
+func createOrder(t *testing.T, server *testServer, customerID string, items string) string {
+	t.Helper()
+	resp, body := server.do(t, http.MethodPost, "/orders", `{"customer_id":"`+customerID+`","items":[`+items+`]}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", resp.StatusCode, body)
+	}
+	return decode[models.Order](t, body).ID
+}
+
+func balance(t *testing.T, server *testServer, customerID string) int {
+	t.Helper()
+	resp, body := server.do(t, http.MethodGet, "/loyalty/customers/"+customerID, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("balance status = %d: %s", resp.StatusCode, body)
+	}
+	return decode[models.LoyaltyBalance](t, body).Points
+}
+
+func TestConcurrentRedemptionsSpendPointsOnce(t *testing.T) {
+	server := newTestServer(t)
+	customerID := loyalCustomer(t, server, "Ann")
+	orderID := createOrder(t, server, customerID, `{"product_id":"latte","quantity":2}`)
+
+	// Each redemption fits the order, but the balance only covers one of them
+	var wg sync.WaitGroup
+	statuses := make(chan int, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, _ := server.do(t, http.MethodPost, "/loyalty/customers/"+customerID+"/redeem", fmt.Sprintf(`{"order_id":%q,"points":30}`, orderID))
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	counts := make(map[int]int)
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusOK] != 1 || counts[http.StatusConflict] != 7 {
+		t.Fatalf("redemption statuses = %v, want one 200 and seven 409s", counts)
+	}
+	if points := balance(t, server, customerID); points != 10 {
+		t.Errorf("balance = %d, want 10", points)
+	}
+}
+
+func TestEditReturnsRedemptionsItNoLongerHolds(t *testing.T) {
+	server := newTestServer(t)
+	customerID := loyalCustomer(t, server, "Ann")
+	resp, body := server.do(t, http.MethodPost, "/customers", `{"name":"Bea"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create customer status = %d: %s", resp.StatusCode, body)
+	}
+	otherID := decode[models.Customer](t, body).ID
+	cookie := `{"product_id":"cookie","name":"Cookie","description":"Oat","price":1,"ingredients":[{"ingredient_id":"espresso_shot","quantity":1}]}`
+	if resp, body := server.do(t, http.MethodPost, "/menu", cookie); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("add cookie status = %d: %s", resp.StatusCode, body)
+	}
+
+	tests := []struct {
+		name   string
+		redeem string
+		edit   string
+		keeps  bool
+	}{
+		{"free item kept", `{"product_id":"latte"}`, `{"items":[{"product_id":"latte","quantity":1},{"product_id":"cookie","quantity":1}]}`, true},
+		{"free item removed", `{"product_id":"latte"}`, `{"items":[{"product_id":"cookie","quantity":3}]}`, false},
+		{"subtotal below discount", `{"points":30}`, `{"items":[{"product_id":"cookie","quantity":2}]}`, false},
+		{"other customer", `{"points":30}`, `{"customer_id":"` + otherID + `"}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderID := createOrder(t, server, customerID, `{"product_id":"latte","quantity":2}`)
+			before := balance(t, server, customerID)
+			resp, body := server.do(t, http.MethodPost, "/loyalty/customers/"+customerID+"/redeem", `{"order_id":"`+orderID+`",`+tt.redeem[1:])
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("redeem status = %d: %s", resp.StatusCode, body)
+			}
+			discount := decode[models.Order](t, body).Discount
+
+			resp, body = server.do(t, http.MethodPut, "/orders/"+orderID, tt.edit)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("edit status = %d: %s", resp.StatusCode, body)
+			}
+			edited := decode[models.Order](t, body)
+			after := balance(t, server, customerID)
+			if tt.keeps {
+				if edited.Discount != discount || after != before-30 {
+					t.Errorf("discount %v and balance %d after the edit, want %v and %d", edited.Discount, after, discount, before-30)
+				}
+			} else if edited.Discount != 0 || after != before {
+				t.Errorf("discount %v and balance %d after the edit, want 0 and %d", edited.Discount, after, before)
+			}
+			// Return what is left so the next case starts from the same balance
+			server.do(t, http.MethodDelete, "/orders/"+orderID, "")
+		})
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"hot-coffee/models"
 	"log/slog"
 	"net/http"
-	"strings"
 )
 
 type MenuHandler struct {
@@ -17,118 +16,130 @@ func NewMenuHandler(service *service.MenuService) *MenuHandler {
 	return &MenuHandler{service: service}
 }
 
-func (h *MenuHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	path := r.URL.Path
-	slog.Info("Received request", slog.String("method", r.Method), slog.String("path", path))
-
-	switch r.Method {
-	case http.MethodPost:
-		if strings.HasPrefix(path, "/menu/") {
-			respondWithError(w, "Invalid request", http.StatusBadRequest)
-		} else {
-			h.AddMenuItem(w, r)
-		}
-	case http.MethodGet:
-		if strings.HasPrefix(path, "/menu/") {
-			id := strings.TrimPrefix(path, "/menu/")
-			h.GetMenuItem(w, r, id)
-		} else {
-			h.GetAllMenuItems(w, r)
-		}
-	case http.MethodPut:
-		if strings.HasPrefix(path, "/menu/") {
-			id := strings.TrimPrefix(path, "/menu/")
-			h.UpdateMenuItem(w, r, id)
-		} else {
-			respondWithError(w, "Invalid request", http.StatusBadRequest)
-		}
-	case http.MethodDelete:
-		if strings.HasPrefix(path, "/menu/") {
-			id := strings.TrimPrefix(path, "/menu/")
-			h.DeleteMenuItem(w, r, id)
-		} else {
-			respondWithError(w, "Invalid request", http.StatusBadRequest)
-		}
-	default:
-		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
-	}
+// RegisterRoutes adds the menu routes to mux.
+func (h *MenuHandler) RegisterRoutes(mux Mux) {
+	mux.HandleFunc("POST /menu", h.AddMenuItem)
+	mux.HandleFunc("GET /menu", h.GetAllMenuItems)
+	mux.HandleFunc("GET /menu/{id}", h.GetMenuItem)
+	mux.HandleFunc("PUT /menu/{id}", h.UpdateMenuItem)
+	mux.HandleFunc("DELETE /menu/{id}", h.DeleteMenuItem)
 }
 
 func (h *MenuHandler) AddMenuItem(w http.ResponseWriter, r *http.Request) {
 	var item models.MenuItem
 
 	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
-		slog.Error("Error decoding request body", slog.Any("error", err))
+		slog.ErrorContext(r.Context(), "Error decoding request body", slog.Any("error", err))
 		respondWithError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if err := h.service.AddItem(&item); err != nil {
-		slog.Error("Error adding menu item", slog.Any("error", err))
-		respondWithError(w, err.Error(), http.StatusInternalServerError)
+	if err := h.service.AddItem(r.Context(), &item); err != nil {
+		slog.ErrorContext(r.Context(), "Error adding menu item", slog.Any("error", err))
+		respondWithServiceError(w, err)
 		return
 	}
 
-	slog.Info("Menu item successfully added", slog.String("itemID", item.ID))
+	slog.InfoContext(r.Context(), "Menu item successfully added", slog.String("itemID", item.ID))
+	w.Header().Set("ETag", versionETag(item.Version))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(item)
 }
 
+// GetAllMenuItems lists menu items, filtered by a min_price/max_price range and an ingredient.
 func (h *MenuHandler) GetAllMenuItems(w http.ResponseWriter, r *http.Request) {
-	items, err := h.service.GetAllItems()
+	query := models.MenuQuery{IngredientID: r.URL.Query().Get("ingredient"), Sort: parseSort(r)}
+	var err error
+	if query.Page, err = parsePage(r); err == nil {
+		if query.MinPrice, err = parseOptionalFloat(r, "min_price"); err == nil {
+			query.MaxPrice, err = parseOptionalFloat(r, "max_price")
+		}
+	}
 	if err != nil {
-		slog.Error("Error retrieving menu items", slog.Any("error", err))
-		respondWithError(w, "Failed to retrieve menu items", http.StatusInternalServerError)
+		respondWithServiceError(w, err)
 		return
 	}
 
-	slog.Info("Retrieved all menu items", slog.Int("itemCount", len(items)))
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(items)
+	items, err := h.service.QueryItems(query)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving menu items", slog.Any("error", err))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Retrieved menu items", slog.Int("itemCount", len(items.Data)), slog.Int("total", items.Pagination.Total))
+	respondWithListETag(w, r, items)
 }
 
-func (h *MenuHandler) GetMenuItem(w http.ResponseWriter, r *http.Request, id string) {
+func (h *MenuHandler) GetMenuItem(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
 	item, err := h.service.GetMenuItemByID(id)
 	if err != nil {
-		slog.Error("Error retrieving menu item", slog.String("itemID", id), slog.Any("error", err))
-		respondWithError(w, err.Error(), http.StatusNotFound)
+		slog.ErrorContext(r.Context(), "Error retrieving menu item", slog.String("itemID", id), slog.Any("error", err))
+		respondWithServiceError(w, err)
 		return
 	}
 
-	slog.Info("Menu item retrieved", slog.String("itemID", id))
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(item)
+	slog.InfoContext(r.Context(), "Menu item retrieved", slog.String("itemID", id))
+	respondWithETag(w, r, item, versionETag(item.Version))
 }
 
-func (h *MenuHandler) UpdateMenuItem(w http.ResponseWriter, r *http.Request, id string) {
+func (h *MenuHandler) UpdateMenuItem(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
 	var updatedItem models.MenuItem
 	if err := json.NewDecoder(r.Body).Decode(&updatedItem); err != nil {
-		slog.Error("Error decoding request body for update", slog.Any("error", err))
+		slog.ErrorContext(r.Context(), "Error decoding request body for update", slog.Any("error", err))
 		respondWithError(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
+	current, err := h.service.GetMenuItemByID(id)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	// If-Match takes precedence over a version in the body
+	version, err := ifMatchVersion(r, current.Version)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	if version != 0 {
+		updatedItem.Version = version
+	}
+
 	updatedItem.ID = id
 
-	if err := h.service.UpdateMenuItem(&updatedItem); err != nil {
-		slog.Error("Error updating menu item", slog.String("itemID", id), slog.Any("error", err))
-		respondWithError(w, err.Error(), http.StatusInternalServerError)
+	if err := h.service.UpdateMenuItem(r.Context(), &updatedItem); err != nil {
+		slog.ErrorContext(r.Context(), "Error updating menu item", slog.String("itemID", id), slog.Any("error", err))
+		respondWithServiceError(w, err)
 		return
 	}
 
-	slog.Info("Menu item updated successfully", slog.String("itemID", id))
+	slog.InfoContext(r.Context(), "Menu item updated successfully", slog.String("itemID", id))
+	w.Header().Set("ETag", versionETag(updatedItem.Version))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(updatedItem)
 }
 
-func (h *MenuHandler) DeleteMenuItem(w http.ResponseWriter, r *http.Request, id string) {
-	if err := h.service.DeleteMenuItem(id); err != nil {
-		slog.Error("Error deleting menu item", slog.String("itemID", id), slog.Any("error", err))
-		respondWithError(w, err.Error(), http.StatusNotFound)
+func (h *MenuHandler) DeleteMenuItem(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	current, err := h.service.GetMenuItemByID(id)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	version, err := ifMatchVersion(r, current.Version)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	if err := h.service.DeleteMenuItem(r.Context(), id, version); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting menu item", slog.String("itemID", id), slog.Any("error", err))
+		respondWithServiceError(w, err)
 		return
 	}
 
-	slog.Info("Menu item deleted", slog.String("itemID", id))
+	slog.InfoContext(r.Context(), "Menu item deleted", slog.String("itemID", id))
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"hot-coffee/internal/metrics"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	httpRequests = metrics.Default.NewCounter("hotcoffee_http_requests_total",
+		"HTTP requests answered, by method, route and status.", "method", "route", "status")
+	httpDuration = metrics.Default.NewHistogram("hotcoffee_http_request_duration_seconds",
+		"Time taken to answer HTTP requests, by method, route and status.", metrics.DefaultBuckets, "method", "route", "status")
+)
+
+// MetricsHandler serves the metrics in the Prometheus text format.
+type MetricsHandler struct {
+	registry *metrics.Registry
+}
+
+func NewMetricsHandler(registry *metrics.Registry) *MetricsHandler {
+	return &MetricsHandler{registry: registry}
+}
+
+// RegisterRoutes adds the scrape endpoint to mux.
+func (h *MetricsHandler) RegisterRoutes(mux Mux) {
+	mux.HandleFunc("GET /metrics", h.GetMetrics)
+}
+
+func (h *MetricsHandler) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := h.registry.WriteTo(w); err != nil {
+		slog.WarnContext(r.Context(), "Failed to write metrics", slog.String("error", err.Error()))
+	}
+}
+
+// RequestMetrics counts requests and times them by route pattern, so /orders/{id} is one
+// series however many orders there are. Requests matching no route count as "unmatched".
+func RequestMetrics(router *Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			route := "unmatched"
+			if pattern := router.Pattern(r); pattern != "" {
+				// Patterns are "METHOD /path"; the method is a label of its own
+				_, path, _ := strings.Cut(pattern, " ")
+				route = path
+			}
+			status := strconv.Itoa(sw.statusCode())
+			httpRequests.Inc(r.Method, route, status)
+			httpDuration.Observe(time.Since(start).Seconds(), r.Method, route, status)
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
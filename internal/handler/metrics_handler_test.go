@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrape reads /metrics into a map from each sample, name and labels as written, to its value.
+func scrape(t *testing.T, server *testServer) (map[string]float64, string) {
+	t.Helper()
+	resp, body := server.do(t, http.MethodGet, "/metrics", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /metrics status = %d: %s", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", got)
+	}
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sample, value, ok := strings.Cut(line, " ")
+		number, err := strconv.ParseFloat(value, 64)
+		if !ok || err != nil {
+			t.Fatalf("malformed sample %q", line)
+		}
+		samples[sample] = number
+	}
+	return samples, string(body)
+}
+
+func TestRequestMetrics(t *testing.T) {
+	server := newTestServer(t)
+	before, _ := scrape(t, server)
+
+	for range 3 {
+		server.do(t, http.MethodGet, "/menu/latte", "")
+	}
+	server.do(t, http.MethodGet, "/menu/scone", "")
+	server.do(t, http.MethodGet, "/nope", "")
+	after, text := scrape(t, server)
+
+	for _, family := range []string{
+		"# TYPE hotcoffee_http_requests_total counter",
+		"# TYPE hotcoffee_http_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(text, family+"\n") {
+			t.Errorf("/metrics has no %q line", family)
+		}
+	}
+
+	// Requests are counted by route pattern, not by the path they asked for
+	counters := map[string]float64{
+		`hotcoffee_http_requests_total{method="GET",route="/menu/{id}",status="200"}`: 3,
+		`hotcoffee_http_requests_total{method="GET",route="/menu/{id}",status="404"}`: 1,
+		`hotcoffee_http_requests_total{method="GET",route="unmatched",status="404"}`:  1,
+	}
+	for sample, want := range counters {
+		if got := after[sample] - before[sample]; got != want {
+			t.Errorf("%s went up by %v, want %v", sample, got, want)
+		}
+	}
+
+	const series = `method="GET",route="/menu/{id}",status="200"`
+	count := `hotcoffee_http_request_duration_seconds_count{` + series + `}`
+	sum := `hotcoffee_http_request_duration_seconds_sum{` + series + `}`
+	if got := after[count] - before[count]; got != 3 {
+		t.Errorf("%s went up by %v, want 3", count, got)
+	}
+	if after[sum] <= before[sum] {
+		t.Errorf("%s did not grow: %v then %v", sum, before[sum], after[sum])
+	}
+	// Buckets are cumulative and the +Inf bucket holds every observation
+	var buckets []float64
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, `hotcoffee_http_request_duration_seconds_bucket{`+series+`,le="`) {
+			sample, _, _ := strings.Cut(line, " ")
+			buckets = append(buckets, after[sample])
+		}
+	}
+	if len(buckets) < 2 {
+		t.Fatalf("found %d buckets for %s", len(buckets), series)
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] < buckets[i-1] {
+			t.Errorf("bucket %d holds %v, fewer than the %v before it", i, buckets[i], buckets[i-1])
+		}
+	}
+	inf := `hotcoffee_http_request_duration_seconds_bucket{` + series + `,le="+Inf"}`
+	if after[inf] != after[count] {
+		t.Errorf("%s = %v, want the count %v", inf, after[inf], after[count])
+	}
+}
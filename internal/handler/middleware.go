@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hot-coffee/internal/logging"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+const maxRequestIDLength = 128
+
+// RequestID gives every request an ID for correlating its log records. An X-Request-ID
+// sent by the client (or a proxy in front of the server) is kept when it is reasonable,
+// otherwise a new one is made. The ID is echoed in the X-Request-ID response header and
+// stored in the request context, where the logging handler picks it up.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID accepts IDs of printable ASCII without spaces, so they are safe to
+// echo and to log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AccessLog logs one record per request once it is answered, with the route it matched,
+// the status, the size of the body and how long it took. Server errors are logged as
+// errors.
+func AccessLog(router *Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		// Deferred so requests whose handler panicked are logged as well
+		defer func() {
+			level := slog.LevelInfo
+			if sw.status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			slog.LogAttrs(r.Context(), level, "Request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", router.Pattern(r)),
+				slog.Int("status", sw.statusCode()),
+				slog.Int64("bytes", sw.bytes),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote", r.RemoteAddr))
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// Recover turns a panic in a handler into a logged stack trace and a 500 response, so
+// one bad request cannot take the connection down without a trace. When the response
+// has already started the connection is aborted instead, because a half-written body
+// cannot be turned into an error.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			slog.ErrorContext(r.Context(), "Handler panicked", slog.String("method", r.Method), slog.String("path", r.URL.Path),
+				slog.String("panic", fmt.Sprint(recovered)), slog.String("stack", string(debug.Stack())))
+			if sw.status != 0 || sw.hijacked {
+				panic(http.ErrAbortHandler)
+			}
+			respondWithError(sw, "An unexpected error occurred", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// LimitBody rejects request bodies larger than maxBytes with 413. Bodies that announce
+// their size are refused up front; the others fail to read once they go past the limit.
+func LimitBody(maxBytes int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBytes {
+			respondWithError(w, fmt.Sprintf("Request body is larger than %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// unheldRoutes do not hold writes. POST /admin/backup takes the snapshot itself, which
+// waits for the held writes to finish.
+var unheldRoutes = map[string]bool{
+	"POST /admin/backup": true,
+}
+
+// HoldWrites runs requests that may change data under hold, which keeps a backup from
+// being taken while they are in flight, so a snapshot never catches an order that has
+// taken its stock but is not saved yet.
+func HoldWrites(hold func() (release func()), router *Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isMutating(r.Method) || unheldRoutes[router.Pattern(r)] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		release := hold()
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isBodyTooLarge reports whether reading a request body failed because of LimitBody.
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// statusWriter remembers the status and body size of a response. It passes flushes and
+// hijacks through so event streams and WebSocket upgrades still work behind it.
+type statusWriter struct {
+	http.ResponseWriter
+	status   int
+	bytes    int64
+	hijacked bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 && code >= http.StatusOK {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		flusher.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// statusCode is the status sent, 101 for a connection taken over by a WebSocket and 200
+// when the handler wrote nothing at all.
+func (w *statusWriter) statusCode() int {
+	switch {
+	case w.hijacked:
+		return http.StatusSwitchingProtocols
+	case w.status == 0:
+		return http.StatusOK
+	}
+	return w.status
+}
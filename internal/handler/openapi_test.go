@@ -0,0 +1,277 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSpecDescribesEveryRoute(t *testing.T) {
+	server := newTestServer(t)
+
+	undocumented, missing, err := CheckSpec(server.router.Patterns())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range undocumented {
+		t.Errorf("route %s is missing from openapi.json", route)
+	}
+	for _, operation := range missing {
+		t.Errorf("openapi.json describes %s, which no handler registers", operation)
+	}
+}
+
+// specChecker checks responses against the operations of the OpenAPI document.
+type specChecker struct {
+	spec struct {
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas   map[string]map[string]any `json:"schemas"`
+			Responses map[string]specResponse   `json:"responses"`
+		} `json:"components"`
+	}
+}
+
+type specResponse struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema map[string]any `json:"schema"`
+	} `json:"content"`
+}
+
+func newSpecChecker(t *testing.T) *specChecker {
+	t.Helper()
+	c := &specChecker{}
+	if err := json.Unmarshal(openAPISpec, &c.spec); err != nil {
+		t.Fatalf("openapi.json does not parse: %v", err)
+	}
+	return c
+}
+
+// check returns how the response to an operation, given as its route pattern, differs
+// from what the document says: an undocumented status, content type, or a body that
+// does not follow the schema.
+func (c *specChecker) check(pattern string, resp *http.Response, body []byte) []string {
+	method, path, _ := strings.Cut(pattern, " ")
+	var operation struct {
+		Responses map[string]specResponse `json:"responses"`
+	}
+	if err := json.Unmarshal(c.spec.Paths[path][strings.ToLower(method)], &operation); err != nil {
+		return []string{"operation is not in openapi.json"}
+	}
+	documented, ok := operation.Responses[strconv.Itoa(resp.StatusCode)]
+	if !ok {
+		return []string{fmt.Sprintf("status %d is not documented", resp.StatusCode)}
+	}
+	if documented.Ref != "" {
+		documented = c.spec.Components.Responses[strings.TrimPrefix(documented.Ref, "#/components/responses/")]
+	}
+	if len(documented.Content) == 0 {
+		if len(body) > 0 && resp.StatusCode != http.StatusSwitchingProtocols {
+			return []string{fmt.Sprintf("status %d is documented without a body, got %q", resp.StatusCode, body)}
+		}
+		return nil
+	}
+
+	contentType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	content, ok := documented.Content[contentType]
+	if !ok {
+		return []string{fmt.Sprintf("status %d is not documented with Content-Type %q", resp.StatusCode, contentType)}
+	}
+	if content.Schema == nil || !strings.HasSuffix(contentType, "json") {
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return []string{fmt.Sprintf("body %q is not JSON: %v", body, err)}
+	}
+	return c.validate(content.Schema, value, "body")
+}
+
+// validate checks value against the parts of JSON Schema openapi.json uses.
+func (c *specChecker) validate(schema map[string]any, value any, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, ok := c.spec.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]
+		if !ok {
+			return []string{fmt.Sprintf("%s: unknown schema %s", at, ref)}
+		}
+		return c.validate(resolved, value, at)
+	}
+
+	var problems []string
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, value) {
+		problems = append(problems, fmt.Sprintf("%s: %v is not one of %v", at, value, enum))
+	}
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: want an object, got %T", at, value))
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: required property %s is missing", at, name))
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := properties[name].(map[string]any)
+			switch {
+			case ok && property["writeOnly"] == true:
+				problems = append(problems, fmt.Sprintf("%s: write-only property %s is in a response", at, name))
+			case ok:
+				problems = append(problems, c.validate(property, object[name], at+"."+name)...)
+			default:
+				additional, isSchema := schema["additionalProperties"].(map[string]any)
+				if isSchema {
+					problems = append(problems, c.validate(additional, object[name], at+"."+name)...)
+				} else if len(properties) > 0 {
+					problems = append(problems, fmt.Sprintf("%s: property %s is not in the schema", at, name))
+				}
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return append(problems, fmt.Sprintf("%s: want an array, got %T", at, value))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range array {
+				problems = append(problems, c.validate(items, item, fmt.Sprintf("%s[%d]", at, i))...)
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			problems = append(problems, fmt.Sprintf("%s: want a string, got %T", at, value))
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			problems = append(problems, fmt.Sprintf("%s: want a number, got %T", at, value))
+		}
+	case "integer":
+		if number, ok := value.(float64); !ok || number != float64(int64(number)) {
+			problems = append(problems, fmt.Sprintf("%s: want an integer, got %v", at, value))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			problems = append(problems, fmt.Sprintf("%s: want a boolean, got %T", at, value))
+		}
+	}
+	return problems
+}
+
+func TestResponsesMatchSpec(t *testing.T) {
+	server := newTestServer(t)
+	checker := newSpecChecker(t)
+
+	// Each step is sent in turn, and may use IDs taken from earlier responses
+	ids := make(map[string]string)
+	steps := []struct {
+		method, path, body string
+		header             []string
+		status             int
+		// save names an ID to take from the response, as "name=json_field"
+		save string
+	}{
+		{method: "GET", path: "/healthz", status: 200},
+		{method: "GET", path: "/readyz", status: 200},
+		{method: "GET", path: "/auth/me", status: 200},
+		{method: "POST", path: "/auth/api-keys", body: `{"name":"till"}`, status: 201, save: "key=key_id"},
+		{method: "GET", path: "/auth/api-keys", status: 200},
+		{method: "DELETE", path: "/auth/api-keys/{key}", status: 204},
+		{method: "POST", path: "/users", body: `{"username":"ann","password":"long-enough-1","role":"cashier"}`, status: 201, save: "user=user_id"},
+		{method: "GET", path: "/users", status: 200},
+		{method: "GET", path: "/users/{user}", status: 200},
+		{method: "GET", path: "/users/nobody", status: 404},
+
+		{method: "GET", path: "/inventory", status: 200},
+		{method: "GET", path: "/inventory/espresso_shot", status: 200},
+		{method: "POST", path: "/inventory", body: `{"ingredient_id":"milk","name":"Milk","quantity":5000,"unit":"ml","reorder_level":500}`, status: 201},
+		{method: "PUT", path: "/inventory/milk", body: `{"name":"Milk","quantity":4000,"unit":"ml"}`, header: []string{"If-Match", `"1"`}, status: 200},
+		{method: "PUT", path: "/inventory/milk", body: `{"name":"Milk","quantity":3000,"unit":"ml"}`, header: []string{"If-Match", `"1"`}, status: 412},
+		{method: "GET", path: "/menu", status: 200},
+		{method: "GET", path: "/menu/latte", status: 200},
+		{method: "POST", path: "/menu", body: `{"product_id":"flat_white","name":"Flat White","description":"Strong","price":3.5,"ingredients":[{"ingredient_id":"espresso_shot","quantity":2},{"ingredient_id":"milk","quantity":120}]}`, status: 201},
+		{method: "PUT", path: "/menu/flat_white", body: `{"name":"Flat White","description":"Stronger","price":3.75,"ingredients":[{"ingredient_id":"espresso_shot","quantity":2}]}`, status: 200},
+		{method: "GET", path: "/menu/scone", status: 404},
+
+		{method: "POST", path: "/customers", body: `{"name":"Bob","phone":"+15550001"}`, status: 201, save: "customer=customer_id"},
+		{method: "GET", path: "/customers", status: 200},
+		{method: "GET", path: "/customers/{customer}", status: 200},
+		{method: "POST", path: "/shifts/open", body: `{"opening_cash":100}`, status: 201},
+		{method: "GET", path: "/shifts/current", status: 200},
+		{method: "POST", path: "/orders", body: `{"customer_id":"{customer}","items":[{"product_id":"latte","quantity":2},{"product_id":"flat_white","quantity":1}]}`, status: 201, save: "order=order_id"},
+		{method: "DELETE", path: "/customers/{customer}", status: 409},
+		{method: "POST", path: "/orders", body: `{"customer_name":"Eve","items":[{"product_id":"latte","quantity":1000}]}`, status: 409},
+		{method: "POST", path: "/orders", body: `not json`, status: 400},
+		{method: "GET", path: "/orders", status: 200},
+		{method: "GET", path: "/orders/{order}", status: 200},
+		{method: "PUT", path: "/orders/{order}", body: `{"items":[{"product_id":"latte","quantity":3}]}`, status: 200},
+		{method: "GET", path: "/queue", status: 200},
+		{method: "POST", path: "/queue/{order}/lines/0/start", status: 200},
+		{method: "POST", path: "/queue/{order}/lines/0/done", status: 200},
+		{method: "POST", path: "/orders/{order}/close", body: `{"payment_type":"card"}`, status: 200},
+		{method: "PUT", path: "/orders/{order}", body: `{"items":[{"product_id":"latte","quantity":1}]}`, status: 409},
+		{method: "POST", path: "/orders/{order}/refunds", body: `{"items":[{"product_id":"latte","quantity":1}],"reason":"spilled"}`, status: 201},
+		{method: "GET", path: "/orders/{order}/refunds", status: 200},
+		{method: "GET", path: "/orders/nope", status: 404},
+		{method: "GET", path: "/customers/{customer}/orders", status: 200},
+		{method: "GET", path: "/customers/{customer}/stats", status: 200},
+		{method: "GET", path: "/loyalty/settings", status: 200},
+		{method: "GET", path: "/loyalty/customers/{customer}", status: 200},
+		{method: "GET", path: "/loyalty/customers/{customer}/history", status: 200},
+		{method: "GET", path: "/reports/total-sales", status: 200},
+		{method: "GET", path: "/reports/popular-items", status: 200},
+		{method: "POST", path: "/shifts/close", body: `{"counted_cash":100}`, status: 200},
+
+		{method: "POST", path: "/webhooks", body: `{"url":"http://127.0.0.1:1/hook","events":["order.created"]}`, status: 201, save: "webhook=webhook_id"},
+		{method: "GET", path: "/webhooks", status: 200},
+		{method: "GET", path: "/webhooks/{webhook}", status: 200},
+		{method: "GET", path: "/webhooks/{webhook}/deliveries", status: 200},
+		{method: "DELETE", path: "/webhooks/{webhook}", status: 204},
+		{method: "GET", path: "/audit", status: 200},
+		{method: "GET", path: "/audit/verify", status: 200},
+		{method: "DELETE", path: "/menu/flat_white", header: []string{"If-Match", `"7"`}, status: 412},
+		{method: "DELETE", path: "/menu/flat_white", status: 204},
+		{method: "GET", path: "/openapi.json", status: 200},
+	}
+
+	for _, step := range steps {
+		path, body := step.path, step.body
+		for name, id := range ids {
+			path = strings.ReplaceAll(path, "{"+name+"}", id)
+			body = strings.ReplaceAll(body, "{"+name+"}", id)
+		}
+		name := step.method + " " + path
+		resp, data := server.do(t, step.method, path, body, step.header...)
+		if resp.StatusCode != step.status {
+			t.Fatalf("%s: status %d, want %d: %s", name, resp.StatusCode, step.status, data)
+		}
+
+		req, _ := http.NewRequest(step.method, path, nil)
+		pattern := server.router.Pattern(req)
+		for _, problem := range checker.check(pattern, resp, data) {
+			t.Errorf("%s (%s): %s", name, pattern, problem)
+		}
+
+		if step.save != "" {
+			key, field, _ := strings.Cut(step.save, "=")
+			id, _ := decode[map[string]any](t, data)[field].(string)
+			if id == "" {
+				t.Fatalf("%s: response has no %s: %s", name, field, data)
+			}
+			ids[key] = id
+		}
+	}
+}
@@ -4,152 +4,220 @@ import (
 	"encoding/json"
 	"hot-coffee/internal/service"
 	"hot-coffee/models"
+	"io"
 	"log/slog"
 	"net/http"
-	"strings"
 	"time"
 )
 
 type OrderHandler struct {
-	orderService *service.OrderService
+	orderService  *service.OrderService
+	refundService *service.RefundService
 }
 
-func NewOrderHandler(orderService *service.OrderService) *OrderHandler {
-	return &OrderHandler{orderService: orderService}
+func NewOrderHandler(orderService *service.OrderService, refundService *service.RefundService) *OrderHandler {
+	return &OrderHandler{orderService: orderService, refundService: refundService}
 }
 
-func (h *OrderHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	path := r.URL.Path
-	slog.Info("Received request", slog.String("method", r.Method), slog.String("path", path))
-
-	switch r.Method {
-	case http.MethodPost:
-		if strings.HasSuffix(path, "/close") {
-			h.CloseOrder(w, r)
-		} else {
-			h.CreateOrder(w, r)
-		}
-	case http.MethodGet:
-		if strings.HasPrefix(path, "/orders/") {
-			h.GetOrderByID(w, r)
-		} else {
-			h.GetAllOrders(w, r)
-		}
-	case http.MethodPut:
-		if strings.HasPrefix(path, "/orders/") {
-			h.UpdateOrder(w, r)
-		} else {
-			respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	case http.MethodDelete:
-		if strings.HasPrefix(path, "/orders/") {
-			h.DeleteOrder(w, r)
-		} else {
-			respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	default:
-		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
-	}
+// RegisterRoutes adds the order and refund routes to mux.
+func (h *OrderHandler) RegisterRoutes(mux Mux) {
+	mux.HandleFunc("POST /orders", h.CreateOrder)
+	mux.HandleFunc("GET /orders", h.GetAllOrders)
+	mux.HandleFunc("GET /orders/{id}", h.GetOrderByID)
+	mux.HandleFunc("PUT /orders/{id}", h.UpdateOrder)
+	mux.HandleFunc("DELETE /orders/{id}", h.DeleteOrder)
+	mux.HandleFunc("POST /orders/{id}/close", h.CloseOrder)
+	mux.HandleFunc("POST /orders/{id}/refunds", h.CreateRefund)
+	mux.HandleFunc("GET /orders/{id}/refunds", h.GetRefunds)
 }
 
 func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	var order models.Order
 	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		slog.Error("Failed to decode order", slog.String("error", err.Error()))
+		slog.ErrorContext(r.Context(), "Failed to decode order", slog.String("error", err.Error()))
 		respondWithError(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
 	order.Status = "open"
 	order.CreatedAt = time.Now().Format(time.RFC3339)
+	// Payment details and totals are only set by the shop when the order is closed
+	order.ClosedAt, order.PaymentType, order.Discount, order.Total = "", "", 0, 0
 
-	if err := h.orderService.CreateOrder(&order); err != nil {
-		slog.Error("Failed to create order", slog.String("error", err.Error()))
-		respondWithError(w, err.Error(), http.StatusNotFound)
+	if err := h.orderService.CreateOrder(r.Context(), &order); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to create order", slog.String("error", err.Error()))
+		respondWithServiceError(w, err)
 		return
 	}
 
-	slog.Info("Order created successfully", slog.String("orderID", order.ID))
+	slog.InfoContext(r.Context(), "Order created successfully", slog.String("orderID", order.ID))
+	w.Header().Set("ETag", versionETag(order.Version))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(order)
 }
 
 func (h *OrderHandler) CloseOrder(w http.ResponseWriter, r *http.Request) {
-	orderID := strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/close"), "/orders/")
-	slog.Info("Closing order", slog.String("orderID", orderID))
+	orderID := r.PathValue("id")
+	slog.InfoContext(r.Context(), "Closing order", slog.String("orderID", orderID))
+
+	// The payment type is optional and defaults to cash
+	var payment struct {
+		PaymentType string `json:"payment_type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil && err != io.EOF {
+		slog.ErrorContext(r.Context(), "Failed to decode close request", slog.String("error", err.Error()))
+		respondWithError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
 
-	if err := h.orderService.CloseOrder(orderID); err != nil {
-		slog.Error("Failed to close order", slog.String("orderID", orderID), slog.String("error", err.Error()))
-		respondWithError(w, err.Error(), http.StatusNotFound)
+	if err := h.orderService.CloseOrder(r.Context(), orderID, payment.PaymentType); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to close order", slog.String("orderID", orderID), slog.String("error", err.Error()))
+		respondWithServiceError(w, err)
 		return
 	}
 
-	slog.Info("Order closed successfully", slog.String("orderID", orderID))
+	slog.InfoContext(r.Context(), "Order closed successfully", slog.String("orderID", orderID))
 	respondWithJSON(w, map[string]string{"message": "Order closed successfully"}, http.StatusOK)
 }
 
+func (h *OrderHandler) CreateRefund(w http.ResponseWriter, r *http.Request) {
+	orderID := r.PathValue("id")
+	var refund models.Refund
+	if err := json.NewDecoder(r.Body).Decode(&refund); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to decode refund", slog.String("error", err.Error()))
+		respondWithError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	slog.InfoContext(r.Context(), "Refunding order", slog.String("orderID", orderID), slog.String("reason", refund.Reason))
+
+	if refund.Reason == "" {
+		respondWithError(w, "Refund reason is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.refundService.CreateRefund(r.Context(), orderID, &refund); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to refund order", slog.String("orderID", orderID), slog.String("error", err.Error()))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Order refunded successfully", slog.String("orderID", orderID), slog.String("refundID", refund.ID), slog.Float64("amount", refund.Amount))
+	respondWithJSON(w, refund, http.StatusCreated)
+}
+
+func (h *OrderHandler) GetRefunds(w http.ResponseWriter, r *http.Request) {
+	orderID := r.PathValue("id")
+	slog.InfoContext(r.Context(), "Fetching refunds", slog.String("orderID", orderID))
+
+	refunds, err := h.refundService.GetRefundsByOrderID(orderID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to retrieve refunds", slog.String("orderID", orderID), slog.String("error", err.Error()))
+		respondWithServiceError(w, err)
+		return
+	}
+	if refunds == nil {
+		refunds = []models.Refund{}
+	}
+	respondWithJSON(w, refunds, http.StatusOK)
+}
+
+// GetAllOrders lists orders, filtered by status, customer (ID or name), product_id and
+// a from/to creation date range.
 func (h *OrderHandler) GetAllOrders(w http.ResponseWriter, r *http.Request) {
-	slog.Info("Fetching all orders")
-	orders, err := h.orderService.GetAllOrders()
+	slog.InfoContext(r.Context(), "Fetching orders", slog.String("query", r.URL.RawQuery))
+	page, err := parsePage(r)
 	if err != nil {
-		slog.Error("Failed to retrieve orders", slog.String("error", err.Error()))
-		http.Error(w, "Failed to retrieve orders", http.StatusInternalServerError)
+		respondWithServiceError(w, err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(orders)
+	params := r.URL.Query()
+	query := models.OrderQuery{
+		Status:    params.Get("status"),
+		Customer:  params.Get("customer"),
+		ProductID: params.Get("product_id"),
+		From:      params.Get("from"),
+		To:        params.Get("to"),
+		Sort:      parseSort(r),
+		Page:      page,
+	}
+
+	orders, err := h.orderService.QueryOrders(query)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to retrieve orders", slog.String("error", err.Error()))
+		respondWithServiceError(w, err)
+		return
+	}
+	respondWithListETag(w, r, orders)
 }
 
 func (h *OrderHandler) GetOrderByID(w http.ResponseWriter, r *http.Request) {
-	id := strings.TrimPrefix(r.URL.Path, "/orders/")
-	slog.Info("Fetching order by ID", slog.String("orderID", id))
+	id := r.PathValue("id")
+	slog.InfoContext(r.Context(), "Fetching order by ID", slog.String("orderID", id))
 	order, err := h.orderService.GetOrderByID(id)
 	if err != nil {
-		slog.Error("Order not found", slog.String("orderID", id))
-		respondWithError(w, "Order not found", http.StatusNotFound)
+		slog.ErrorContext(r.Context(), "Failed to retrieve order", slog.String("orderID", id), slog.String("error", err.Error()))
+		respondWithServiceError(w, err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(order)
+	respondWithETag(w, r, order, versionETag(order.Version))
 }
 
 func (h *OrderHandler) DeleteOrder(w http.ResponseWriter, r *http.Request) {
-	orderID := strings.TrimPrefix(r.URL.Path, "/orders/")
-	slog.Info("Deleting order", slog.String("orderID", orderID))
+	orderID := r.PathValue("id")
+	slog.InfoContext(r.Context(), "Deleting order", slog.String("orderID", orderID))
 
-	if err := h.orderService.DeleteOrder(orderID); err != nil {
-		slog.Error("Failed to delete order", slog.String("orderID", orderID), slog.String("error", err.Error()))
-		if err.Error() == "order not found" {
-			respondWithError(w, "Order not found", http.StatusNotFound)
-		} else {
-			respondWithError(w, "Failed to delete order", http.StatusInternalServerError)
-		}
+	current, err := h.orderService.GetOrderByID(orderID)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	version, err := ifMatchVersion(r, current.Version)
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	if err := h.orderService.DeleteOrder(r.Context(), orderID, version); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to delete order", slog.String("orderID", orderID), slog.String("error", err.Error()))
+		respondWithServiceError(w, err)
 		return
 	}
 
-	slog.Info("Order deleted successfully", slog.String("orderID", orderID))
+	slog.InfoContext(r.Context(), "Order deleted successfully", slog.String("orderID", orderID))
 	respondWithJSON(w, "Order deleted successfully", http.StatusNoContent)
 }
 
 func (h *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
-	orderID := strings.TrimPrefix(r.URL.Path, "/orders/")
+	orderID := r.PathValue("id")
 	var updatedOrder models.Order
-	slog.Info("Updating order", slog.String("orderID", orderID))
+	slog.InfoContext(r.Context(), "Updating order", slog.String("orderID", orderID))
 
 	if err := json.NewDecoder(r.Body).Decode(&updatedOrder); err != nil {
-		slog.Error("Failed to decode update data", slog.String("error", err.Error()))
+		slog.ErrorContext(r.Context(), "Failed to decode update data", slog.String("error", err.Error()))
 		respondWithError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	existingOrder, err := h.orderService.GetOrderByID(orderID)
 	if err != nil {
-		slog.Error("Order not found", slog.String("orderID", orderID))
-		respondWithError(w, "Order not found", http.StatusNotFound)
+		slog.ErrorContext(r.Context(), "Failed to retrieve order", slog.String("orderID", orderID), slog.String("error", err.Error()))
+		respondWithServiceError(w, err)
+		return
+	}
+	version, err := ifMatchVersion(r, existingOrder.Version)
+	if err != nil {
+		respondWithServiceError(w, err)
 		return
 	}
+	// The version the client last saw, from If-Match or the body
+	if version != 0 {
+		existingOrder.Version = version
+	} else if updatedOrder.Version != 0 {
+		existingOrder.Version = updatedOrder.Version
+	}
 
+	if updatedOrder.CustomerID != "" {
+		existingOrder.CustomerID = updatedOrder.CustomerID
+	}
 	if updatedOrder.CustomerName != "" {
 		existingOrder.CustomerName = updatedOrder.CustomerName
 	}
@@ -157,15 +225,14 @@ func (h *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
 		existingOrder.Items = updatedOrder.Items
 	}
 
-	existingOrder.CreatedAt = time.Now().Format(time.RFC3339)
-
-	if err := h.orderService.UpdateOrder(existingOrder); err != nil {
-		slog.Error("Failed to update order", slog.String("orderID", orderID), slog.String("error", err.Error()))
-		respondWithError(w, "Failed to update order: "+err.Error(), http.StatusInternalServerError)
+	if err := h.orderService.UpdateOrder(r.Context(), existingOrder); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to update order", slog.String("orderID", orderID), slog.String("error", err.Error()))
+		respondWithServiceError(w, err)
 		return
 	}
 
-	slog.Info("Order updated successfully", slog.String("orderID", orderID))
+	slog.InfoContext(r.Context(), "Order updated successfully", slog.String("orderID", orderID))
+	w.Header().Set("ETag", versionETag(existingOrder.Version))
 	respondWithJSON(w, existingOrder, http.StatusOK)
 }
 
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"hot-coffee/internal/dal"
+	"hot-coffee/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestUpdateOrderKeepsQueuePlaceAndProgress(t *testing.T) {
+	server := newTestServer(t)
+	resp, body := server.do(t, http.MethodPost, "/orders", `{"customer_name":"Ann","items":[{"product_id":"latte","quantity":1},{"product_id":"latte","quantity":2}]}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", resp.StatusCode, body)
+	}
+	orderID := decode[models.Order](t, body).ID
+
+	// Date the order back so an edit that restamps it would show
+	repo := &dal.FileOrderRepository{}
+	orders, err := repo.LoadOrders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	createdAt := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	orders[0].CreatedAt = createdAt
+	if err := repo.SaveOrders(orders); err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range []string{"/queue/" + orderID + "/lines/0/done", "/queue/" + orderID + "/lines/1/start"} {
+		if resp, body := server.do(t, http.MethodPost, step, ""); resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST %s status = %d: %s", step, resp.StatusCode, body)
+		}
+	}
+
+	// The finished line is kept, the started one changes quantity and a line is added
+	resp, body = server.do(t, http.MethodPut, "/orders/"+orderID,
+		`{"items":[{"product_id":"latte","quantity":3,"prep_status":"done"},{"product_id":"latte","quantity":1},{"product_id":"latte","quantity":1}]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("update status = %d: %s", resp.StatusCode, body)
+	}
+	updated := decode[models.Order](t, body)
+	if updated.CreatedAt != createdAt {
+		t.Errorf("created_at = %q after the edit, want %q", updated.CreatedAt, createdAt)
+	}
+	want := []string{"", models.PrepDone, ""}
+	for i, item := range updated.Items {
+		if item.PrepStatus != want[i] {
+			t.Errorf("line %d prep_status = %q, want %q", i, item.PrepStatus, want[i])
+		}
+	}
+	if updated.Items[1].DoneAt == "" || updated.Items[1].StartedAt == "" {
+		t.Errorf("the finished line lost its times: %+v", updated.Items[1])
+	}
+}
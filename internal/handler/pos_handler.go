@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hot-coffee/internal/events"
+	"hot-coffee/internal/service"
+	"hot-coffee/internal/websocket"
+	"hot-coffee/models"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// posPingInterval is how often the server pings a terminal.
+	posPingInterval = 30 * time.Second
+	// posPongWait is how long a terminal may stay silent before it is considered gone.
+	posPongWait = 2 * posPingInterval
+)
+
+// posMessage is the envelope of every message on the POS WebSocket, in both directions.
+type posMessage struct {
+	Type      string        `json:"type"`
+	RequestID string        `json:"request_id,omitempty"`
+	Order     *models.Order `json:"order,omitempty"`
+	Event     string        `json:"event,omitempty"`
+	OrderID   string        `json:"order_id,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Code      string        `json:"code,omitempty"`
+}
+
+// POSHandler serves the WebSocket endpoint used by the order-taking terminals.
+type POSHandler struct {
+	orderService *service.OrderService
+	bus          *events.Bus
+	// holdWrites keeps backups out while an order from a terminal is created.
+	holdWrites func() (release func())
+	// requireClientCert turns away terminals that did not present a verified TLS
+	// client certificate.
+	requireClientCert bool
+}
+
+func NewPOSHandler(orderService *service.OrderService, bus *events.Bus, holdWrites func() (release func()), requireClientCert bool) *POSHandler {
+	return &POSHandler{orderService: orderService, bus: bus, holdWrites: holdWrites, requireClientCert: requireClientCert}
+}
+
+// RegisterRoutes adds the terminal endpoint to mux.
+func (h *POSHandler) RegisterRoutes(mux Mux) {
+	mux.Handle("GET /pos", h)
+}
+
+func (h *POSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.requireClientCert && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		slog.WarnContext(r.Context(), "POS terminal without a client certificate turned away", slog.String("remote", r.RemoteAddr))
+		respondWithError(w, "POS terminals must present a client certificate", http.StatusForbidden)
+		return
+	}
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "WebSocket handshake failed", slog.String("remote", r.RemoteAddr), slog.String("error", err.Error()))
+		respondWithError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	slog.InfoContext(r.Context(), "POS terminal connected", slog.String("remote", r.RemoteAddr))
+
+	session := &posSession{
+		ctx:          r.Context(),
+		conn:         conn,
+		orderService: h.orderService,
+		holdWrites:   h.holdWrites,
+		orders:       make(map[string]bool),
+	}
+	session.run(h.bus)
+	slog.InfoContext(r.Context(), "POS terminal disconnected", slog.String("remote", r.RemoteAddr))
+}
+
+// posSession is one connected terminal. It remembers the orders the terminal created
+// so it only gets pushed updates for those.
+type posSession struct {
+	// ctx identifies the signed-in user of the terminal in the audit log
+	ctx          context.Context
+	conn         *websocket.Conn
+	orderService *service.OrderService
+	holdWrites   func() (release func())
+	mu           sync.Mutex
+	orders       map[string]bool
+}
+
+func (s *posSession) run(bus *events.Bus) {
+	defer s.conn.Close()
+
+	_, stream, unsubscribe := bus.Subscribe(0)
+	defer unsubscribe()
+	done := make(chan struct{})
+	defer close(done)
+	go s.pushUpdates(stream, done)
+
+	s.conn.SetReadDeadline(time.Now().Add(posPongWait))
+	s.conn.OnPong = func() {
+		s.conn.SetReadDeadline(time.Now().Add(posPongWait))
+	}
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if !errors.Is(err, websocket.ErrClosed) {
+				s.conn.WriteClose(websocket.CloseGoingAway, "")
+			}
+			return
+		}
+		s.conn.SetReadDeadline(time.Now().Add(posPongWait))
+
+		var message posMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			s.send(posMessage{Type: "error", Error: "invalid message: " + err.Error()})
+			continue
+		}
+
+		switch message.Type {
+		case "submit_order":
+			s.submitOrder(message)
+		case "ping":
+			s.send(posMessage{Type: "pong", RequestID: message.RequestID})
+		default:
+			s.send(posMessage{Type: "error", RequestID: message.RequestID, Error: "unknown message type " + message.Type})
+		}
+	}
+}
+
+func (s *posSession) submitOrder(message posMessage) {
+	if message.Order == nil {
+		s.send(posMessage{Type: "order_rejected", RequestID: message.RequestID, Error: "order is required"})
+		return
+	}
+
+	order := *message.Order
+	order.Status = "open"
+	order.ClosedAt, order.PaymentType, order.Discount, order.Total = "", "", 0, 0
+	// The terminal's connection stays open, so HoldWrites does not cover its orders
+	release := s.holdWrites()
+	err := s.orderService.CreateOrder(s.ctx, &order)
+	release()
+	if err != nil {
+		slog.ErrorContext(s.ctx, "Failed to create order from POS", slog.String("requestID", message.RequestID), slog.String("error", err.Error()))
+		s.send(posMessage{Type: "order_rejected", RequestID: message.RequestID, Error: err.Error(), Code: problemFor(err).Code})
+		return
+	}
+
+	s.mu.Lock()
+	s.orders[order.ID] = true
+	s.mu.Unlock()
+	slog.InfoContext(s.ctx, "Order created from POS", slog.String("orderID", order.ID), slog.String("requestID", message.RequestID))
+	s.send(posMessage{Type: "order_accepted", RequestID: message.RequestID, Order: &order})
+}
+
+// pushUpdates forwards events about this terminal's orders and keeps the connection alive with pings.
+func (s *posSession) pushUpdates(stream <-chan events.Event, done <-chan struct{}) {
+	ping := time.NewTicker(posPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ping.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case event, ok := <-stream:
+			if !ok {
+				// The event bus closes when the server stops
+				s.conn.WriteClose(websocket.CloseGoingAway, "server shutting down")
+				return
+			}
+			// The terminal already got the new order in its order_accepted reply
+			if event.Type == events.OrderCreated {
+				continue
+			}
+			message := posMessage{Type: "order_update", Event: event.Type}
+			switch data := event.Data.(type) {
+			case models.Order:
+				message.OrderID, message.Order = data.ID, &data
+			case map[string]string:
+				message.OrderID = data["order_id"]
+			}
+
+			s.mu.Lock()
+			tracked := s.orders[message.OrderID]
+			s.mu.Unlock()
+			if tracked {
+				s.send(message)
+			}
+		}
+	}
+}
+
+func (s *posSession) send(message posMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		slog.ErrorContext(s.ctx, "Failed to encode POS message", slog.String("error", err.Error()))
+		return
+	}
+	if err := s.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		slog.WarnContext(s.ctx, "Failed to send POS message", slog.String("type", message.Type), slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hot-coffee/internal/events"
+	"hot-coffee/internal/websocket"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// posClient is the terminal's end of the POS WebSocket: it masks what it sends, as
+// clients must, and reads the server's unmasked frames.
+type posClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialPOS(t *testing.T, server *testServer) *posClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/pos", nil)
+	req.Header.Set("Authorization", "Bearer "+server.token)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %d, want 101", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Sec-WebSocket-Accept = %q", got)
+	}
+	return &posClient{conn: conn, reader: reader}
+}
+
+func (c *posClient) writeFrame(t *testing.T, opcode int, payload []byte) {
+	t.Helper()
+	frame := []byte{0x80 | byte(opcode)}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = binary.BigEndian.AppendUint16(append(frame, 0x80|126), uint16(len(payload)))
+	}
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *posClient) readFrame(t *testing.T) (int, []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			t.Fatal(err)
+		}
+		length = int(binary.BigEndian.Uint16(extended[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	return int(header[0] & 0x0f), payload
+}
+
+func (c *posClient) send(t *testing.T, message string) {
+	t.Helper()
+	c.writeFrame(t, websocket.TextMessage, []byte(message))
+}
+
+func (c *posClient) receive(t *testing.T) posMessage {
+	t.Helper()
+	opcode, payload := c.readFrame(t)
+	if opcode != websocket.TextMessage {
+		t.Fatalf("got frame with opcode %d, want a text message", opcode)
+	}
+	var message posMessage
+	if err := json.Unmarshal(payload, &message); err != nil {
+		t.Fatalf("message %q does not decode: %v", payload, err)
+	}
+	return message
+}
+
+func TestPOSSubmitOrder(t *testing.T) {
+	server := newTestServer(t)
+	client := dialPOS(t, server)
+
+	client.send(t, `{"type":"submit_order","request_id":"r1","order":{"customer_name":"Ann","items":[{"product_id":"latte","quantity":2}]}}`)
+	reply := client.receive(t)
+	if reply.Type != "order_accepted" || reply.RequestID != "r1" {
+		t.Fatalf("reply = %+v, want order_accepted for r1", reply)
+	}
+	if reply.Order == nil || reply.Order.ID == "" || reply.Order.Status != "open" || reply.Order.CustomerName != "Ann" {
+		t.Fatalf("accepted order = %+v", reply.Order)
+	}
+	stored, err := server.orders.GetOrderByID(reply.Order.ID)
+	if err != nil {
+		t.Fatalf("accepted order was not saved: %v", err)
+	}
+	if len(stored.Items) != 1 || stored.Items[0].Quantity != 2 {
+		t.Fatalf("saved order items = %+v", stored.Items)
+	}
+}
+
+func TestPOSRejectedOrder(t *testing.T) {
+	server := newTestServer(t)
+	client := dialPOS(t, server)
+
+	tests := []struct {
+		name     string
+		message  string
+		wantCode string
+	}{
+		{"unknown product", `{"type":"submit_order","request_id":"r1","order":{"customer_name":"Ann","items":[{"product_id":"scone","quantity":1}]}}`, "product_not_found"},
+		{"out of stock", `{"type":"submit_order","request_id":"r1","order":{"customer_name":"Ann","items":[{"product_id":"latte","quantity":500}]}}`, "insufficient_stock"},
+		{"no order", `{"type":"submit_order","request_id":"r1"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client.send(t, tt.message)
+			reply := client.receive(t)
+			if reply.Type != "order_rejected" || reply.RequestID != "r1" {
+				t.Fatalf("reply = %+v, want order_rejected for r1", reply)
+			}
+			if reply.Code != tt.wantCode || reply.Error == "" {
+				t.Errorf("rejection code = %q, error = %q; want code %q and an error", reply.Code, reply.Error, tt.wantCode)
+			}
+		})
+	}
+
+	orders, err := server.orders.GetAllOrders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 0 {
+		t.Errorf("rejected orders were saved: %+v", orders)
+	}
+}
+
+func TestPOSPushesStatusUpdates(t *testing.T) {
+	server := newTestServer(t)
+	client := dialPOS(t, server)
+
+	client.send(t, `{"type":"submit_order","request_id":"r1","order":{"customer_name":"Ann","items":[{"product_id":"latte","quantity":1}]}}`)
+	accepted := client.receive(t)
+	if accepted.Type != "order_accepted" {
+		t.Fatalf("reply = %+v, want order_accepted", accepted)
+	}
+	orderID := accepted.Order.ID
+
+	// Another terminal's order must not be pushed to this one
+	server.bus.Publish(events.OrderStatusChanged, map[string]string{"order_id": "order_elsewhere", "from": "open", "to": "closed"})
+	if err := server.orders.CloseOrder(context.Background(), orderID, "card"); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := client.receive(t)
+	if changed.Type != "order_update" || changed.Event != events.OrderStatusChanged || changed.OrderID != orderID {
+		t.Fatalf("first push = %+v, want %s for %s", changed, events.OrderStatusChanged, orderID)
+	}
+	closed := client.receive(t)
+	if closed.Type != "order_update" || closed.Event != events.OrderClosed || closed.OrderID != orderID {
+		t.Fatalf("second push = %+v, want %s for %s", closed, events.OrderClosed, orderID)
+	}
+	if closed.Order == nil || closed.Order.Status != "closed" || closed.Order.PaymentType != "card" {
+		t.Errorf("pushed order = %+v, want it closed and paid by card", closed.Order)
+	}
+}
+
+func TestPOSPingPong(t *testing.T) {
+	server := newTestServer(t)
+	client := dialPOS(t, server)
+
+	client.send(t, `{"type":"ping","request_id":"p1"}`)
+	if reply := client.receive(t); reply.Type != "pong" || reply.RequestID != "p1" {
+		t.Fatalf("reply = %+v, want pong for p1", reply)
+	}
+
+	client.writeFrame(t, websocket.PingMessage, []byte("are you there"))
+	opcode, payload := client.readFrame(t)
+	if opcode != websocket.PongMessage || string(payload) != "are you there" {
+		t.Fatalf("got opcode %d with %q, want a pong echoing the ping", opcode, payload)
+	}
+
+	client.send(t, `{"type":"refund_order","request_id":"x1"}`)
+	if reply := client.receive(t); reply.Type != "error" || reply.RequestID != "x1" {
+		t.Fatalf("reply = %+v, want an error for the unknown message type", reply)
+	}
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"hot-coffee/models"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// problem is an RFC 7807 problem details body. Code is a stable, machine-readable
+// name for the error; the stock fields are only set for insufficient stock.
+type problem struct {
+	Type         string   `json:"type"`
+	Title        string   `json:"title"`
+	Status       int      `json:"status"`
+	Detail       string   `json:"detail,omitempty"`
+	Code         string   `json:"code"`
+	IngredientID string   `json:"ingredient_id,omitempty"`
+	Required     *float64 `json:"required,omitempty"`
+	Available    *float64 `json:"available,omitempty"`
+	Shortfall    *float64 `json:"shortfall,omitempty"`
+}
+
+// errorStatuses maps each kind of domain error to its HTTP status.
+var errorStatuses = []struct {
+	kind   error
+	status int
+}{
+	{models.ErrNotFound, http.StatusNotFound},
+	{models.ErrValidation, http.StatusBadRequest},
+	{models.ErrConflict, http.StatusConflict},
+	{models.ErrPreconditionFailed, http.StatusPreconditionFailed},
+	{models.ErrUnprocessable, http.StatusUnprocessableEntity},
+	{models.ErrUnauthorized, http.StatusUnauthorized},
+	{models.ErrForbidden, http.StatusForbidden},
+}
+
+// respondWithError writes a problem+json body for an error detected in the handler itself.
+func respondWithError(w http.ResponseWriter, message string, status int) {
+	writeProblem(w, problem{Detail: message, Status: status, Code: statusCode(status)})
+}
+
+// respondWithServiceError writes the problem+json body for an error returned by a service.
+func respondWithServiceError(w http.ResponseWriter, err error) {
+	p := problemFor(err)
+	if p.Status == http.StatusInternalServerError {
+		slog.Error("Unexpected error", slog.String("error", err.Error()))
+	}
+	writeProblem(w, p)
+}
+
+// problemFor maps an error to its status, code and details. Errors that are not domain
+// errors become a 500 that does not reveal them.
+func problemFor(err error) problem {
+	p := problem{Status: http.StatusInternalServerError, Code: statusCode(http.StatusInternalServerError), Detail: "An unexpected error occurred"}
+	for _, mapping := range errorStatuses {
+		if errors.Is(err, mapping.kind) {
+			p.Status, p.Code, p.Detail = mapping.status, statusCode(mapping.status), err.Error()
+			break
+		}
+	}
+
+	var domainErr *models.Error
+	var stockErr *models.InsufficientStockError
+	switch {
+	case errors.As(err, &stockErr):
+		shortfall := stockErr.Shortfall()
+		p.Code = "insufficient_stock"
+		p.IngredientID, p.Required, p.Available, p.Shortfall = stockErr.IngredientID, &stockErr.Required, &stockErr.Available, &shortfall
+	case errors.As(err, &domainErr):
+		p.Code = domainErr.Code
+	}
+	return p
+}
+
+func writeProblem(w http.ResponseWriter, p problem) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// statusCode turns a status into the default error code, e.g. 404 into "not_found".
+func statusCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"fmt"
+	"hot-coffee/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// parsePage reads the limit and cursor query parameters shared by the list endpoints.
+func parsePage(r *http.Request) (models.Page, error) {
+	page := models.Page{Cursor: r.URL.Query().Get("cursor")}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > models.MaxPageLimit {
+			return page, fmt.Errorf("%w: limit must be between 1 and %d", models.ErrInvalidQuery, models.MaxPageLimit)
+		}
+		page.Limit = limit
+	}
+	return page, nil
+}
+
+// parseSort reads the sort query parameter: a field name, prefixed with "-" for descending order.
+// Which fields are allowed is up to the repository.
+func parseSort(r *http.Request) models.Sort {
+	field := r.URL.Query().Get("sort")
+	if strings.HasPrefix(field, "-") {
+		return models.Sort{Field: field[1:], Desc: true}
+	}
+	return models.Sort{Field: field}
+}
+
+// parseOptionalFloat reads a numeric query parameter, returning nil when it is absent.
+func parseOptionalFloat(r *http.Request, name string) (*float64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be a number", models.ErrInvalidQuery, name)
+	}
+	return &number, nil
+}
+
+// parseOptionalBool reads a true/false query parameter, returning false when it is absent.
+func parseOptionalBool(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%w: %s must be true or false", models.ErrInvalidQuery, name)
+	}
+	return flag, nil
+}
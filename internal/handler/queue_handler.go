@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"hot-coffee/internal/service"
+	"hot-coffee/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+type QueueHandler struct {
+	queueService *service.QueueService
+}
+
+func NewQueueHandler(queueService *service.QueueService) *QueueHandler {
+	return &QueueHandler{queueService: queueService}
+}
+
+// RegisterRoutes adds the queue routes to mux.
+func (h *QueueHandler) RegisterRoutes(mux Mux) {
+	mux.HandleFunc("GET /queue", h.GetQueue)
+	mux.HandleFunc("POST /queue/{id}/lines/{line}/start", h.StartLine)
+	mux.HandleFunc("POST /queue/{id}/lines/{line}/done", h.FinishLine)
+}
+
+// GetQueue handles GET /queue?station=bar|kitchen&include_done=true
+func (h *QueueHandler) GetQueue(w http.ResponseWriter, r *http.Request) {
+	station := r.URL.Query().Get("station")
+	includeDone := r.URL.Query().Get("include_done") == "true"
+
+	queue, err := h.queueService.GetQueue(station, includeDone)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to build queue", slog.String("error", err.Error()))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Queue fetched", slog.String("station", station), slog.Int("orders", len(queue)))
+	respondWithJSON(w, queue, http.StatusOK)
+}
+
+// StartLine handles POST /queue/{id}/lines/{line}/start
+func (h *QueueHandler) StartLine(w http.ResponseWriter, r *http.Request) {
+	h.updateLineStatus(w, r, models.PrepStarted)
+}
+
+// FinishLine handles POST /queue/{id}/lines/{line}/done
+func (h *QueueHandler) FinishLine(w http.ResponseWriter, r *http.Request) {
+	h.updateLineStatus(w, r, models.PrepDone)
+}
+
+func (h *QueueHandler) updateLineStatus(w http.ResponseWriter, r *http.Request, status string) {
+	orderID := r.PathValue("id")
+	line, err := strconv.Atoi(r.PathValue("line"))
+	if err != nil {
+		respondWithError(w, "Line must be a number", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.queueService.UpdateLineStatus(r.Context(), orderID, line, status)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to update line status", slog.String("orderID", orderID), slog.Int("line", line), slog.String("error", err.Error()))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Line status updated", slog.String("orderID", orderID), slog.Int("line", line), slog.String("status", status))
+	respondWithJSON(w, order, http.StatusOK)
+}
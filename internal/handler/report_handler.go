@@ -2,59 +2,66 @@ package handler
 
 import (
 	"hot-coffee/internal/service"
+	"hot-coffee/models"
 	"log/slog"
 	"net/http"
 )
 
 type ReportsHandler struct {
 	reportsService *service.ReportsService
+	shiftService   *service.ShiftService
 }
 
-func NewReportsHandler(reportsService *service.ReportsService) *ReportsHandler {
-	return &ReportsHandler{reportsService: reportsService}
+func NewReportsHandler(reportsService *service.ReportsService, shiftService *service.ShiftService) *ReportsHandler {
+	return &ReportsHandler{reportsService: reportsService, shiftService: shiftService}
 }
 
-func (h *ReportsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	path := r.URL.Path
-	slog.Info("Received report request", slog.String("method", r.Method), slog.String("path", path))
-
-	switch r.Method {
-	case http.MethodGet:
-		if path == "/reports/total-sales" {
-			h.GetTotalSales(w, r)
-		} else if path == "/reports/popular-items" {
-			h.GetPopularItems(w, r)
-		} else {
-			respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	default:
-		respondWithError(w, "Method not allowed", http.StatusMethodNotAllowed)
-	}
+// RegisterRoutes adds the report routes to mux.
+func (h *ReportsHandler) RegisterRoutes(mux Mux) {
+	mux.HandleFunc("GET /reports/total-sales", h.GetTotalSales)
+	mux.HandleFunc("GET /reports/popular-items", h.GetPopularItems)
+	mux.HandleFunc("GET /reports/z/{date}", h.GetZReports)
 }
 
 // GetTotalSales handles the /reports/total-sales endpoint
 func (h *ReportsHandler) GetTotalSales(w http.ResponseWriter, r *http.Request) {
 	totalSales, err := h.reportsService.GetTotalSales()
 	if err != nil {
-		slog.Error("Failed to get total sales", slog.String("error", err.Error()))
+		slog.ErrorContext(r.Context(), "Failed to get total sales", slog.String("error", err.Error()))
 		respondWithError(w, "Failed to calculate total sales", http.StatusInternalServerError)
 		return
 	}
 
-	slog.Info("Total sales calculated successfully", slog.Float64("total_sales", totalSales))
-	respondWithJSON(w, map[string]float64{"total_sales": totalSales}, http.StatusOK)
+	slog.InfoContext(r.Context(), "Total sales calculated successfully", slog.Float64("total_sales", totalSales))
+	respondWithJSON(w, map[string]any{"total_sales": totalSales, "currency": h.reportsService.Currency()}, http.StatusOK)
 }
 
 // GetPopularItems handles the /reports/popular-items endpoint
 func (h *ReportsHandler) GetPopularItems(w http.ResponseWriter, r *http.Request) {
 	popularItems, err := h.reportsService.GetPopularItems()
 	if err != nil {
-		slog.Error("Failed to get popular items", slog.String("error", err.Error()))
+		slog.ErrorContext(r.Context(), "Failed to get popular items", slog.String("error", err.Error()))
 		respondWithError(w, "Failed to get popular items", http.StatusInternalServerError)
 		return
 	}
 
-	slog.Info("Popular items fetched successfully")
+	slog.InfoContext(r.Context(), "Popular items fetched successfully")
 	respondWithJSON(w, popularItems, http.StatusOK)
 }
+
+// GetZReports handles the /reports/z/{date} endpoint
+func (h *ReportsHandler) GetZReports(w http.ResponseWriter, r *http.Request) {
+	date := r.PathValue("date")
+	reports, err := h.shiftService.GetZReportsByDate(date)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to get z reports", slog.String("date", date), slog.String("error", err.Error()))
+		respondWithServiceError(w, err)
+		return
+	}
+	if reports == nil {
+		reports = []models.ZReport{}
+	}
+
+	slog.InfoContext(r.Context(), "Z reports fetched successfully", slog.String("date", date), slog.Int("count", len(reports)))
+	respondWithJSON(w, reports, http.StatusOK)
+}
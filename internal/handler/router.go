@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"net/http"
+)
+
+// RouteRegistrar is implemented by every handler: it adds the handler's method and
+// path patterns to the mux.
+type RouteRegistrar interface {
+	RegisterRoutes(mux Mux)
+}
+
+// Mux is the part of http.ServeMux handlers register their routes with.
+type Mux interface {
+	Handle(pattern string, handler http.Handler)
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+}
+
+// Router dispatches requests to the routes registered by the handlers. Requests that
+// match no route get a JSON 404, or a JSON 405 with an Allow header when the path
+// exists under other methods.
+type Router struct {
+	mux      *http.ServeMux
+	patterns []string
+}
+
+func NewRouter(handlers ...RouteRegistrar) *Router {
+	router := &Router{mux: http.NewServeMux()}
+	for _, h := range handlers {
+		h.RegisterRoutes(router)
+	}
+	return router
+}
+
+func (router *Router) Handle(pattern string, handler http.Handler) {
+	router.mux.Handle(pattern, handler)
+	router.patterns = append(router.patterns, pattern)
+}
+
+func (router *Router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	router.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// Patterns returns the registered route patterns, such as "GET /orders/{id}", in
+// registration order.
+func (router *Router) Patterns() []string {
+	return append([]string(nil), router.patterns...)
+}
+
+// Pattern returns the route pattern r matches, or "" when it matches none.
+func (router *Router) Pattern(r *http.Request) string {
+	_, pattern := router.mux.Handler(r)
+	return pattern
+}
+
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if router.Pattern(r) == "" {
+		// The mux answers unmatched requests in plain text; keep its status and headers
+		// (Allow, or Location for path clean-up redirects) but send our JSON error body
+		router.mux.ServeHTTP(&routeErrorWriter{ResponseWriter: w}, r)
+		return
+	}
+	router.mux.ServeHTTP(w, r)
+}
+
+// routeErrorWriter replaces the body of the mux's own 404 and 405 responses.
+type routeErrorWriter struct {
+	http.ResponseWriter
+	replaced bool
+}
+
+func (w *routeErrorWriter) WriteHeader(code int) {
+	switch code {
+	case http.StatusNotFound:
+		w.replaced = true
+		respondWithError(w.ResponseWriter, "Not found", code)
+	case http.StatusMethodNotAllowed:
+		w.replaced = true
+		respondWithError(w.ResponseWriter, "Method not allowed", code)
+	default:
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *routeErrorWriter) Write(data []byte) (int, error) {
+	if w.replaced {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// wildcard matches the {name} and {name...} segments of a route pattern.
+var wildcard = regexp.MustCompile(`\{[^}]+\}`)
+
+// samplePath fills in the wildcards of a pattern's path with a value no literal route uses.
+func samplePath(path string) string {
+	return wildcard.ReplaceAllString(path, "sample-1")
+}
+
+// echoRoutes registers each pattern with a handler that reports which pattern ran.
+type echoRoutes []string
+
+func (routes echoRoutes) RegisterRoutes(mux Mux) {
+	for _, pattern := range routes {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Route", pattern)
+			w.WriteHeader(http.StatusTeapot)
+		})
+	}
+}
+
+func TestRouterDispatchesEveryPattern(t *testing.T) {
+	server := newTestServer(t)
+	patterns := server.router.Patterns()
+	echo := NewRouter(echoRoutes(patterns))
+
+	for _, pattern := range patterns {
+		t.Run(pattern, func(t *testing.T) {
+			method, path, ok := strings.Cut(pattern, " ")
+			if !ok {
+				t.Fatalf("pattern %q has no method", pattern)
+			}
+			req := httptest.NewRequest(method, samplePath(path), nil)
+
+			if got := server.router.Pattern(req); got != pattern {
+				t.Fatalf("Pattern(%s %s) = %q, want %q", req.Method, req.URL.Path, got, pattern)
+			}
+			rec := httptest.NewRecorder()
+			echo.ServeHTTP(rec, req)
+			if rec.Code != http.StatusTeapot || rec.Header().Get("X-Route") != pattern {
+				t.Errorf("%s %s reached %q with status %d, want %q", req.Method, req.URL.Path, rec.Header().Get("X-Route"), rec.Code, pattern)
+			}
+		})
+	}
+}
+
+func TestRouterNotFound(t *testing.T) {
+	server := newTestServer(t)
+
+	for _, path := range []string{"/", "/nope", "/orders/sample-1/nope", "/inventoryx"} {
+		t.Run(path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			server.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+			if rec.Code != http.StatusNotFound {
+				t.Fatalf("status = %d, want 404", rec.Code)
+			}
+			if got := rec.Header().Get("Content-Type"); got != "application/problem+json" {
+				t.Errorf("Content-Type = %q, want application/problem+json", got)
+			}
+			p := decode[problem](t, rec.Body.Bytes())
+			if p.Status != http.StatusNotFound || p.Code != "not_found" {
+				t.Errorf("problem = %+v, want a not_found 404", p)
+			}
+		})
+	}
+}
+
+func TestRouterMethodNotAllowed(t *testing.T) {
+	server := newTestServer(t)
+
+	// The methods registered for each path
+	allowed := make(map[string][]string)
+	var paths []string
+	for _, pattern := range server.router.Patterns() {
+		method, path, _ := strings.Cut(pattern, " ")
+		if allowed[path] == nil {
+			paths = append(paths, path)
+		}
+		allowed[path] = append(allowed[path], method)
+	}
+
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			methods := allowed[path]
+			unregistered := http.MethodPatch
+			if slices.Contains(methods, unregistered) {
+				t.Fatalf("%s has every method this test tries", path)
+			}
+			rec := httptest.NewRecorder()
+			server.router.ServeHTTP(rec, httptest.NewRequest(unregistered, samplePath(path), nil))
+
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("status = %d, want 405", rec.Code)
+			}
+			p := decode[problem](t, rec.Body.Bytes())
+			if p.Status != http.StatusMethodNotAllowed || p.Code != "method_not_allowed" {
+				t.Errorf("problem = %+v, want a method_not_allowed 405", p)
+			}
+			allow := strings.Split(rec.Header().Get("Allow"), ", ")
+			for _, method := range methods {
+				if !slices.Contains(allow, method) {
+					t.Errorf("Allow = %q, missing %s", rec.Header().Get("Allow"), method)
+				}
+			}
+			if slices.Contains(allow, unregistered) {
+				t.Errorf("Allow = %q lists %s", rec.Header().Get("Allow"), unregistered)
+			}
+		})
+	}
+}
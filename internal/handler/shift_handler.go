@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"hot-coffee/internal/service"
+	"log/slog"
+	"net/http"
+)
+
+type ShiftHandler struct {
+	shiftService *service.ShiftService
+}
+
+func NewShiftHandler(shiftService *service.ShiftService) *ShiftHandler {
+	return &ShiftHandler{shiftService: shiftService}
+}
+
+// RegisterRoutes adds the shift routes to mux.
+func (h *ShiftHandler) RegisterRoutes(mux Mux) {
+	mux.HandleFunc("POST /shifts/open", h.OpenShift)
+	mux.HandleFunc("POST /shifts/close", h.CloseShift)
+	mux.HandleFunc("GET /shifts/current", h.GetCurrentShift)
+}
+
+func (h *ShiftHandler) OpenShift(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		OpeningCash float64 `json:"opening_cash"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to decode open shift request", slog.String("error", err.Error()))
+		respondWithError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	shift, err := h.shiftService.OpenShift(request.OpeningCash)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to open shift", slog.String("error", err.Error()))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Shift opened", slog.String("shiftID", shift.ID), slog.Float64("opening_cash", shift.OpeningCash))
+	respondWithJSON(w, shift, http.StatusCreated)
+}
+
+func (h *ShiftHandler) CloseShift(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		CountedCash *float64 `json:"counted_cash"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to decode close shift request", slog.String("error", err.Error()))
+		respondWithError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if request.CountedCash == nil {
+		respondWithError(w, "counted_cash is required", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.shiftService.CloseShift(*request.CountedCash)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to close shift", slog.String("error", err.Error()))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Shift closed", slog.String("shiftID", report.ShiftID), slog.Float64("variance", report.Variance))
+	respondWithJSON(w, report, http.StatusOK)
+}
+
+func (h *ShiftHandler) GetCurrentShift(w http.ResponseWriter, r *http.Request) {
+	shift, err := h.shiftService.GetCurrentShift()
+	if err != nil {
+		respondWithServiceError(w, err)
+		return
+	}
+	respondWithJSON(w, shift, http.StatusOK)
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"hot-coffee/internal/service"
+	"hot-coffee/models"
+	"log/slog"
+	"net/http"
+)
+
+type WebhookHandler struct {
+	service *service.WebhookService
+}
+
+func NewWebhookHandler(service *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{service: service}
+}
+
+// RegisterRoutes adds the webhook routes to mux.
+func (h *WebhookHandler) RegisterRoutes(mux Mux) {
+	mux.HandleFunc("POST /webhooks", h.AddWebhook)
+	mux.HandleFunc("GET /webhooks", h.GetAllWebhooks)
+	mux.HandleFunc("GET /webhooks/{id}", h.GetWebhook)
+	mux.HandleFunc("PUT /webhooks/{id}", h.UpdateWebhook)
+	mux.HandleFunc("DELETE /webhooks/{id}", h.DeleteWebhook)
+	mux.HandleFunc("GET /webhooks/{id}/deliveries", h.GetDeliveries)
+	mux.HandleFunc("POST /webhooks/{id}/test", h.SendTestEvent)
+}
+
+// AddWebhook returns the new webhook including its secret; later reads leave the secret out.
+func (h *WebhookHandler) AddWebhook(w http.ResponseWriter, r *http.Request) {
+	// New webhooks receive events unless the request says "active": false
+	webhook := models.Webhook{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		slog.ErrorContext(r.Context(), "Error decoding webhook", slog.Any("error", err))
+		respondWithError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.AddWebhook(&webhook); err != nil {
+		slog.ErrorContext(r.Context(), "Error adding webhook", slog.Any("error", err))
+		respondWithServiceError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Webhook added", slog.String("webhookID", webhook.ID), slog.String("url", webhook.URL))
+	// The secret must not be cached, nor stored for Idempotency-Key retries
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, webhook, http.StatusCreated)
+}
+
+func (h *WebhookHandler) GetAllWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.service.GetAllWebhooks()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error retrieving webhooks", slog.Any("error", err))
+		respondWithError(w, "Failed to retrieve webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	redacted := []models.Webhook{}
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+		redacted = append(redacted, webhook)
+	}
+	respondWithJSON(w, redacted, http.StatusOK)
+}
+
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	webhook, err := h.service.GetWebhookByID(id)
+	if err != nil {
+		respondWithWebhookError(w, id, err)
+		return
+	}
+	webhook.Secret = ""
+	respondWithJSON(w, webhook, http.StatusOK)
+}
+
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var webhook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&webhook); err != nil {
+		slog.ErrorContext(r.Context(), "Error decoding webhook", slog.Any("error", err))
+		respondWithError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	webhook.ID = id
+	if err := h.service.UpdateWebhook(&webhook); err != nil {
+		respondWithWebhookError(w, id, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Webhook updated", slog.String("webhookID", id))
+	webhook.Secret = ""
+	respondWithJSON(w, webhook, http.StatusOK)
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := h.service.DeleteWebhook(id); err != nil {
+		respondWithWebhookError(w, id, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Webhook deleted", slog.String("webhookID", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	deliveries, err := h.service.GetDeliveries(id)
+	if err != nil {
+		respondWithWebhookError(w, id, err)
+		return
+	}
+	respondWithJSON(w, deliveries, http.StatusOK)
+}
+
+func (h *WebhookHandler) SendTestEvent(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	delivery, err := h.service.SendTestEvent(id)
+	if err != nil {
+		respondWithWebhookError(w, id, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Webhook test event sent", slog.String("webhookID", id), slog.Bool("success", delivery.Success))
+	respondWithJSON(w, delivery, http.StatusOK)
+}
+
+func respondWithWebhookError(w http.ResponseWriter, id string, err error) {
+	slog.Error("Webhook request failed", slog.String("webhookID", id), slog.Any("error", err))
+	respondWithServiceError(w, err)
+}
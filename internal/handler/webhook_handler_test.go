@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hot-coffee/config"
+	"hot-coffee/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddWebhookIsActiveByDefault(t *testing.T) {
+	server := newTestServer(t)
+
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"active omitted", `{"url":"http://127.0.0.1:1/hook","events":["order.*"]}`, true},
+		{"active false", `{"url":"http://127.0.0.1:1/hook","events":["order.*"],"active":false}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, data := server.do(t, http.MethodPost, "/webhooks", tt.body)
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("status = %d: %s", resp.StatusCode, data)
+			}
+			created := decode[models.Webhook](t, data)
+			if created.Active != tt.want {
+				t.Errorf("created webhook active = %v, want %v", created.Active, tt.want)
+			}
+
+			_, data = server.do(t, http.MethodGet, "/webhooks/"+created.ID, "")
+			if stored := decode[models.Webhook](t, data); stored.Active != tt.want {
+				t.Errorf("stored webhook active = %v, want %v", stored.Active, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookSecretsAreOwnerOnly(t *testing.T) {
+	server := newTestServer(t)
+	if resp, data := server.do(t, http.MethodPost, "/webhooks", `{"url":"http://127.0.0.1:1/hook","events":["*"],"secret":"s3cret"}`); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("status = %d: %s", resp.StatusCode, data)
+	}
+
+	info, err := os.Stat(filepath.Join(config.Directory, "webhooks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("webhooks.json has mode %v, want -rw-------", mode)
+	}
+}
+
+func TestWebhookSecretIsOnlyShownOnCreate(t *testing.T) {
+	server := newTestServer(t)
+	type delivery struct {
+		signature string
+		body      []byte
+	}
+	deliveries := make(chan delivery, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{signature: r.Header.Get("X-Hot-Coffee-Signature"), body: body}
+	}))
+	defer receiver.Close()
+
+	resp, data := server.do(t, http.MethodPost, "/webhooks", `{"url":"`+receiver.URL+`","events":["*"],"secret":"s3cret"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", resp.StatusCode, data)
+	}
+	created := decode[models.Webhook](t, data)
+	if created.Secret != "s3cret" {
+		t.Errorf("created webhook secret = %q, want it shown once", created.Secret)
+	}
+
+	// A new secret can be set, but is never read back
+	reads := []struct{ method, path, body string }{
+		{http.MethodGet, "/webhooks/" + created.ID, ""},
+		{http.MethodGet, "/webhooks", ""},
+		{http.MethodPut, "/webhooks/" + created.ID, `{"url":"` + receiver.URL + `","events":["*"],"active":true,"secret":"n3w-secret"}`},
+		{http.MethodGet, "/webhooks/" + created.ID, ""},
+	}
+	for _, read := range reads {
+		resp, data := server.do(t, read.method, read.path, read.body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s %s status = %d: %s", read.method, read.path, resp.StatusCode, data)
+		}
+		if bytes.Contains(data, []byte("secret")) {
+			t.Errorf("%s %s shows the secret: %s", read.method, read.path, data)
+		}
+	}
+
+	// Deliveries are signed with the new secret
+	if resp, data := server.do(t, http.MethodPost, "/webhooks/"+created.ID+"/test", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("test event status = %d: %s", resp.StatusCode, data)
+	}
+	got := <-deliveries
+	mac := hmac.New(sha256.New, []byte("n3w-secret"))
+	mac.Write(got.body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); got.signature != want {
+		t.Errorf("X-Hot-Coffee-Signature = %q, want %q", got.signature, want)
+	}
+}
@@ -0,0 +1,302 @@
+// Package metrics keeps counters, gauges and histograms in memory and writes them in the
+// Prometheus text exposition format, so /metrics needs no client library. Metrics are
+// usually declared as package variables registered with Default.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram bounds, in seconds, used for request and storage
+// latencies: 1ms to 10s.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry served at /metrics.
+var Default = NewRegistry()
+
+// Registry holds the metrics written by WriteTo, in the order they were registered.
+type Registry struct {
+	mu       sync.Mutex
+	families []collector
+	names    map[string]bool
+}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: " + name + " registered twice")
+	}
+	r.names[name] = true
+	r.families = append(r.families, c)
+}
+
+// WriteTo writes every metric in the text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+
+	counter := &countingWriter{w: w}
+	buffered := bufio.NewWriter(counter)
+	for _, family := range families {
+		family.write(buffered)
+	}
+	err := buffered.Flush()
+	return counter.n, err
+}
+
+// family is the part shared by all metric types: the name, the label names and one
+// series per combination of label values.
+type family[S any] struct {
+	name, help, kind string
+	labels           []string
+	mu               sync.Mutex
+	series           map[string]*labeledSeries[S]
+}
+
+type labeledSeries[S any] struct {
+	values []string
+	state  S
+}
+
+func newFamily[S any](name, help, kind string, labels []string) *family[S] {
+	return &family[S]{name: name, help: help, kind: kind, labels: labels, series: make(map[string]*labeledSeries[S])}
+}
+
+// with returns the series for the label values, creating it on first use. The caller
+// must hold f.mu.
+func (f *family[S]) with(values []string) *labeledSeries[S] {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &labeledSeries[S]{values: slices.Clone(values)}
+		f.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by label values so the output is stable. The caller
+// must hold f.mu.
+func (f *family[S]) sorted() []*labeledSeries[S] {
+	series := make([]*labeledSeries[S], 0, len(f.series))
+	for _, s := range f.series {
+		series = append(series, s)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return slices.Compare(series[i].values, series[j].values) < 0
+	})
+	return series
+}
+
+func (f *family[S]) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+}
+
+// Counter is a value that only goes up, such as the number of orders created.
+type Counter struct {
+	*family[float64]
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newFamily[float64](name, help, "counter", labels)}
+	r.register(name, c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter; negative values are ignored.
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.with(labelValues).state += value
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(w)
+	for _, s := range c.sorted() {
+		writeSample(w, c.name, c.labels, s.values, "", s.state)
+	}
+}
+
+// Gauge is a value that goes up and down.
+type Gauge struct {
+	*family[float64]
+}
+
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newFamily[float64](name, help, "gauge", labels)}
+	r.register(name, g)
+	return g
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.with(labelValues).state = value
+}
+
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.with(labelValues).state += value
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.writeHeader(w)
+	for _, s := range g.sorted() {
+		writeSample(w, g.name, g.labels, s.values, "", s.state)
+	}
+}
+
+// GaugeFunc is a gauge whose values are collected when the metrics are written, for
+// values such as stock levels that live elsewhere.
+type GaugeFunc struct {
+	name, help string
+	labels     []string
+	collect    func(observe func(value float64, labelValues ...string))
+}
+
+// NewGaugeFunc registers a gauge filled by collect, which calls observe once per series.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func(observe func(value float64, labelValues ...string))) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, labels: labels, collect: collect}
+	r.register(name, g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	gauge := &Gauge{newFamily[float64](g.name, g.help, "gauge", g.labels)}
+	g.collect(func(value float64, labelValues ...string) {
+		gauge.Set(value, labelValues...)
+	})
+	gauge.write(w)
+}
+
+// Histogram counts observations, such as request durations, into buckets.
+type Histogram struct {
+	*family[*histogramState]
+	buckets []float64
+}
+
+type histogramState struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds, in increasing
+// order; the +Inf bucket is implied.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{family: newFamily[*histogramState](name, help, "histogram", labels), buckets: slices.Clone(buckets)}
+	r.register(name, h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.with(labelValues)
+	if s.state == nil {
+		s.state = &histogramState{counts: make([]uint64, len(h.buckets))}
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.state.counts[i]++
+		}
+	}
+	s.state.count++
+	s.state.sum += value
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w)
+	labels := append(slices.Clone(h.labels), "le")
+	for _, s := range h.sorted() {
+		values := append(slices.Clone(s.values), "")
+		for i, bound := range h.buckets {
+			values[len(values)-1] = formatFloat(bound)
+			writeSample(w, h.name, labels, values, "_bucket", float64(s.state.counts[i]))
+		}
+		values[len(values)-1] = "+Inf"
+		writeSample(w, h.name, labels, values, "_bucket", float64(s.state.count))
+		writeSample(w, h.name, h.labels, s.values, "_sum", s.state.sum)
+		writeSample(w, h.name, h.labels, s.values, "_count", float64(s.state.count))
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, suffix string, value float64) {
+	w.WriteString(name + suffix)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabel(values[i]))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
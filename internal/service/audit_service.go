@@ -0,0 +1,199 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hot-coffee/models"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// SystemActor is recorded for changes made without a signed-in user, such as from the command line.
+const SystemActor = "system"
+
+type actorContextKey struct{}
+
+// WithActor returns a context that attributes the changes made with it to actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFrom returns the actor set by WithActor, or SystemActor.
+func ActorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorContextKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return SystemActor
+}
+
+type AuditRepository interface {
+	AppendEntry(entry *models.AuditEntry) error
+	GetAllEntries() ([]models.AuditEntry, error)
+	QueryEntries(query models.AuditQuery) ([]models.AuditEntry, models.PageInfo, error)
+}
+
+// AuditService appends an entry to the audit log for every change to inventory items,
+// menu items and orders. A nil *AuditService records nothing.
+type AuditService struct {
+	repo AuditRepository
+
+	// mu orders the appends so each entry chains onto the one before it
+	mu       sync.Mutex
+	loaded   bool
+	lastSeq  int64
+	lastHash string
+}
+
+func NewAuditService(repo AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// Record logs a change by the context's actor. before is nil for creations and after
+// for deletions. The change has already been made, so a failure to record it is logged
+// rather than returned.
+func (s *AuditService) Record(ctx context.Context, entityType, entityID, action string, before, after any) {
+	if s == nil {
+		return
+	}
+	if err := s.record(ActorFrom(ctx), entityType, entityID, action, before, after); err != nil {
+		slog.ErrorContext(ctx, "Failed to write audit entry", slog.String("entityType", entityType), slog.String("entityID", entityID),
+			slog.String("action", action), slog.Any("error", err))
+	}
+}
+
+func (s *AuditService) record(actor, entityType, entityID, action string, before, after any) error {
+	changes, err := diffFields(before, after)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		entries, err := s.repo.GetAllEntries()
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			s.lastSeq, s.lastHash = entries[len(entries)-1].Seq, entries[len(entries)-1].Hash
+		}
+		s.loaded = true
+	}
+
+	entry := models.AuditEntry{
+		Seq:        s.lastSeq + 1,
+		Time:       time.Now().Format(time.RFC3339Nano),
+		Actor:      actor,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Action:     action,
+		Changes:    changes,
+		PrevHash:   s.lastHash,
+	}
+	if entry.Hash, err = hashAuditEntry(entry); err != nil {
+		return err
+	}
+	if err := s.repo.AppendEntry(&entry); err != nil {
+		return err
+	}
+	s.lastSeq, s.lastHash = entry.Seq, entry.Hash
+	return nil
+}
+
+// QueryEntries returns one page of the audit entries matching the query.
+func (s *AuditService) QueryEntries(query models.AuditQuery) (*models.List[models.AuditEntry], error) {
+	entries, page, err := s.repo.QueryEntries(query)
+	if err != nil {
+		return nil, err
+	}
+	return &models.List[models.AuditEntry]{Data: entries, Pagination: page}, nil
+}
+
+// Verify recomputes the hash chain and reports the first entry that does not match.
+func (s *AuditService) Verify() (*models.AuditVerification, error) {
+	entries, err := s.repo.GetAllEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.AuditVerification{Valid: true, Entries: len(entries)}
+	prevHash, prevSeq := "", int64(0)
+	for _, entry := range entries {
+		hash, err := hashAuditEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case entry.Seq != prevSeq+1:
+			result.Problem = fmt.Sprintf("expected entry %d", prevSeq+1)
+		case entry.PrevHash != prevHash:
+			result.Problem = "prev_hash does not match the entry before"
+		case entry.Hash != hash:
+			result.Problem = "hash does not match the entry's contents"
+		}
+		if result.Problem != "" {
+			result.Valid, result.BadSeq = false, entry.Seq
+			return result, nil
+		}
+		prevHash, prevSeq = entry.Hash, entry.Seq
+	}
+	return result, nil
+}
+
+// hashAuditEntry is the hex SHA-256 of the entry's JSON with the Hash field left empty.
+func hashAuditEntry(entry models.AuditEntry) (string, error) {
+	entry.Hash = ""
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// diffFields compares the top-level JSON fields of two versions of a record and returns
+// those that differ.
+func diffFields(before, after any) (map[string]models.AuditChange, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]models.AuditChange)
+	for name, value := range beforeFields {
+		if !bytes.Equal(value, afterFields[name]) {
+			changes[name] = models.AuditChange{Before: value, After: afterFields[name]}
+		}
+	}
+	for name, value := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			changes[name] = models.AuditChange{After: value}
+		}
+	}
+	return changes, nil
+}
+
+func jsonFields(record any) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if record == nil {
+		return fields, nil
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
@@ -0,0 +1,430 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hot-coffee/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	minPasswordLength = 8
+	// apiKeyPrefix marks API keys so they can be told apart from session tokens.
+	apiKeyPrefix = "hck_"
+)
+
+var (
+	ErrUserNotFound   = models.NotFoundError("user_not_found", "user not found")
+	ErrAPIKeyNotFound = models.NotFoundError("api_key_not_found", "API key not found")
+	// ErrInvalidCredentials deliberately does not say whether the username or the password was wrong.
+	ErrInvalidCredentials = &models.Error{Kind: models.ErrUnauthorized, Code: "invalid_credentials", Message: "invalid username or password"}
+	ErrInvalidToken       = &models.Error{Kind: models.ErrUnauthorized, Code: "invalid_token", Message: "the token or API key is invalid or has expired"}
+	ErrLastAdmin          = models.ConflictError("last_admin", "the last admin cannot be removed or demoted")
+)
+
+type UserRepository interface {
+	AddUser(user *models.User) error
+	GetAllUsers() ([]models.User, error)
+	SaveUsers(users []models.User) error
+	GetAllAPIKeys() ([]models.APIKey, error)
+	SaveAPIKeys(keys []models.APIKey) error
+	GetAllSessions() ([]models.Session, error)
+	SaveSessions(sessions []models.Session) error
+}
+
+// AuthService manages users and checks the bearer tokens and API keys they present.
+// Sessions expire after sessionTTL; API keys last until they are revoked.
+type AuthService struct {
+	repo       UserRepository
+	sessionTTL time.Duration
+
+	// mu serialises changes to the user, key and session files
+	mu sync.Mutex
+}
+
+func NewAuthService(repo UserRepository, sessionTTL time.Duration) *AuthService {
+	return &AuthService{repo: repo, sessionTTL: sessionTTL}
+}
+
+// HasUsers reports whether anyone can sign in yet.
+func (s *AuthService) HasUsers() (bool, error) {
+	users, err := s.repo.GetAllUsers()
+	return len(users) > 0, err
+}
+
+func (s *AuthService) GetAllUsers() ([]models.User, error) {
+	return s.repo.GetAllUsers()
+}
+
+func (s *AuthService) GetUserByID(id string) (*models.User, error) {
+	users, err := s.repo.GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.ID == id {
+			return &user, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// AddUser creates a user from the Password field, which is hashed and then cleared.
+func (s *AuthService) AddUser(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user.Username = strings.TrimSpace(user.Username)
+	if user.Username == "" {
+		return models.ValidationError("username_required", "username is required")
+	}
+	if err := validateRole(user.Role); err != nil {
+		return err
+	}
+	users, err := s.repo.GetAllUsers()
+	if err != nil {
+		return err
+	}
+	for _, existing := range users {
+		if strings.EqualFold(existing.Username, user.Username) {
+			return models.ConflictError("duplicate_username", fmt.Sprintf("username %s is already taken", user.Username))
+		}
+	}
+	if err := setPassword(user, user.Password); err != nil {
+		return err
+	}
+
+	user.ID = generateUserID()
+	user.CreatedAt = time.Now().Format(time.RFC3339)
+	return s.repo.AddUser(user)
+}
+
+// UpdateUser changes a user's role and, when Password is set, their password. Changing the
+// password signs the user out everywhere.
+func (s *AuthService) UpdateUser(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := validateRole(user.Role); err != nil {
+		return err
+	}
+	users, err := s.repo.GetAllUsers()
+	if err != nil {
+		return err
+	}
+	for i, existing := range users {
+		if existing.ID != user.ID {
+			continue
+		}
+		if existing.Role == models.RoleAdmin && user.Role != models.RoleAdmin && countAdmins(users) == 1 {
+			return ErrLastAdmin
+		}
+		users[i].Role = user.Role
+		if user.Password != "" {
+			if err := setPassword(&users[i], user.Password); err != nil {
+				return err
+			}
+			if err := s.deleteSessions(user.ID); err != nil {
+				return err
+			}
+		}
+		if err := s.repo.SaveUsers(users); err != nil {
+			return err
+		}
+		*user = users[i]
+		return nil
+	}
+	return ErrUserNotFound
+}
+
+// DeleteUser removes a user together with their sessions and API keys.
+func (s *AuthService) DeleteUser(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users, err := s.repo.GetAllUsers()
+	if err != nil {
+		return err
+	}
+	for i, user := range users {
+		if user.ID != id {
+			continue
+		}
+		if user.Role == models.RoleAdmin && countAdmins(users) == 1 {
+			return ErrLastAdmin
+		}
+		if err := s.repo.SaveUsers(append(users[:i], users[i+1:]...)); err != nil {
+			return err
+		}
+		if err := s.deleteSessions(id); err != nil {
+			return err
+		}
+		keys, err := s.repo.GetAllAPIKeys()
+		if err != nil {
+			return err
+		}
+		kept := []models.APIKey{}
+		for _, key := range keys {
+			if key.UserID != id {
+				kept = append(kept, key)
+			}
+		}
+		return s.repo.SaveAPIKeys(kept)
+	}
+	return ErrUserNotFound
+}
+
+// Login checks a username and password and starts a session for the user.
+func (s *AuthService) Login(credentials models.Credentials) (*models.LoginResult, error) {
+	users, err := s.repo.GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
+	var user *models.User
+	for i := range users {
+		if strings.EqualFold(users[i].Username, strings.TrimSpace(credentials.Username)) {
+			user = &users[i]
+			break
+		}
+	}
+	if user == nil {
+		CheckPassword(dummyPasswordHash(), credentials.Password)
+		return nil, ErrInvalidCredentials
+	}
+	if !CheckPassword(user.PasswordHash, credentials.Password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	token, err := generateToken("")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := models.Session{
+		TokenHash: hashToken(token),
+		UserID:    user.ID,
+		CreatedAt: now.Format(time.RFC3339),
+		ExpiresAt: now.Add(s.sessionTTL).Format(time.RFC3339),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions, err := s.repo.GetAllSessions()
+	if err != nil {
+		return nil, err
+	}
+	// Expired sessions are dropped whenever a new one is stored
+	kept := []models.Session{session}
+	for _, existing := range sessions {
+		if !isSessionExpired(existing, now) {
+			kept = append(kept, existing)
+		}
+	}
+	if err := s.repo.SaveSessions(kept); err != nil {
+		return nil, err
+	}
+	return &models.LoginResult{Token: token, ExpiresAt: session.ExpiresAt, User: *user}, nil
+}
+
+// Logout ends the session of a bearer token. API keys are revoked with DeleteAPIKey instead.
+func (s *AuthService) Logout(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions, err := s.repo.GetAllSessions()
+	if err != nil {
+		return err
+	}
+	hash := hashToken(token)
+	kept := []models.Session{}
+	for _, session := range sessions {
+		if session.TokenHash != hash {
+			kept = append(kept, session)
+		}
+	}
+	return s.repo.SaveSessions(kept)
+}
+
+// Authenticate returns the user a bearer token or API key belongs to.
+func (s *AuthService) Authenticate(token string) (*models.User, error) {
+	if token == "" {
+		return nil, ErrInvalidToken
+	}
+	hash := hashToken(token)
+	userID := ""
+	if strings.HasPrefix(token, apiKeyPrefix) {
+		keys, err := s.repo.GetAllAPIKeys()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if key.Hash == hash {
+				userID = key.UserID
+				break
+			}
+		}
+	} else {
+		sessions, err := s.repo.GetAllSessions()
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		for _, session := range sessions {
+			if session.TokenHash == hash && !isSessionExpired(session, now) {
+				userID = session.UserID
+				break
+			}
+		}
+	}
+	if userID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.GetUserByID(userID)
+	if err == ErrUserNotFound {
+		return nil, ErrInvalidToken
+	}
+	return user, err
+}
+
+// AddAPIKey creates an API key for a user. The returned Key is the only time the
+// plain key is available.
+func (s *AuthService) AddAPIKey(userID, name string) (*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, models.ValidationError("api_key_name_required", "API key name is required")
+	}
+	plain, err := generateToken(apiKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.repo.GetAllAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+	key := models.APIKey{
+		ID:        generateAPIKeyID(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plain[:len(apiKeyPrefix)+6],
+		Hash:      hashToken(plain),
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+	if err := s.repo.SaveAPIKeys(append(keys, key)); err != nil {
+		return nil, err
+	}
+	key.Key = plain
+	return &key, nil
+}
+
+// GetAPIKeys lists the API keys of a user.
+func (s *AuthService) GetAPIKeys(userID string) ([]models.APIKey, error) {
+	keys, err := s.repo.GetAllAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+	owned := []models.APIKey{}
+	for _, key := range keys {
+		if key.UserID == userID {
+			owned = append(owned, key)
+		}
+	}
+	return owned, nil
+}
+
+// DeleteAPIKey revokes one of a user's API keys.
+func (s *AuthService) DeleteAPIKey(userID, keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.repo.GetAllAPIKeys()
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if key.ID == keyID && key.UserID == userID {
+			return s.repo.SaveAPIKeys(append(keys[:i], keys[i+1:]...))
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+func (s *AuthService) deleteSessions(userID string) error {
+	sessions, err := s.repo.GetAllSessions()
+	if err != nil {
+		return err
+	}
+	kept := []models.Session{}
+	for _, session := range sessions {
+		if session.UserID != userID {
+			kept = append(kept, session)
+		}
+	}
+	return s.repo.SaveSessions(kept)
+}
+
+func validateRole(role string) error {
+	switch role {
+	case models.RoleCashier, models.RoleBarista, models.RoleManager, models.RoleAdmin:
+		return nil
+	}
+	return models.ValidationError("invalid_role", "role must be cashier, barista, manager or admin")
+}
+
+func setPassword(user *models.User, password string) error {
+	if len(password) < minPasswordLength {
+		return models.ValidationError("password_too_short", fmt.Sprintf("password must be at least %d characters", minPasswordLength))
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = hash
+	user.Password = ""
+	return nil
+}
+
+func countAdmins(users []models.User) int {
+	count := 0
+	for _, user := range users {
+		if user.Role == models.RoleAdmin {
+			count++
+		}
+	}
+	return count
+}
+
+func isSessionExpired(session models.Session, now time.Time) bool {
+	expiresAt, err := time.Parse(time.RFC3339, session.ExpiresAt)
+	return err != nil || now.After(expiresAt)
+}
+
+// hashToken is how tokens and API keys are stored. They are long random strings, so a
+// plain SHA-256 is enough; passwords use HashPassword.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateToken(prefix string) (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(token), nil
+}
+
+func generateUserID() string {
+	return fmt.Sprintf("user_%d", time.Now().UnixNano())
+}
+
+func generateAPIKeyID() string {
+	return fmt.Sprintf("key_%d", time.Now().UnixNano())
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"hot-coffee/internal/dal"
+	"hot-coffee/models"
+	"testing"
+	"time"
+)
+
+// newTestAuthService returns an auth service over a fresh data directory with one cashier,
+// whose sessions last for sessionTTL.
+func newTestAuthService(t *testing.T, sessionTTL time.Duration) *AuthService {
+	t.Helper()
+	newTestServices(t)
+	auth := NewAuthService(&dal.FileUserRepository{}, sessionTTL)
+	if err := auth.AddUser(&models.User{Username: "ann", Password: "correct-horse", Role: models.RoleCashier}); err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+func TestExpiredSessionIsRejected(t *testing.T) {
+	auth := newTestAuthService(t, -time.Minute)
+	login, err := auth.Login(models.Credentials{Username: "ann", Password: "correct-horse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Authenticate(login.Token); err != ErrInvalidToken {
+		t.Errorf("authenticating with an expired session: error = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestRevokedAPIKeyIsRejected(t *testing.T) {
+	auth := newTestAuthService(t, time.Hour)
+	users, err := auth.GetAllUsers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := auth.AddAPIKey(users[0].ID, "till")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err := auth.Authenticate(key.Key); err != nil || user.Username != "ann" {
+		t.Fatalf("authenticating with a new key: user = %v, error = %v", user, err)
+	}
+
+	if err := auth.DeleteAPIKey(users[0].ID, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Authenticate(key.Key); err != ErrInvalidToken {
+		t.Errorf("authenticating with a revoked key: error = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestUnknownUsernameAndWrongPasswordFailAlike(t *testing.T) {
+	auth := newTestAuthService(t, time.Hour)
+	for _, credentials := range []models.Credentials{
+		{Username: "ann", Password: "wrong-horse"},
+		{Username: "bob", Password: "correct-horse"},
+	} {
+		if _, err := auth.Login(credentials); err != ErrInvalidCredentials {
+			t.Errorf("login as %s: error = %v, want %v", credentials.Username, err, ErrInvalidCredentials)
+		}
+	}
+}
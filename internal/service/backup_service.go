@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"hot-coffee/models"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type BackupRepository interface {
+	CreateBackup() (*models.Backup, error)
+	GetAllBackups() ([]models.Backup, error)
+	DeleteBackup(name string) error
+}
+
+// BackupService takes backups of the data directory, on request and on a schedule, and
+// deletes the oldest once there are more than it keeps.
+type BackupService struct {
+	repo BackupRepository
+	keep int
+
+	// mu keeps two backups from being taken, and pruned, at once
+	mu      sync.Mutex
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func NewBackupService(repo BackupRepository, keep int) *BackupService {
+	return &BackupService{repo: repo, keep: keep}
+}
+
+// CreateBackup takes a backup and then deletes the oldest beyond the number kept.
+func (s *BackupService) CreateBackup(ctx context.Context) (*models.Backup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := time.Now()
+	backup, err := s.repo.CreateBackup()
+	if err != nil {
+		backupsTaken.Inc("failed")
+		slog.ErrorContext(ctx, "Failed to take backup", slog.String("error", err.Error()))
+		return nil, err
+	}
+	backupsTaken.Inc("ok")
+	lastBackup.Set(float64(start.Unix()))
+	slog.InfoContext(ctx, "Backup taken", slog.String("name", backup.Name), slog.Int64("size", backup.Size),
+		slog.Duration("duration", time.Since(start)))
+
+	s.prune(ctx)
+	return backup, nil
+}
+
+// prune deletes the oldest backups beyond the number kept. Failures are only logged:
+// the new backup was taken all the same.
+func (s *BackupService) prune(ctx context.Context) {
+	backups, err := s.repo.GetAllBackups()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to list backups", slog.String("error", err.Error()))
+		return
+	}
+	for i := 0; i < len(backups)-s.keep; i++ {
+		if err := s.repo.DeleteBackup(backups[i].Name); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete old backup", slog.String("name", backups[i].Name), slog.String("error", err.Error()))
+			continue
+		}
+		slog.InfoContext(ctx, "Old backup deleted", slog.String("name", backups[i].Name))
+	}
+}
+
+// Start takes a backup every interval until Stop is called.
+func (s *BackupService) Start(interval time.Duration) {
+	s.stop = make(chan struct{})
+	s.stopped = make(chan struct{})
+	go func() {
+		defer close(s.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.CreateBackup(context.Background())
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the schedule and waits for a backup in progress. It does nothing when the
+// schedule was never started.
+func (s *BackupService) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.stopped
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"fmt"
+	"hot-coffee/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrCustomerNotFound = models.NotFoundError("customer_not_found", "customer not found")
+
+type CustomerRepository interface {
+	// Locker is held from loading the customers to saving them
+	sync.Locker
+	AddCustomer(customer *models.Customer) error
+	GetAllCustomers() ([]models.Customer, error)
+	SaveCustomers(customers []models.Customer) error
+}
+
+type CustomerService struct {
+	customerRepo CustomerRepository
+	orderRepo    OrderRepository
+	refundRepo   RefundRepository
+}
+
+func NewCustomerService(customerRepo CustomerRepository, orderRepo OrderRepository, refundRepo RefundRepository) *CustomerService {
+	return &CustomerService{
+		customerRepo: customerRepo,
+		orderRepo:    orderRepo,
+		refundRepo:   refundRepo,
+	}
+}
+
+func (s *CustomerService) GetAllCustomers() ([]models.Customer, error) {
+	return s.customerRepo.GetAllCustomers()
+}
+
+func (s *CustomerService) GetCustomerByID(id string) (*models.Customer, error) {
+	customers, err := s.customerRepo.GetAllCustomers()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, customer := range customers {
+		if customer.ID == id {
+			return &customer, nil
+		}
+	}
+	return nil, ErrCustomerNotFound
+}
+
+func (s *CustomerService) AddCustomer(customer *models.Customer) error {
+	normalizeCustomer(customer)
+	if customer.Name == "" {
+		return models.ValidationError("customer_name_required", "customer name is required")
+	}
+
+	s.customerRepo.Lock()
+	defer s.customerRepo.Unlock()
+	customers, err := s.customerRepo.GetAllCustomers()
+	if err != nil {
+		return err
+	}
+	if err := checkContactDetailsUnique(customers, customer); err != nil {
+		return err
+	}
+
+	customer.ID = generateCustomerID()
+	customer.CreatedAt = time.Now().Format(time.RFC3339)
+	return s.customerRepo.AddCustomer(customer)
+}
+
+func (s *CustomerService) UpdateCustomer(customer *models.Customer) error {
+	normalizeCustomer(customer)
+	if customer.Name == "" {
+		return models.ValidationError("customer_name_required", "customer name is required")
+	}
+
+	s.customerRepo.Lock()
+	defer s.customerRepo.Unlock()
+	customers, err := s.customerRepo.GetAllCustomers()
+	if err != nil {
+		return err
+	}
+	if err := checkContactDetailsUnique(customers, customer); err != nil {
+		return err
+	}
+
+	for i, existing := range customers {
+		if existing.ID == customer.ID {
+			customers[i].Name = customer.Name
+			customers[i].Phone = customer.Phone
+			customers[i].Email = customer.Email
+			customers[i].Notes = customer.Notes
+			customer.CreatedAt = existing.CreatedAt
+			return s.customerRepo.SaveCustomers(customers)
+		}
+	}
+	return ErrCustomerNotFound
+}
+
+// DeleteCustomer removes a customer. Customers with open orders are kept, since editing or
+// closing those orders looks the customer up again.
+func (s *CustomerService) DeleteCustomer(id string) error {
+	s.orderRepo.Lock()
+	defer s.orderRepo.Unlock()
+	orders, err := s.orderRepo.LoadOrders()
+	if err != nil {
+		return err
+	}
+	for _, order := range orders {
+		if order.CustomerID == id && order.Status == models.OrderOpen {
+			return models.ConflictError("customer_has_open_orders", "customer has open order "+order.ID+"; close or delete it first")
+		}
+	}
+
+	s.customerRepo.Lock()
+	defer s.customerRepo.Unlock()
+	customers, err := s.customerRepo.GetAllCustomers()
+	if err != nil {
+		return err
+	}
+
+	for i, existing := range customers {
+		if existing.ID == id {
+			customers = append(customers[:i], customers[i+1:]...)
+			return s.customerRepo.SaveCustomers(customers)
+		}
+	}
+	return ErrCustomerNotFound
+}
+
+// GetCustomerOrders returns every order placed by the customer, oldest first as stored.
+func (s *CustomerService) GetCustomerOrders(id string) ([]models.Order, error) {
+	if _, err := s.GetCustomerByID(id); err != nil {
+		return nil, err
+	}
+
+	orders, err := s.orderRepo.GetAllOrders()
+	if err != nil {
+		return nil, err
+	}
+
+	customerOrders := []models.Order{}
+	for _, order := range orders {
+		if order.CustomerID == id {
+			customerOrders = append(customerOrders, order)
+		}
+	}
+	return customerOrders, nil
+}
+
+// GetCustomerStats counts the customer's visits, what they have paid net of refunds
+// and the product they order most.
+func (s *CustomerService) GetCustomerStats(id string) (*models.CustomerStats, error) {
+	orders, err := s.GetCustomerOrders(id)
+	if err != nil {
+		return nil, err
+	}
+	refunds, err := s.refundRepo.GetAllRefunds()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.CustomerStats{CustomerID: id, VisitCount: len(orders)}
+	orderIDs := make(map[string]bool)
+	productCounts := make(map[string]int)
+	for _, order := range orders {
+		orderIDs[order.ID] = true
+		if order.Status == "closed" {
+			stats.LifetimeSpend += order.Total
+		}
+		for _, item := range order.Items {
+			productCounts[item.ProductID] += item.Quantity
+		}
+	}
+	for _, refund := range refunds {
+		if orderIDs[refund.OrderID] {
+			stats.LifetimeSpend -= refund.Amount
+		}
+	}
+	stats.LifetimeSpend = roundMoney(stats.LifetimeSpend)
+
+	// Ties go to the alphabetically first product so the answer is stable
+	for productID, count := range productCounts {
+		best := productCounts[stats.FavoriteItem]
+		if count > best || (count == best && productID < stats.FavoriteItem) {
+			stats.FavoriteItem = productID
+		}
+	}
+	return stats, nil
+}
+
+// normalizeCustomer trims the contact details so "Alice" and "alice " are recognised as the same person.
+func normalizeCustomer(customer *models.Customer) {
+	customer.Name = strings.Join(strings.Fields(customer.Name), " ")
+	customer.Phone = strings.TrimSpace(customer.Phone)
+	customer.Email = strings.ToLower(strings.TrimSpace(customer.Email))
+	customer.Notes = strings.TrimSpace(customer.Notes)
+}
+
+func checkContactDetailsUnique(customers []models.Customer, customer *models.Customer) error {
+	for _, existing := range customers {
+		if existing.ID == customer.ID {
+			continue
+		}
+		if customer.Phone != "" && existing.Phone == customer.Phone {
+			return models.ConflictError("duplicate_customer", fmt.Sprintf("customer %s already uses phone %s", existing.ID, customer.Phone))
+		}
+		if customer.Email != "" && existing.Email == customer.Email {
+			return models.ConflictError("duplicate_customer", fmt.Sprintf("customer %s already uses email %s", existing.ID, customer.Email))
+		}
+		if customer.Phone == "" && customer.Email == "" && strings.EqualFold(existing.Name, customer.Name) {
+			return models.ConflictError("duplicate_customer", fmt.Sprintf("customer %s is already named %s, add a phone or email to tell them apart", existing.ID, existing.Name))
+		}
+	}
+	return nil
+}
+
+func generateCustomerID() string {
+	return fmt.Sprintf("customer_%d", time.Now().UnixNano())
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"fmt"
+	"hot-coffee/models"
+	"testing"
+)
+
+func TestConcurrentCustomerWrites(t *testing.T) {
+	s := newTestServices(t)
+
+	// Only one of several customers with the same phone gets in
+	added := concurrently(8, func() error {
+		return s.customers.AddCustomer(&models.Customer{Name: "Ann", Phone: "+15550001"})
+	})
+	if added != 1 {
+		t.Errorf("%d customers with the same phone were added, want 1", added)
+	}
+
+	var ids []string
+	for i := range 8 {
+		customer := &models.Customer{Name: fmt.Sprintf("Customer %d", i)}
+		if err := s.customers.AddCustomer(customer); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, customer.ID)
+	}
+	// Renaming different customers at once keeps every rename
+	next := make(chan string, len(ids))
+	for _, id := range ids {
+		next <- id
+	}
+	concurrently(len(ids), func() error {
+		id := <-next
+		return s.customers.UpdateCustomer(&models.Customer{ID: id, Name: "Renamed " + id})
+	})
+	for _, id := range ids {
+		customer, err := s.customers.GetCustomerByID(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if customer.Name != "Renamed "+id {
+			t.Errorf("customer %s is still called %q", id, customer.Name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"hot-coffee/models"
+	"time"
+)
+
+// StorageChecker is the storage backend as a whole.
+type StorageChecker interface {
+	CheckWritable() error
+	// CheckDecodes reads a whole collection, such as "orders", into v.
+	CheckDecodes(collection string, v any) error
+}
+
+// healthCheck is one readiness check; it fails by returning an error.
+type healthCheck struct {
+	name  string
+	check func() error
+}
+
+// HealthService runs the readiness checks: the storage accepts writes and the orders,
+// menu items and inventory can be read.
+type HealthService struct {
+	checks []healthCheck
+}
+
+func NewHealthService(storage StorageChecker) *HealthService {
+	return &HealthService{checks: []healthCheck{
+		{"storage_writable", storage.CheckWritable},
+		{"orders", func() error { return storage.CheckDecodes("orders", &[]models.Order{}) }},
+		{"menu_items", func() error { return storage.CheckDecodes("menu_items", &[]models.MenuItem{}) }},
+		{"inventory", func() error { return storage.CheckDecodes("inventory", &[]models.InventoryItem{}) }},
+	}}
+}
+
+// Check runs every check at once. A check still running when ctx is done counts as
+// failed, so a hung disk makes the service degraded instead of hanging the probe.
+func (s *HealthService) Check(ctx context.Context) models.HealthReport {
+	type result struct {
+		index   int
+		err     error
+		latency time.Duration
+	}
+	results := make(chan result, len(s.checks))
+	report := models.HealthReport{Status: models.HealthOK, Checks: make([]models.HealthCheck, len(s.checks))}
+	start := time.Now()
+	for i, c := range s.checks {
+		report.Checks[i].Name = c.name
+		go func() {
+			began := time.Now()
+			err := c.check()
+			results <- result{i, err, time.Since(began)}
+		}()
+	}
+
+	finished := make([]bool, len(s.checks))
+wait:
+	for range s.checks {
+		select {
+		case r := <-results:
+			finished[r.index] = true
+			check := &report.Checks[r.index]
+			check.Status, check.LatencyMS = models.HealthOK, milliseconds(r.latency)
+			if r.err != nil {
+				check.Status, check.Error = models.HealthFailed, r.err.Error()
+			}
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	for i := range report.Checks {
+		check := &report.Checks[i]
+		if !finished[i] {
+			check.Status, check.LatencyMS, check.Error = models.HealthFailed, milliseconds(time.Since(start)), "did not finish in time"
+		}
+		if check.Status != models.HealthOK {
+			report.Status = models.HealthDegraded
+		}
+	}
+	return report
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"hot-coffee/config"
+	"hot-coffee/internal/dal"
+	"hot-coffee/internal/events"
+	"hot-coffee/models"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// testServices holds the services wired over a fresh data directory that has a latte
+// (price 4, one espresso shot) and 100 espresso shots in stock.
+type testServices struct {
+	orderRepo *dal.FileOrderRepository
+	menu      *MenuService
+	inventory *InventoryService
+	loyalty   *LoyaltyService
+	orders    *OrderService
+	refunds   *RefundService
+	customers *CustomerService
+	reports   *ReportsService
+	shifts    *ShiftService
+}
+
+func newTestServices(t *testing.T) *testServices {
+	t.Helper()
+	previous := config.Directory
+	config.Directory = filepath.Join(t.TempDir(), "data")
+	t.Cleanup(func() { config.Directory = previous })
+	if err := config.ValidateDirectory(dal.CreateDataFiles); err != nil {
+		t.Fatal(err)
+	}
+
+	orderRepo := &dal.FileOrderRepository{}
+	refundRepo := &dal.FileRefundRepository{}
+	customerRepo := &dal.FileCustomerRepository{}
+	bus := events.NewBus(100)
+	t.Cleanup(bus.Close)
+	audit := NewAuditService(&dal.FileAuditRepository{})
+	inventory := NewInventoryService(&dal.FileInventoryRepository{}, bus, audit)
+	menu := NewMenuService(&dal.FileMenuRepository{}, audit)
+	loyalty := NewLoyaltyService(&dal.FileLoyaltyRepository{}, customerRepo, orderRepo, *menu, audit)
+
+	ctx := context.Background()
+	if err := inventory.AddItem(ctx, &models.InventoryItem{IngredientID: "espresso_shot", Name: "Espresso Shot", Quantity: 100, Unit: "shots"}); err != nil {
+		t.Fatal(err)
+	}
+	latte := &models.MenuItem{ID: "latte", Name: "Latte", Description: "Espresso with steamed milk", Price: 4,
+		Ingredients: []models.MenuItemIngredient{{IngredientID: "espresso_shot", Quantity: 1}}}
+	if err := menu.AddItem(ctx, latte); err != nil {
+		t.Fatal(err)
+	}
+
+	reports := NewReportsService(orderRepo, refundRepo, *menu, models.Pricing{Currency: "USD"})
+	return &testServices{
+		orderRepo: orderRepo,
+		menu:      menu,
+		inventory: inventory,
+		loyalty:   loyalty,
+		orders:    NewOrderService(orderRepo, customerRepo, *menu, *inventory, loyalty, bus, audit),
+		refunds:   NewRefundService(refundRepo, orderRepo, *menu, *inventory, loyalty),
+		customers: NewCustomerService(customerRepo, orderRepo, refundRepo),
+		reports:   reports,
+		shifts:    NewShiftService(&dal.FileShiftRepository{}, &dal.FileZReportRepository{}, reports),
+	}
+}
+
+// closedOrder creates an order of the given lattes and closes it, paid by card.
+func (s *testServices) closedOrder(t *testing.T, lattes int) *models.Order {
+	t.Helper()
+	ctx := context.Background()
+	order := &models.Order{CustomerName: "Ann", Items: []models.OrderItem{{ProductID: "latte", Quantity: lattes}}}
+	if err := s.orders.CreateOrder(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.orders.CloseOrder(ctx, order.ID, models.PaymentCard); err != nil {
+		t.Fatal(err)
+	}
+	closed, err := s.orders.GetOrderByID(order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return closed
+}
+
+// concurrently runs f n times at once and returns how many calls succeeded.
+func concurrently(n int, f func() error) int {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	start := make(chan struct{})
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if f() == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return succeeded
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"hot-coffee/models"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrIdempotencyKeyReused means the key was already used for a different request.
+	ErrIdempotencyKeyReused = &models.Error{Kind: models.ErrUnprocessable, Code: "idempotency_key_reused", Message: "idempotency key was already used with a different request"}
+	// ErrIdempotencyInProgress means the first request with the key has not finished yet.
+	ErrIdempotencyInProgress = models.ConflictError("idempotency_key_in_progress", "a request with this idempotency key is still being processed")
+)
+
+type IdempotencyRepository interface {
+	GetAllRecords() ([]models.IdempotencyRecord, error)
+	SaveRecords(records []models.IdempotencyRecord) error
+}
+
+// IdempotencyService remembers the responses to requests sent with an Idempotency-Key
+// for ttl so that retries get the original response instead of repeating the work. Each
+// user has keys of their own: the same key sent by two users names two requests.
+type IdempotencyService struct {
+	repo IdempotencyRepository
+	ttl  time.Duration
+
+	mu sync.Mutex
+	// inFlight maps the claimed keys, as made by claimKey, to their request hashes
+	inFlight map[string]string
+}
+
+func NewIdempotencyService(repo IdempotencyRepository, ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{repo: repo, ttl: ttl, inFlight: make(map[string]string)}
+}
+
+// Begin claims the user's key for a request with the given hash. It returns the stored
+// record when the request was already completed, or nil when the caller should process it
+// and then call Complete or Release.
+func (s *IdempotencyService) Begin(userID, key, requestHash string) (*models.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if hash, ok := s.inFlight[claimKey(userID, key)]; ok {
+		if hash != requestHash {
+			return nil, ErrIdempotencyKeyReused
+		}
+		return nil, ErrIdempotencyInProgress
+	}
+
+	records, err := s.repo.GetAllRecords()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, record := range records {
+		if record.UserID != userID || record.Key != key || isExpired(record, now) {
+			continue
+		}
+		if record.RequestHash != requestHash {
+			return nil, ErrIdempotencyKeyReused
+		}
+		return &record, nil
+	}
+
+	s.inFlight[claimKey(userID, key)] = requestHash
+	return nil, nil
+}
+
+// Complete stores the response for the record's key and drops records whose time is up.
+func (s *IdempotencyService) Complete(record *models.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inFlight, claimKey(record.UserID, record.Key))
+
+	records, err := s.repo.GetAllRecords()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	record.CreatedAt = now.Format(time.RFC3339)
+	record.ExpiresAt = now.Add(s.ttl).Format(time.RFC3339)
+
+	kept := []models.IdempotencyRecord{}
+	for _, existing := range records {
+		if (existing.UserID != record.UserID || existing.Key != record.Key) && !isExpired(existing, now) {
+			kept = append(kept, existing)
+		}
+	}
+	return s.repo.SaveRecords(append(kept, *record))
+}
+
+// Release gives up the claim on the user's key without storing anything, so the request
+// can be retried.
+func (s *IdempotencyService) Release(userID, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.inFlight, claimKey(userID, key))
+}
+
+func claimKey(userID, key string) string {
+	return userID + "\x00" + key
+}
+
+func isExpired(record models.IdempotencyRecord, now time.Time) bool {
+	expiresAt, err := time.Parse(time.RFC3339, record.ExpiresAt)
+	return err != nil || !expiresAt.After(now)
+}
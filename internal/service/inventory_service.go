@@ -1,28 +1,43 @@
 package service
 
 import (
-	"fmt"
+	"context"
+	"hot-coffee/internal/events"
 	"hot-coffee/models"
+	"slices"
+	"sync"
 )
 
 type InventoryRepository interface {
+	// Locker is held from reading the inventory to saving it
+	sync.Locker
 	AddItem(item *models.InventoryItem) error
 	GetAllItems() ([]models.InventoryItem, error)
 	SaveItems(items []models.InventoryItem) error // Add this line
 	AddInventory(ingredientID string, quantity float64) error
-	// Add other methods as needed
+	QueryItems(query models.InventoryQuery) ([]models.InventoryItem, models.PageInfo, error)
 }
 
 type InventoryService struct {
-	repo InventoryRepository // Ensure this field exists
+	repo   InventoryRepository // Ensure this field exists
+	events *events.Bus
+	audit  *AuditService
 }
 
-func NewInventoryService(repo InventoryRepository) *InventoryService {
-	return &InventoryService{repo: repo}
+func NewInventoryService(repo InventoryRepository, bus *events.Bus, audit *AuditService) *InventoryService {
+	return &InventoryService{repo: repo, events: bus, audit: audit}
 }
 
-func (s *InventoryService) AddItem(item *models.InventoryItem) error {
-	return s.repo.AddItem(item)
+func (s *InventoryService) AddItem(ctx context.Context, item *models.InventoryItem) error {
+	item.Version = 1
+	s.repo.Lock()
+	defer s.repo.Unlock()
+	if err := s.repo.AddItem(item); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, models.EntityInventoryItem, item.IngredientID, models.AuditCreate, nil, item)
+	s.publishStockChange(0, *item)
+	return nil
 }
 
 // service/inventory_service.go
@@ -30,8 +45,30 @@ func (s *InventoryService) GetAllItems() ([]models.InventoryItem, error) {
 	return s.repo.GetAllItems()
 }
 
-func (s *InventoryService) AddInventory(ingredientID string, quantity float64) error {
-	return s.repo.AddInventory(ingredientID, quantity)
+// QueryItems returns one page of the inventory items matching the query.
+func (s *InventoryService) QueryItems(query models.InventoryQuery) (*models.List[models.InventoryItem], error) {
+	items, page, err := s.repo.QueryItems(query)
+	if err != nil {
+		return nil, err
+	}
+	return &models.List[models.InventoryItem]{Data: items, Pagination: page}, nil
+}
+
+func (s *InventoryService) AddInventory(ctx context.Context, ingredientID string, quantity float64) error {
+	s.repo.Lock()
+	defer s.repo.Unlock()
+	before, err := s.GetInventoryItemByID(ingredientID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.AddInventory(ingredientID, quantity); err != nil {
+		return err
+	}
+	if item, err := s.GetInventoryItemByID(ingredientID); err == nil {
+		s.audit.Record(ctx, models.EntityInventoryItem, ingredientID, models.AuditUpdate, before, item)
+		s.publishStockChange(before.Quantity, *item)
+	}
+	return nil
 }
 
 // service/inventory_service.go
@@ -51,7 +88,9 @@ func (s *InventoryService) GetInventoryItemByID(id string) (*models.InventoryIte
 	return nil, models.ErrItemNotFound // You need to define this error
 }
 
-func (s *InventoryService) UpdateItem(item *models.InventoryItem) error {
+func (s *InventoryService) UpdateItem(ctx context.Context, item *models.InventoryItem) error {
+	s.repo.Lock()
+	defer s.repo.Unlock()
 	items, err := s.repo.GetAllItems()
 	if err != nil {
 		return err
@@ -59,18 +98,33 @@ func (s *InventoryService) UpdateItem(item *models.InventoryItem) error {
 
 	for i, existingItem := range items {
 		if existingItem.IngredientID == item.IngredientID {
+			// A non-zero version must match the stored one, otherwise the caller edited a stale copy
+			if item.Version != 0 && item.Version != existingItem.Version {
+				return models.ErrVersionConflict
+			}
+			item.Version = existingItem.Version + 1
 			// Update the existing item with fields from the updated item
+			items[i].Version = item.Version
 			items[i].Name = item.Name         // Assuming "Name" is a field in InventoryItem
 			items[i].Quantity = item.Quantity // Assuming "Quantity" is a field in InventoryItem
+			items[i].ReorderLevel = item.ReorderLevel
 			// Update other fields as needed
-			return s.repo.SaveItems(items) // Save updated items back to the repository
+			if err := s.repo.SaveItems(items); err != nil { // Save updated items back to the repository
+				return err
+			}
+			s.audit.Record(ctx, models.EntityInventoryItem, item.IngredientID, models.AuditUpdate, existingItem, items[i])
+			s.publishStockChange(existingItem.Quantity, items[i])
+			return nil
 		}
 	}
 
 	return models.ErrItemNotFound // Return error if the item is not found
 }
 
-func (s *InventoryService) DeleteItem(id string) error {
+// DeleteItem removes an inventory item. A non-zero version must match the stored one.
+func (s *InventoryService) DeleteItem(ctx context.Context, id string, version int) error {
+	s.repo.Lock()
+	defer s.repo.Unlock()
 	items, err := s.repo.GetAllItems()
 	if err != nil {
 		return err
@@ -78,33 +132,76 @@ func (s *InventoryService) DeleteItem(id string) error {
 
 	for i, existingItem := range items {
 		if existingItem.IngredientID == id {
+			if version != 0 && version != existingItem.Version {
+				return models.ErrVersionConflict
+			}
 			// Remove the item from the slice
 			items = append(items[:i], items[i+1:]...) // Remove item at index i
-			return s.repo.SaveItems(items)            // Save updated items back to the repository
+			if err := s.repo.SaveItems(items); err != nil {
+				return err
+			}
+			s.audit.Record(ctx, models.EntityInventoryItem, id, models.AuditDelete, existingItem, nil)
+			return nil
 		}
 	}
 
 	return models.ErrItemNotFound // Return error if the item is not found
 }
 
-func (s *InventoryService) DeductInventory(ingredientID string, quantity float64) error {
-	// Get all inventory items
+// AdjustStock changes the stock of several ingredients in one step: each quantity is added
+// to its ingredient, negative ones are taken away. Nothing changes unless every ingredient
+// is in the inventory and has enough stock for what is taken.
+func (s *InventoryService) AdjustStock(ctx context.Context, changes map[string]float64) error {
+	s.repo.Lock()
+	defer s.repo.Unlock()
 	items, err := s.repo.GetAllItems()
 	if err != nil {
 		return err
 	}
 
-	// Find the ingredient in the inventory and deduct the quantity
-	for i, item := range items {
-		if item.IngredientID == ingredientID {
-			if item.Quantity < quantity {
-				return fmt.Errorf("insufficient quantity of ingredient %s", ingredientID)
-			}
-			items[i].Quantity -= quantity
-			break
+	before := slices.Clone(items)
+	var changed []int
+	ingredientIDs := make([]string, 0, len(changes))
+	for ingredientID := range changes {
+		ingredientIDs = append(ingredientIDs, ingredientID)
+	}
+	slices.Sort(ingredientIDs)
+	for _, ingredientID := range ingredientIDs {
+		change := changes[ingredientID]
+		if change == 0 {
+			continue
+		}
+		i := slices.IndexFunc(items, func(item models.InventoryItem) bool { return item.IngredientID == ingredientID })
+		if i == -1 {
+			return models.ErrIngredientNotFound
+		}
+		if items[i].Quantity+change < 0 {
+			stockRejections.Inc(ingredientID)
+			return &models.InsufficientStockError{IngredientID: ingredientID, Required: -change, Available: items[i].Quantity}
 		}
+		items[i].Quantity += change
+		items[i].Version++
+		changed = append(changed, i)
+	}
+	if len(changed) == 0 {
+		return nil
 	}
 
-	// Save the updated inventory back to the file
-	return s.repo.SaveItems(items)
+	if err := s.repo.SaveItems(items); err != nil {
+		return err
+	}
+	for _, i := range changed {
+		s.audit.Record(ctx, models.EntityInventoryItem, items[i].IngredientID, models.AuditUpdate, before[i], items[i])
+		s.publishStockChange(before[i].Quantity, items[i])
+	}
+	return nil
+}
+
+// publishStockChange announces a new stock level, and a low stock warning when it is
+// the change that took the item down to its reorder level.
+func (s *InventoryService) publishStockChange(before float64, item models.InventoryItem) {
+	s.events.Publish(events.StockChanged, item)
+	if item.IsLowStock() && before > item.ReorderLevel {
+		s.events.Publish(events.LowStock, item)
+	}
 }
@@ -0,0 +1,520 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hot-coffee/models"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// loyaltyEntrySeq keeps entry IDs unique when several are created within the same clock tick.
+var loyaltyEntrySeq atomic.Int64
+
+type LoyaltyRepository interface {
+	// Locker is held from reading the ledger to appending the entries that depend on it
+	sync.Locker
+	GetAllEntries() ([]models.LoyaltyEntry, error)
+	AddEntries(entries ...models.LoyaltyEntry) error
+	GetSettings() (*models.LoyaltySettings, error)
+	SaveSettings(settings *models.LoyaltySettings) error
+}
+
+type LoyaltyService struct {
+	loyaltyRepo  LoyaltyRepository
+	customerRepo CustomerRepository
+	orderRepo    OrderRepository
+	menuService  MenuService
+	audit        *AuditService
+}
+
+func NewLoyaltyService(loyaltyRepo LoyaltyRepository, customerRepo CustomerRepository, orderRepo OrderRepository, menuService MenuService, audit *AuditService) *LoyaltyService {
+	return &LoyaltyService{
+		loyaltyRepo:  loyaltyRepo,
+		customerRepo: customerRepo,
+		orderRepo:    orderRepo,
+		menuService:  menuService,
+		audit:        audit,
+	}
+}
+
+func (s *LoyaltyService) GetSettings() (*models.LoyaltySettings, error) {
+	return s.loyaltyRepo.GetSettings()
+}
+
+func (s *LoyaltyService) UpdateSettings(settings *models.LoyaltySettings) error {
+	if settings.PointsPerCurrencyUnit < 0 || settings.PointValue < 0 || settings.ExpiryDays < 0 {
+		return models.ValidationError("invalid_loyalty_settings", "loyalty settings cannot be negative")
+	}
+	for productID, multiplier := range settings.ProductMultipliers {
+		if multiplier < 0 {
+			return models.ValidationError("invalid_loyalty_settings", fmt.Sprintf("multiplier for product %s cannot be negative", productID))
+		}
+	}
+	for productID, points := range settings.FreeItemPoints {
+		if points <= 0 {
+			return models.ValidationError("invalid_loyalty_settings", fmt.Sprintf("free item %s must cost at least one point", productID))
+		}
+	}
+	return s.loyaltyRepo.SaveSettings(settings)
+}
+
+// GetBalance returns the points the customer can spend right now. Points that have expired
+// since the last look at the ledger are written off first.
+func (s *LoyaltyService) GetBalance(customerID string) (*models.LoyaltyBalance, error) {
+	s.loyaltyRepo.Lock()
+	defer s.loyaltyRepo.Unlock()
+	return s.balance(customerID)
+}
+
+// balance is GetBalance for callers that hold the ledger's lock.
+func (s *LoyaltyService) balance(customerID string) (*models.LoyaltyBalance, error) {
+	entries, err := s.customerEntries(customerID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := s.loyaltyRepo.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	points, expired := ledgerBalance(entries, time.Now())
+	if len(expired) > 0 {
+		if err := s.loyaltyRepo.AddEntries(expired...); err != nil {
+			return nil, err
+		}
+	}
+
+	return &models.LoyaltyBalance{
+		CustomerID: customerID,
+		Points:     points,
+		Value:      roundMoney(float64(points) * settings.PointValue),
+	}, nil
+}
+
+// GetHistory returns the customer's ledger, including any points that have just expired.
+func (s *LoyaltyService) GetHistory(customerID string) ([]models.LoyaltyEntry, error) {
+	if _, err := s.GetBalance(customerID); err != nil {
+		return nil, err
+	}
+	entries, err := s.customerEntries(customerID)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []models.LoyaltyEntry{}
+	}
+	return entries, nil
+}
+
+// Redeem spends the customer's points on one of their open orders, either as a discount of
+// redemption.Points points or as a free redemption.ProductID from the order.
+func (s *LoyaltyService) Redeem(ctx context.Context, customerID string, redemption *models.LoyaltyRedemption) (*models.Order, error) {
+	// The orders are locked before the ledger, as everywhere else, and both stay locked
+	// until the points are spent, so two redemptions cannot spend the same balance
+	s.orderRepo.Lock()
+	defer s.orderRepo.Unlock()
+	s.loyaltyRepo.Lock()
+	defer s.loyaltyRepo.Unlock()
+	settings, err := s.loyaltyRepo.GetSettings()
+	if err != nil {
+		return nil, err
+	}
+	balance, err := s.balance(customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := s.orderRepo.LoadOrders()
+	if err != nil {
+		return nil, err
+	}
+	index := -1
+	for i, order := range orders {
+		if order.ID == redemption.OrderID {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return nil, models.ErrOrderNotFound
+	}
+	order := &orders[index]
+	if order.CustomerID != customerID {
+		return nil, models.ValidationError("order_customer_mismatch", "order does not belong to this customer")
+	}
+	if order.Status == "closed" {
+		return nil, models.ConflictError("order_not_open", "points can only be redeemed on open orders")
+	}
+
+	var points int
+	var discount float64
+	var note string
+	switch {
+	case redemption.ProductID != "" && redemption.Points != 0:
+		return nil, models.ValidationError("invalid_redemption", "redeem either points or a product, not both")
+	case redemption.ProductID != "":
+		cost, ok := settings.FreeItemPoints[redemption.ProductID]
+		if !ok {
+			return nil, models.ValidationError("product_not_redeemable", "product "+redemption.ProductID+" cannot be redeemed for points")
+		}
+		if !orderContains(order, redemption.ProductID) {
+			return nil, models.ValidationError("product_not_in_order", "product "+redemption.ProductID+" is not part of the order")
+		}
+		menuItem, err := s.menuService.GetMenuItemByID(redemption.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		points, discount, note = cost, menuItem.Price, "free "+redemption.ProductID
+	case redemption.Points > 0:
+		points, discount, note = redemption.Points, float64(redemption.Points)*settings.PointValue, "discount"
+	default:
+		return nil, models.ValidationError("invalid_redemption", "points to redeem must be greater than zero")
+	}
+
+	if points > balance.Points {
+		return nil, models.ConflictError("insufficient_points", fmt.Sprintf("insufficient points: %d available, %d required", balance.Points, points))
+	}
+	subtotal, err := s.menuService.CalculateOrderTotal(order.Items)
+	if err != nil {
+		return nil, err
+	}
+	if order.Discount+discount > subtotal {
+		return nil, models.ValidationError("redemption_exceeds_total", "redemption exceeds the order total")
+	}
+
+	before := *order
+	order.Discount = roundMoney(order.Discount + discount)
+	order.Version++
+	if err := s.orderRepo.SaveOrders(orders); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, models.EntityOrder, order.ID, models.AuditUpdate, before, order)
+	entry := newLoyaltyEntry(customerID, order.ID, models.LoyaltyRedeem, -points, note)
+	entry.ProductID = redemption.ProductID
+	if err := s.loyaltyRepo.AddEntries(entry); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// EarnForOrder credits the customer of a closed order with points for what they paid.
+// Orders without a registered customer, or that already earned points, are skipped.
+func (s *LoyaltyService) EarnForOrder(order *models.Order) error {
+	if order.CustomerID == "" {
+		return nil
+	}
+	s.loyaltyRepo.Lock()
+	defer s.loyaltyRepo.Unlock()
+	entries, err := s.loyaltyRepo.GetAllEntries()
+	if err != nil {
+		return err
+	}
+	if earned, _, _ := orderPoints(entries, order.ID); earned > 0 {
+		return nil
+	}
+	settings, err := s.loyaltyRepo.GetSettings()
+	if err != nil {
+		return err
+	}
+
+	// Points follow the prices the order was charged at, as refunds do; orders closed before
+	// those were recorded fall back to the menu
+	recorded := slices.ContainsFunc(order.Items, func(item models.OrderItem) bool { return item.Price > 0 })
+	var subtotal, base float64
+	for _, item := range order.Items {
+		price := item.Price
+		if !recorded {
+			menuItem, err := s.menuService.GetMenuItemByID(item.ProductID)
+			if err != nil {
+				return err
+			}
+			price = menuItem.Price
+		}
+		line := price * float64(item.Quantity)
+		multiplier, ok := settings.ProductMultipliers[item.ProductID]
+		if !ok {
+			multiplier = 1
+		}
+		subtotal += line
+		base += line * multiplier
+	}
+	// Discounts reduce the points earned in proportion to what was actually paid
+	if subtotal > 0 {
+		base *= order.Total / subtotal
+	}
+	points := int(math.Floor(base * settings.PointsPerCurrencyUnit))
+	if points <= 0 {
+		return nil
+	}
+
+	entry := newLoyaltyEntry(order.CustomerID, order.ID, models.LoyaltyEarn, points, "")
+	if settings.ExpiryDays > 0 {
+		entry.ExpiresAt = time.Now().AddDate(0, 0, settings.ExpiryDays).Format(time.RFC3339)
+	}
+	return s.loyaltyRepo.AddEntries(entry)
+}
+
+// ReverseForRefund takes back the share of the points earned on the order that matches the refunded amount.
+func (s *LoyaltyService) ReverseForRefund(order *models.Order, refund *models.Refund) error {
+	if order.CustomerID == "" || order.Total <= 0 {
+		return nil
+	}
+	s.loyaltyRepo.Lock()
+	defer s.loyaltyRepo.Unlock()
+	entries, err := s.loyaltyRepo.GetAllEntries()
+	if err != nil {
+		return err
+	}
+
+	earned, reversed, _ := orderPoints(entries, order.ID)
+	points := int(math.Round(float64(earned) * refund.Amount / order.Total))
+	if points > earned-reversed {
+		points = earned - reversed
+	}
+	if points <= 0 {
+		return nil
+	}
+	return s.loyaltyRepo.AddEntries(newLoyaltyEntry(order.CustomerID, order.ID, models.LoyaltyReverse, -points, "refund "+refund.ID))
+}
+
+// ReverseForCancellation undoes everything an order did to its customer's points: earned
+// points are taken back and redeemed points are returned.
+func (s *LoyaltyService) ReverseForCancellation(order *models.Order) error {
+	if order.CustomerID == "" {
+		return nil
+	}
+	s.loyaltyRepo.Lock()
+	defer s.loyaltyRepo.Unlock()
+	entries, err := s.loyaltyRepo.GetAllEntries()
+	if err != nil {
+		return err
+	}
+
+	earned, reversed, redeemed := orderPoints(entries, order.ID)
+	var reversals []models.LoyaltyEntry
+	if earned-reversed > 0 {
+		reversals = append(reversals, newLoyaltyEntry(order.CustomerID, order.ID, models.LoyaltyReverse, -(earned-reversed), "order cancelled"))
+	}
+	if redeemed > 0 {
+		reversals = append(reversals, newLoyaltyEntry(order.CustomerID, order.ID, models.LoyaltyReverse, redeemed, "redemption returned"))
+	}
+	if len(reversals) == 0 {
+		return nil
+	}
+	return s.loyaltyRepo.AddEntries(reversals...)
+}
+
+// ReviewRedemptions checks the points redeemed on an order against an edit of it. When the
+// edit moves the order to another customer, drops a product that was redeemed for free or
+// brings the subtotal below the discount, the redeemed points are returned and the edited
+// order's discount is cleared; the customer can redeem again on the new order.
+func (s *LoyaltyService) ReviewRedemptions(existing, edited *models.Order) error {
+	if existing.Discount <= 0 || existing.CustomerID == "" {
+		return nil
+	}
+	s.loyaltyRepo.Lock()
+	defer s.loyaltyRepo.Unlock()
+	entries, err := s.loyaltyRepo.GetAllEntries()
+	if err != nil {
+		return err
+	}
+	subtotal, err := s.menuService.CalculateOrderTotal(edited.Items)
+	if err != nil {
+		return err
+	}
+
+	holds := edited.CustomerID == existing.CustomerID && edited.Discount <= subtotal
+	for _, entry := range activeRedemptions(entries, existing.ID) {
+		if entry.ProductID != "" && !orderContains(edited, entry.ProductID) {
+			holds = false
+		}
+	}
+	if holds {
+		return nil
+	}
+
+	edited.Discount = 0
+	if _, _, redeemed := orderPoints(entries, existing.ID); redeemed > 0 {
+		return s.loyaltyRepo.AddEntries(newLoyaltyEntry(existing.CustomerID, existing.ID, models.LoyaltyReverse, redeemed, "redemption returned after edit"))
+	}
+	return nil
+}
+
+func (s *LoyaltyService) customerEntries(customerID string) ([]models.LoyaltyEntry, error) {
+	customers, err := s.customerRepo.GetAllCustomers()
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, customer := range customers {
+		if customer.ID == customerID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, ErrCustomerNotFound
+	}
+
+	entries, err := s.loyaltyRepo.GetAllEntries()
+	if err != nil {
+		return nil, err
+	}
+	var customerEntries []models.LoyaltyEntry
+	for _, entry := range entries {
+		if entry.CustomerID == customerID {
+			customerEntries = append(customerEntries, entry)
+		}
+	}
+	return customerEntries, nil
+}
+
+// orderPoints sums the points earned on an order, the earned points already taken back
+// and the points redeemed on it that have not been returned yet.
+func orderPoints(entries []models.LoyaltyEntry, orderID string) (earned, reversed, redeemed int) {
+	for _, entry := range entries {
+		if entry.OrderID != orderID {
+			continue
+		}
+		switch {
+		case entry.Type == models.LoyaltyEarn:
+			earned += entry.Points
+		case entry.Type == models.LoyaltyReverse && entry.Points < 0:
+			reversed -= entry.Points
+		case entry.Type == models.LoyaltyRedeem:
+			redeemed -= entry.Points
+		case entry.Type == models.LoyaltyReverse && entry.Points > 0:
+			redeemed -= entry.Points
+		}
+	}
+	return earned, reversed, redeemed
+}
+
+// activeRedemptions returns the redeem entries of an order that have not been returned.
+// Redemptions are only ever returned all at once, so these are the ones after the last return.
+func activeRedemptions(entries []models.LoyaltyEntry, orderID string) []models.LoyaltyEntry {
+	var active []models.LoyaltyEntry
+	for _, entry := range entries {
+		if entry.OrderID != orderID {
+			continue
+		}
+		switch {
+		case entry.Type == models.LoyaltyRedeem:
+			active = append(active, entry)
+		case entry.Type == models.LoyaltyReverse && entry.Points > 0:
+			active = nil
+		}
+	}
+	return active
+}
+
+type loyaltyLot struct {
+	id        string
+	points    int
+	expiresAt time.Time
+}
+
+// ledgerBalance replays a customer's ledger in order. Points are spent first-in first-out,
+// so the oldest points are used before they can expire. It returns the balance at now and
+// expire entries for any lots that ran out without an expire entry in the ledger yet.
+func ledgerBalance(entries []models.LoyaltyEntry, now time.Time) (int, []models.LoyaltyEntry) {
+	var lots []*loyaltyLot
+	var expired []models.LoyaltyEntry
+	deficit := 0
+	recorded := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Type == models.LoyaltyExpire {
+			recorded[entry.LotID] = true
+		}
+	}
+
+	expireUntil := func(t time.Time) {
+		kept := lots[:0]
+		for _, lot := range lots {
+			if lot.expiresAt.IsZero() || lot.expiresAt.After(t) {
+				kept = append(kept, lot)
+				continue
+			}
+			if !recorded[lot.id] {
+				recorded[lot.id] = true
+				expired = append(expired, models.LoyaltyEntry{
+					ID:         "expire_" + lot.id,
+					CustomerID: entries[0].CustomerID,
+					Type:       models.LoyaltyExpire,
+					Points:     -lot.points,
+					LotID:      lot.id,
+					CreatedAt:  lot.expiresAt.Format(time.RFC3339),
+				})
+			}
+		}
+		lots = kept
+	}
+
+	for _, entry := range entries {
+		if entry.Type == models.LoyaltyExpire {
+			continue
+		}
+		if createdAt, err := time.Parse(time.RFC3339, entry.CreatedAt); err == nil {
+			expireUntil(createdAt)
+		}
+
+		if entry.Points > 0 {
+			// New points settle any debt left by earlier reversals first
+			points := entry.Points
+			paid := min(deficit, points)
+			deficit -= paid
+			points -= paid
+			if points > 0 {
+				lot := &loyaltyLot{id: entry.ID, points: points}
+				if expiresAt, err := time.Parse(time.RFC3339, entry.ExpiresAt); err == nil {
+					lot.expiresAt = expiresAt
+				}
+				lots = append(lots, lot)
+			}
+			continue
+		}
+
+		needed := -entry.Points
+		for needed > 0 && len(lots) > 0 {
+			taken := min(needed, lots[0].points)
+			lots[0].points -= taken
+			needed -= taken
+			if lots[0].points == 0 {
+				lots = lots[1:]
+			}
+		}
+		deficit += needed
+	}
+	expireUntil(now)
+
+	balance := -deficit
+	for _, lot := range lots {
+		balance += lot.points
+	}
+	return balance, expired
+}
+
+func orderContains(order *models.Order, productID string) bool {
+	for _, item := range order.Items {
+		if item.ProductID == productID {
+			return true
+		}
+	}
+	return false
+}
+
+func newLoyaltyEntry(customerID, orderID, entryType string, points int, note string) models.LoyaltyEntry {
+	return models.LoyaltyEntry{
+		ID:         fmt.Sprintf("loyalty_%d_%d", time.Now().UnixNano(), loyaltyEntrySeq.Add(1)),
+		CustomerID: customerID,
+		OrderID:    orderID,
+		Type:       entryType,
+		Points:     points,
+		Note:       note,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+	}
+}
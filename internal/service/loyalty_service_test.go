@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"hot-coffee/models"
+	"testing"
+)
+
+func TestEarnForOrderUsesChargedPrices(t *testing.T) {
+	s := newTestServices(t)
+	ctx := context.Background()
+	settings := &models.LoyaltySettings{PointsPerCurrencyUnit: 10, PointValue: 0.1, ProductMultipliers: map[string]float64{"latte": 2}}
+	if err := s.loyalty.UpdateSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	customer := &models.Customer{Name: "Ann"}
+	if err := s.customers.AddCustomer(customer); err != nil {
+		t.Fatal(err)
+	}
+
+	cookie := &models.MenuItem{ID: "cookie", Name: "Cookie", Description: "Oat", Price: 1,
+		Ingredients: []models.MenuItemIngredient{{IngredientID: "espresso_shot", Quantity: 1}}}
+	if err := s.menu.AddItem(ctx, cookie); err != nil {
+		t.Fatal(err)
+	}
+
+	// The latte was charged at 4 and the cookie at 1, before the latte went up
+	latte, err := s.menu.GetMenuItemByID("latte")
+	if err != nil {
+		t.Fatal(err)
+	}
+	latte.Price = 10
+	if err := s.menu.UpdateMenuItem(ctx, latte); err != nil {
+		t.Fatal(err)
+	}
+	order := &models.Order{ID: "order_1", CustomerID: customer.ID, Status: models.OrderClosed, Total: 5,
+		Items: []models.OrderItem{{ProductID: "latte", Quantity: 1, Price: 4}, {ProductID: "cookie", Quantity: 1, Price: 1}}}
+	if err := s.loyalty.EarnForOrder(order); err != nil {
+		t.Fatal(err)
+	}
+
+	balance, err := s.loyalty.GetBalance(customer.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The latte earns double: (4*2 + 1) * 10
+	if balance.Points != 90 {
+		t.Errorf("earned %d points, want 90", balance.Points)
+	}
+}
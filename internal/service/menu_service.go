@@ -1,29 +1,60 @@
 package service
 
-import "hot-coffee/models"
+import (
+	"context"
+	"fmt"
+	"hot-coffee/models"
+	"sync"
+)
 
 type MenuRepository interface {
+	// Locker is held from reading the menu to saving it
+	sync.Locker
 	AddItem(item *models.MenuItem) error
 	GetAllItems() ([]models.MenuItem, error)
 	SaveItems(items []models.MenuItem) error
+	QueryItems(query models.MenuQuery) ([]models.MenuItem, models.PageInfo, error)
 }
 
 type MenuService struct {
-	repo MenuRepository
+	repo  MenuRepository
+	audit *AuditService
 }
 
-func NewMenuService(repo MenuRepository) *MenuService {
-	return &MenuService{repo: repo}
+func NewMenuService(repo MenuRepository, audit *AuditService) *MenuService {
+	return &MenuService{repo: repo, audit: audit}
 }
 
-func (s *MenuService) AddItem(item *models.MenuItem) error {
-	return s.repo.AddItem(item)
+func (s *MenuService) AddItem(ctx context.Context, item *models.MenuItem) error {
+	if err := validateStation(item); err != nil {
+		return err
+	}
+	item.Version = 1
+	s.repo.Lock()
+	defer s.repo.Unlock()
+	if err := s.repo.AddItem(item); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, models.EntityMenuItem, item.ID, models.AuditCreate, nil, item)
+	return nil
 }
 
 func (s *MenuService) GetAllItems() ([]models.MenuItem, error) {
 	return s.repo.GetAllItems()
 }
 
+// QueryItems returns one page of the menu items matching the query.
+func (s *MenuService) QueryItems(query models.MenuQuery) (*models.List[models.MenuItem], error) {
+	if query.MinPrice != nil && query.MaxPrice != nil && *query.MinPrice > *query.MaxPrice {
+		return nil, fmt.Errorf("%w: min_price is above max_price", models.ErrInvalidQuery)
+	}
+	items, page, err := s.repo.QueryItems(query)
+	if err != nil {
+		return nil, err
+	}
+	return &models.List[models.MenuItem]{Data: items, Pagination: page}, nil
+}
+
 func (s *MenuService) GetMenuItemByID(id string) (*models.MenuItem, error) {
 	items, err := s.repo.GetAllItems()
 	if err != nil {
@@ -39,7 +70,12 @@ func (s *MenuService) GetMenuItemByID(id string) (*models.MenuItem, error) {
 	return nil, models.ErrItemNotFound // You need to define this error
 }
 
-func (s *MenuService) UpdateMenuItem(item *models.MenuItem) error {
+func (s *MenuService) UpdateMenuItem(ctx context.Context, item *models.MenuItem) error {
+	if err := validateStation(item); err != nil {
+		return err
+	}
+	s.repo.Lock()
+	defer s.repo.Unlock()
 	items, err := s.repo.GetAllItems()
 	if err != nil {
 		return err
@@ -47,19 +83,33 @@ func (s *MenuService) UpdateMenuItem(item *models.MenuItem) error {
 
 	for i, existingItem := range items {
 		if existingItem.ID == item.ID {
+			// A non-zero version must match the stored one, otherwise the caller edited a stale copy
+			if item.Version != 0 && item.Version != existingItem.Version {
+				return models.ErrVersionConflict
+			}
+			item.Version = existingItem.Version + 1
 			// Update the existing item with fields from the updated item
+			items[i].Version = item.Version
 			items[i].Name = item.Name
 			items[i].Description = item.Description
 			items[i].Price = item.Price
 			items[i].Ingredients = item.Ingredients
-			return s.repo.SaveItems(items) // Save updated items back to the repository
+			items[i].Station = item.Station
+			if err := s.repo.SaveItems(items); err != nil {
+				return err
+			}
+			s.audit.Record(ctx, models.EntityMenuItem, item.ID, models.AuditUpdate, existingItem, items[i])
+			return nil
 		}
 	}
 
 	return models.ErrItemNotFound // Return error if the item is not found
 }
 
-func (s *MenuService) DeleteMenuItem(id string) error {
+// DeleteMenuItem removes a menu item. A non-zero version must match the stored one.
+func (s *MenuService) DeleteMenuItem(ctx context.Context, id string, version int) error {
+	s.repo.Lock()
+	defer s.repo.Unlock()
 	items, err := s.repo.GetAllItems()
 	if err != nil {
 		return err
@@ -67,11 +117,42 @@ func (s *MenuService) DeleteMenuItem(id string) error {
 
 	for i, existingItem := range items {
 		if existingItem.ID == id {
+			if version != 0 && version != existingItem.Version {
+				return models.ErrVersionConflict
+			}
 			// Remove the item from the slice
 			items = append(items[:i], items[i+1:]...) // Remove item at index i
-			return s.repo.SaveItems(items)            // Save updated items back to the repository
+			if err := s.repo.SaveItems(items); err != nil {
+				return err
+			}
+			s.audit.Record(ctx, models.EntityMenuItem, id, models.AuditDelete, existingItem, nil)
+			return nil
 		}
 	}
 
 	return models.ErrItemNotFound // Return error if the item is not found
 }
+
+// CalculateOrderTotal prices the given order lines using the current menu.
+func (s *MenuService) CalculateOrderTotal(items []models.OrderItem) (float64, error) {
+	var total float64
+	for _, item := range items {
+		menuItem, err := s.GetMenuItemByID(item.ProductID)
+		if err != nil {
+			return 0, err
+		}
+		total += menuItem.Price * float64(item.Quantity)
+	}
+	return total, nil
+}
+
+// validateStation defaults items without a station to the bar.
+func validateStation(item *models.MenuItem) error {
+	if item.Station == "" {
+		item.Station = models.StationBar
+	}
+	if item.Station != models.StationBar && item.Station != models.StationKitchen {
+		return models.ValidationError("invalid_station", "station must be "+models.StationBar+" or "+models.StationKitchen)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"hot-coffee/internal/metrics"
+	"log/slog"
+)
+
+var (
+	ordersCreated = metrics.Default.NewCounter("hotcoffee_orders_created_total", "Orders created.")
+	ordersClosed  = metrics.Default.NewCounter("hotcoffee_orders_closed_total", "Orders closed, by payment type.", "payment_type")
+	revenue       = metrics.Default.NewCounter("hotcoffee_revenue_total",
+		"Amount paid for closed orders after discounts, in the configured currency, by payment type.", "payment_type")
+	stockRejections = metrics.Default.NewCounter("hotcoffee_insufficient_stock_rejections_total",
+		"Orders and deductions turned down because an ingredient ran short, by ingredient.", "ingredient")
+	backupsTaken = metrics.Default.NewCounter("hotcoffee_backups_total", "Backups attempted, by result (ok or failed).", "result")
+	lastBackup   = metrics.Default.NewGauge("hotcoffee_last_backup_timestamp_seconds", "Unix time the last successful backup was started.")
+)
+
+// RegisterMetrics adds the stock level of every inventory item to the registry. The
+// levels are read from the repository each time the metrics are scraped.
+func (s *InventoryService) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("hotcoffee_inventory_stock_level", "Quantity in stock, in the item's unit, by ingredient.", []string{"ingredient"},
+		func(observe func(value float64, labelValues ...string)) {
+			items, err := s.repo.GetAllItems()
+			if err != nil {
+				slog.Error("Failed to read stock levels for metrics", slog.String("error", err.Error()))
+				return
+			}
+			for _, item := range items {
+				observe(item.Quantity, item.IngredientID)
+			}
+		})
+}
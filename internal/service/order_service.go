@@ -1,12 +1,26 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"hot-coffee/internal/events"
 	"hot-coffee/models"
+	"log/slog"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// orderSeq keeps order IDs unique when several orders are created within the same second.
+var orderSeq atomic.Int64
+
 type OrderRepository interface {
+	// Locker is held from loading the orders to saving them, by every service that changes them
+	sync.Locker
 	SaveOrder(order *models.Order) error // Add this line
 	GetAllOrders() ([]models.Order, error)
 	GetOrderByID(id string) (*models.Order, error)
@@ -14,179 +28,316 @@ type OrderRepository interface {
 	DeleteOrder(orderID string) error
 	LoadOrders() ([]models.Order, error)
 	SaveOrders(orders []models.Order) error
+	QueryOrders(query models.OrderQuery) ([]models.Order, models.PageInfo, error)
 }
 
 type OrderService struct {
 	orderRepo        OrderRepository
+	customerRepo     CustomerRepository
 	menuService      MenuService
 	inventoryService InventoryService
+	loyaltyService   *LoyaltyService
+	events           *events.Bus
+	audit            *AuditService
 }
 
-func NewOrderService(orderRepo OrderRepository, menuService MenuService, inventoryService InventoryService) *OrderService {
-	return &OrderService{orderRepo, menuService, inventoryService}
+func NewOrderService(orderRepo OrderRepository, customerRepo CustomerRepository, menuService MenuService, inventoryService InventoryService, loyaltyService *LoyaltyService, bus *events.Bus, audit *AuditService) *OrderService {
+	return &OrderService{orderRepo, customerRepo, menuService, inventoryService, loyaltyService, bus, audit}
 }
 
 func (s *OrderService) GetAllOrders() ([]models.Order, error) {
 	return s.orderRepo.GetAllOrders()
 }
 
+// QueryOrders returns one page of the orders matching the query.
+func (s *OrderService) QueryOrders(query models.OrderQuery) (*models.List[models.Order], error) {
+	orders, page, err := s.orderRepo.QueryOrders(query)
+	if err != nil {
+		return nil, err
+	}
+	return &models.List[models.Order]{Data: orders, Pagination: page}, nil
+}
+
 func (s *OrderService) GetOrderByID(id string) (*models.Order, error) {
 	return s.orderRepo.GetOrderByID(id)
 }
 
-func (s *OrderService) UpdateOrder(order *models.Order) error {
+func (s *OrderService) UpdateOrder(ctx context.Context, order *models.Order) error {
+	s.orderRepo.Lock()
+	defer s.orderRepo.Unlock()
 	// Get the existing order to restore inventory
 	existingOrder, err := s.orderRepo.GetOrderByID(order.ID)
 	if err != nil {
-		return errors.New("order not found")
+		return models.ErrOrderNotFound
 	}
 	// Restrict updates to closed orders
 	if existingOrder.Status == "closed" {
-		return errors.New("cannot update a closed order")
+		return models.ConflictError("order_closed", "cannot update a closed order")
+	}
+	// A non-zero version must match the stored one, otherwise the caller edited a stale copy
+	if order.Version != 0 && order.Version != existingOrder.Version {
+		return models.ErrVersionConflict
 	}
-	// Return previous quantities to the inventory
-	if err := s.returnInventoryForOrder(existingOrder); err != nil {
+	order.Version = existingOrder.Version + 1
+	if err := s.resolveCustomer(order); err != nil {
 		return err
 	}
-
-	// Check and deduct inventory for the new order data
-	if err := s.checkAndDeductInventoryForOrder(order); err != nil {
+	// The ingredients of the old lines go back and those of the new lines are taken in one
+	// step, and are put back as they were if the edit goes no further
+	returned, err := s.ingredientsFor(existingOrder.Items)
+	if err != nil {
+		return err
+	}
+	taken, err := s.ingredientsFor(order.Items)
+	if err != nil {
+		return err
+	}
+	change := stockChange(returned, taken)
+	if err := s.inventoryService.AdjustStock(ctx, change); err != nil {
 		return err
 	}
 
-	// Update the order's created time
-	order.CreatedAt = time.Now().Format(time.RFC3339)
+	// An edit keeps the order's place in the queue and the progress of lines it leaves alone
+	order.CreatedAt = existingOrder.CreatedAt
+	order.Items = carryPrepStatus(existingOrder.Items, order.Items)
+	// Discounts only come from redeemed points, which must still cover the edited order
+	order.Discount = existingOrder.Discount
+	if err := s.loyaltyService.ReviewRedemptions(existingOrder, order); err != nil {
+		s.undoStockChange(ctx, order.ID, change)
+		return err
+	}
 
 	// Save the updated order
-	return s.orderRepo.UpdateOrder(order)
+	if err := s.orderRepo.UpdateOrder(order); err != nil {
+		s.undoStockChange(ctx, order.ID, change)
+		return err
+	}
+	s.audit.Record(ctx, models.EntityOrder, order.ID, models.AuditUpdate, existingOrder, order)
+	s.events.Publish(events.OrderUpdated, *order)
+	return nil
+}
+
+// carryPrepStatus returns the updated lines with the preparation progress of the
+// existing lines they repeat, matched by product and quantity. Lines that are new or
+// changed start over as pending; the progress sent by the client is ignored.
+func carryPrepStatus(existing, updated []models.OrderItem) []models.OrderItem {
+	items := make([]models.OrderItem, len(updated))
+	used := make([]bool, len(existing))
+	for i, item := range updated {
+		items[i] = models.OrderItem{ProductID: item.ProductID, Quantity: item.Quantity}
+		for j, previous := range existing {
+			if !used[j] && previous.ProductID == item.ProductID && previous.Quantity == item.Quantity {
+				used[j] = true
+				items[i].PrepStatus, items[i].StartedAt, items[i].DoneAt = previous.PrepStatus, previous.StartedAt, previous.DoneAt
+				break
+			}
+		}
+	}
+	return items
 }
 
-func (s *OrderService) CloseOrder(orderID string) error {
-	// Load all orders
+func (s *OrderService) CloseOrder(ctx context.Context, orderID string, paymentType string) error {
+	if paymentType == "" {
+		paymentType = models.PaymentCash
+	}
+	if !models.IsValidPaymentType(paymentType) {
+		return models.ValidationError("invalid_payment_type", "invalid payment type "+paymentType)
+	}
+
+	s.orderRepo.Lock()
+	defer s.orderRepo.Unlock()
 	orders, err := s.orderRepo.LoadOrders()
 	if err != nil {
 		return errors.New("failed to load orders")
 	}
 
-	// Flag to track if the order was found and updated
-	orderFound := false
+	// Track the order that was found and updated
+	var openOrder, closedOrder *models.Order
 
 	// Walk through the orders and update the status if ID matches
 	for i, order := range orders {
 		if order.ID == orderID {
 			if orders[i].Status == "closed" {
-				return errors.New("Order is already closed.")
+				return models.ErrOrderClosed
+			}
+			// Record what the customer paid, and for which line, so later refunds give back
+			// what was charged even when menu prices change
+			var total float64
+			orders[i].Items = slices.Clone(order.Items)
+			for j, item := range orders[i].Items {
+				menuItem, err := s.menuService.GetMenuItemByID(item.ProductID)
+				if err != nil {
+					return err
+				}
+				orders[i].Items[j].Price = menuItem.Price
+				total += menuItem.Price * float64(item.Quantity)
 			}
 			// Update the status to "closed"
 			orders[i].Status = "closed"
-			orderFound = true
+			orders[i].ClosedAt = time.Now().Format(time.RFC3339)
+			orders[i].PaymentType = paymentType
+			orders[i].Total = math.Max(total-order.Discount, 0)
+			orders[i].Version++
+			openOrder, closedOrder = &order, &orders[i]
 			break
 		}
 	}
 
 	// If order not found, return an error
-	if !orderFound {
-		return errors.New("order not found")
+	if closedOrder == nil {
+		return models.ErrOrderNotFound
 	}
 
 	// Save the updated orders list back to the repository
-	return s.orderRepo.SaveOrders(orders)
+	if err := s.orderRepo.SaveOrders(orders); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, models.EntityOrder, orderID, models.AuditUpdate, openOrder, closedOrder)
+
+	ordersClosed.Inc(paymentType)
+	revenue.Add(closedOrder.Total, paymentType)
+
+	s.events.Publish(events.OrderStatusChanged, map[string]string{"order_id": orderID, "from": "open", "to": "closed"})
+	s.events.Publish(events.OrderClosed, *closedOrder)
+
+	// The order is paid for; a loyalty hiccup must not make it look unclosed
+	if err := s.loyaltyService.EarnForOrder(closedOrder); err != nil {
+		slog.ErrorContext(ctx, "Failed to award loyalty points", slog.String("orderID", orderID), slog.String("error", err.Error()))
+	}
+	return nil
 }
 
-func (s *OrderService) CreateOrder(order *models.Order) error {
-	// Check inventory and deduct quantities
-	if err := s.checkAndDeductInventoryForOrder(order); err != nil {
+func (s *OrderService) CreateOrder(ctx context.Context, order *models.Order) error {
+	if err := s.resolveCustomer(order); err != nil {
+		return err
+	}
+
+	// Take the ingredients from the inventory, all of them or none
+	taken, err := s.ingredientsFor(order.Items)
+	if err != nil {
+		return err
+	}
+	change := stockChange(nil, taken)
+	if err := s.inventoryService.AdjustStock(ctx, change); err != nil {
 		return err
 	}
 
 	// Generate unique order ID and set the created time
 	order.ID = generateOrderID()
+	order.Version = 1
 	order.CreatedAt = time.Now().Format(time.RFC3339)
 
 	// Save order
-	return s.orderRepo.SaveOrder(order)
+	s.orderRepo.Lock()
+	err = s.orderRepo.SaveOrder(order)
+	s.orderRepo.Unlock()
+	if err != nil {
+		s.undoStockChange(ctx, order.ID, change)
+		return err
+	}
+	s.audit.Record(ctx, models.EntityOrder, order.ID, models.AuditCreate, nil, order)
+	ordersCreated.Inc()
+	s.events.Publish(events.OrderCreated, *order)
+	return nil
 }
 
-func (s *OrderService) DeleteOrder(orderID string) error {
+// DeleteOrder removes an order and returns its ingredients to the inventory.
+// A non-zero version must match the stored one.
+func (s *OrderService) DeleteOrder(ctx context.Context, orderID string, version int) error {
+	s.orderRepo.Lock()
+	defer s.orderRepo.Unlock()
 	// Retrieve the order to check if it exists and for possible inventory adjustments
 	existingOrder, err := s.orderRepo.GetOrderByID(orderID)
 	if err != nil {
-		return errors.New("order not found")
+		return models.ErrOrderNotFound
+	}
+	if version != 0 && version != existingOrder.Version {
+		return models.ErrVersionConflict
 	}
 
-	// Adjust inventory quantities before deletion
-	for _, item := range existingOrder.Items {
-		menuItem, err := s.menuService.GetMenuItemByID(item.ProductID)
-		if err != nil {
-			return err
-		}
-		for _, ingredient := range menuItem.Ingredients {
-			quantityToAdd := ingredient.Quantity * float64(item.Quantity)
-			if err := s.inventoryService.AddInventory(ingredient.IngredientID, quantityToAdd); err != nil {
-				return err
-			}
-		}
+	// Return the ingredients to the inventory, and take them again if the order stays
+	returned, err := s.ingredientsFor(existingOrder.Items)
+	if err != nil {
+		return err
+	}
+	change := stockChange(returned, nil)
+	if err := s.inventoryService.AdjustStock(ctx, change); err != nil {
+		return err
 	}
 
 	// Delete the order
-	return s.orderRepo.DeleteOrder(orderID)
+	if err := s.orderRepo.DeleteOrder(orderID); err != nil {
+		s.undoStockChange(ctx, orderID, change)
+		return err
+	}
+	s.audit.Record(ctx, models.EntityOrder, orderID, models.AuditDelete, existingOrder, nil)
+	s.events.Publish(events.OrderDeleted, map[string]string{"order_id": orderID})
+
+	if err := s.loyaltyService.ReverseForCancellation(existingOrder); err != nil {
+		slog.ErrorContext(ctx, "Failed to reverse loyalty points", slog.String("orderID", orderID), slog.String("error", err.Error()))
+	}
+	return nil
 }
 
-func (s *OrderService) checkAndDeductInventoryForOrder(order *models.Order) error {
-	// Check if all items are available in the menu
-	for _, item := range order.Items {
+// ingredientsFor sums the ingredients the items are made from.
+func (s *OrderService) ingredientsFor(items []models.OrderItem) (map[string]float64, error) {
+	ingredients := make(map[string]float64)
+	for _, item := range items {
 		menuItem, err := s.menuService.GetMenuItemByID(item.ProductID)
 		if err != nil {
-			return errors.New("product not found in menu")
+			return nil, models.ErrProductNotFound
 		}
-
-		// Check inventory availability
 		for _, ingredient := range menuItem.Ingredients {
-			inventoryItem, err := s.inventoryService.GetInventoryItemByID(ingredient.IngredientID)
-			if err != nil {
-				return errors.New("ingredient not found in inventory")
-			}
-			requiredQty := ingredient.Quantity * float64(item.Quantity)
-			if inventoryItem.Quantity < requiredQty {
-				return errors.New("insufficient ingredient quantity for " + ingredient.IngredientID)
-			}
+			ingredients[ingredient.IngredientID] += ingredient.Quantity * float64(item.Quantity)
 		}
 	}
+	return ingredients, nil
+}
 
-	// Deduct inventory quantities
-	for _, item := range order.Items {
-		menuItem, _ := s.menuService.GetMenuItemByID(item.ProductID)
-		for _, ingredient := range menuItem.Ingredients {
-			requiredQty := ingredient.Quantity * float64(item.Quantity)
-			err := s.inventoryService.DeductInventory(ingredient.IngredientID, requiredQty)
-			if err != nil {
-				return err
-			}
-		}
+// stockChange is the change to the inventory that puts back the returned ingredients and
+// takes the taken ones.
+func stockChange(returned, taken map[string]float64) map[string]float64 {
+	change := maps.Clone(returned)
+	if change == nil {
+		change = make(map[string]float64)
 	}
+	for ingredientID, quantity := range taken {
+		change[ingredientID] -= quantity
+	}
+	return change
+}
 
-	return nil
+// undoStockChange reverts a stock change made for an order that was then not saved.
+func (s *OrderService) undoStockChange(ctx context.Context, orderID string, change map[string]float64) {
+	undo := make(map[string]float64, len(change))
+	for ingredientID, quantity := range change {
+		undo[ingredientID] = -quantity
+	}
+	if err := s.inventoryService.AdjustStock(ctx, undo); err != nil {
+		slog.ErrorContext(ctx, "Failed to undo stock change", slog.String("orderID", orderID), slog.String("error", err.Error()))
+	}
 }
 
-func (s *OrderService) returnInventoryForOrder(order *models.Order) error {
-	for _, item := range order.Items {
-		menuItem, err := s.menuService.GetMenuItemByID(item.ProductID)
-		if err != nil {
-			return errors.New("product not found in menu")
-		}
+// resolveCustomer checks that an order placed for a registered customer refers to an existing
+// one and copies the customer's name onto the order.
+func (s *OrderService) resolveCustomer(order *models.Order) error {
+	if order.CustomerID == "" {
+		return nil
+	}
 
-		for _, ingredient := range menuItem.Ingredients {
-			returnQty := ingredient.Quantity * float64(item.Quantity)
-			err := s.inventoryService.AddInventory(ingredient.IngredientID, returnQty)
-			if err != nil {
-				return err
-			}
+	customers, err := s.customerRepo.GetAllCustomers()
+	if err != nil {
+		return err
+	}
+	for _, customer := range customers {
+		if customer.ID == order.CustomerID {
+			order.CustomerName = customer.Name
+			return nil
 		}
 	}
-	return nil
+	return ErrCustomerNotFound
 }
 
 func generateOrderID() string {
-	// Generate a unique ID; you may use a more complex logic
-	return "order_" + time.Now().Format("20060102150405")
+	return fmt.Sprintf("order_%s_%d", time.Now().Format("20060102150405"), orderSeq.Add(1))
 }
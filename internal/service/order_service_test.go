@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"hot-coffee/internal/dal"
+	"hot-coffee/internal/events"
+	"hot-coffee/models"
+	"testing"
+)
+
+func TestGenerateOrderIDIsUniqueWithinASecond(t *testing.T) {
+	seen := make(map[string]bool)
+	for range 1000 {
+		id := generateOrderID()
+		if seen[id] {
+			t.Fatalf("order ID %s was generated twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+// stockOf returns the quantity of an ingredient in stock.
+func stockOf(t *testing.T, s *testServices, ingredientID string) float64 {
+	t.Helper()
+	item, err := s.inventory.GetInventoryItemByID(ingredientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item.Quantity
+}
+
+func TestConcurrentOrdersTakeWholeRecipes(t *testing.T) {
+	s := newTestServices(t)
+	ctx := context.Background()
+	if err := s.inventory.AddItem(ctx, &models.InventoryItem{IngredientID: "milk", Name: "Milk", Quantity: 5, Unit: "cups"}); err != nil {
+		t.Fatal(err)
+	}
+	flatWhite := &models.MenuItem{ID: "flat_white", Name: "Flat White", Description: "Espresso with a little milk", Price: 4,
+		Ingredients: []models.MenuItemIngredient{{IngredientID: "espresso_shot", Quantity: 1}, {IngredientID: "milk", Quantity: 1}}}
+	if err := s.menu.AddItem(ctx, flatWhite); err != nil {
+		t.Fatal(err)
+	}
+
+	created := concurrently(8, func() error {
+		order := &models.Order{CustomerName: "Ann", Items: []models.OrderItem{{ProductID: "flat_white", Quantity: 1}}}
+		return s.orders.CreateOrder(ctx, order)
+	})
+	if created != 5 {
+		t.Errorf("%d orders were created, want 5", created)
+	}
+	if milk := stockOf(t, s, "milk"); milk != 0 {
+		t.Errorf("milk stock = %v, want 0", milk)
+	}
+	if shots := stockOf(t, s, "espresso_shot"); shots != 95 {
+		t.Errorf("espresso stock = %v, want 95", shots)
+	}
+}
+
+func TestUpdateOrderWithoutStockKeepsTheOrderAndStock(t *testing.T) {
+	s := newTestServices(t)
+	ctx := context.Background()
+	order := &models.Order{CustomerName: "Ann", Items: []models.OrderItem{{ProductID: "latte", Quantity: 2}}}
+	if err := s.orders.CreateOrder(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+
+	update := &models.Order{ID: order.ID, CustomerName: "Ann", Items: []models.OrderItem{{ProductID: "latte", Quantity: 500}}}
+	var stockErr *models.InsufficientStockError
+	if err := s.orders.UpdateOrder(ctx, update); !errors.As(err, &stockErr) {
+		t.Fatalf("update error = %v, want insufficient stock", err)
+	}
+	if shots := stockOf(t, s, "espresso_shot"); shots != 98 {
+		t.Errorf("espresso stock = %v, want 98", shots)
+	}
+}
+
+// failingOrderRepository saves orders but fails to write their changes.
+type failingOrderRepository struct {
+	*dal.FileOrderRepository
+}
+
+func (r failingOrderRepository) UpdateOrder(*models.Order) error {
+	return errors.New("disk full")
+}
+
+func (r failingOrderRepository) DeleteOrder(string) error {
+	return errors.New("disk full")
+}
+
+func TestFailedOrderWritesLeaveStockAlone(t *testing.T) {
+	s := newTestServices(t)
+	ctx := context.Background()
+	bus := events.NewBus(100)
+	t.Cleanup(bus.Close)
+	orders := NewOrderService(failingOrderRepository{s.orderRepo}, &dal.FileCustomerRepository{}, *s.menu, *s.inventory, s.loyalty, bus, NewAuditService(&dal.FileAuditRepository{}))
+	order := &models.Order{CustomerName: "Ann", Items: []models.OrderItem{{ProductID: "latte", Quantity: 2}}}
+	if err := orders.CreateOrder(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+
+	update := &models.Order{ID: order.ID, CustomerName: "Ann", Items: []models.OrderItem{{ProductID: "latte", Quantity: 5}}}
+	if err := orders.UpdateOrder(ctx, update); err == nil {
+		t.Fatal("update succeeded, want the write to fail")
+	}
+	if shots := stockOf(t, s, "espresso_shot"); shots != 98 {
+		t.Errorf("espresso stock after failed update = %v, want 98", shots)
+	}
+
+	if err := orders.DeleteOrder(ctx, order.ID, 0); err == nil {
+		t.Fatal("delete succeeded, want the write to fail")
+	}
+	if shots := stockOf(t, s, "espresso_shot"); shots != 98 {
+		t.Errorf("espresso stock after failed delete = %v, want 98", shots)
+	}
+}
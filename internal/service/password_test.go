@@ -0,0 +1,51 @@
+package service
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// The RFC 6070 inputs with the keys PBKDF2-HMAC-SHA256 derives from them.
+func TestPBKDF2SHA256KnownAnswers(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"password", "salt", 1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{"password", "salt", 2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"password", "salt", 4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, "348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1c635518c7dac47e9"},
+		{"pass\x00word", "sa\x00lt", 4096, "89b69d0516f829893c696226650a8687"},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%q/%d", test.password, test.iterations), func(t *testing.T) {
+			got := pbkdf2SHA256([]byte(test.password), []byte(test.salt), test.iterations, len(test.want)/2)
+			if hex.EncodeToString(got) != test.want {
+				t.Errorf("key = %x, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := HashPassword("correct-horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !CheckPassword(hash, "correct-horse") {
+		t.Error("the right password was rejected")
+	}
+	if CheckPassword(hash, "correct-horsf") {
+		t.Error("a wrong password was accepted")
+	}
+}
+
+func TestDummyPasswordHashCostsAsMuchAsARealOne(t *testing.T) {
+	prefix := fmt.Sprintf("%s$%d$", passwordHashScheme, passwordHashIterations)
+	if hash := dummyPasswordHash(); !strings.HasPrefix(hash, prefix) {
+		t.Errorf("dummy hash %s does not start with %s", hash, prefix)
+	}
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hot-coffee/internal/events"
+	"hot-coffee/models"
+	"slices"
+	"sort"
+	"time"
+)
+
+type QueueService struct {
+	orderRepo   OrderRepository
+	menuService MenuService
+	events      *events.Bus
+	audit       *AuditService
+}
+
+func NewQueueService(orderRepo OrderRepository, menuService MenuService, bus *events.Bus, audit *AuditService) *QueueService {
+	return &QueueService{orderRepo: orderRepo, menuService: menuService, events: bus, audit: audit}
+}
+
+// GetQueue lists open orders first-in first-out with the lines to prepare at the given
+// station (all stations when empty). Orders with nothing left to prepare are left out
+// unless includeDone is set.
+func (s *QueueService) GetQueue(station string, includeDone bool) ([]models.QueueEntry, error) {
+	if station != "" && station != models.StationBar && station != models.StationKitchen {
+		return nil, models.ValidationError("invalid_station", "station must be "+models.StationBar+" or "+models.StationKitchen)
+	}
+
+	orders, err := s.orderRepo.GetAllOrders()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	queue := []models.QueueEntry{}
+	for _, order := range orders {
+		if order.Status != "open" {
+			continue
+		}
+
+		entry := models.QueueEntry{
+			OrderID:      order.ID,
+			CustomerName: order.CustomerName,
+			CreatedAt:    order.CreatedAt,
+		}
+		if createdAt, err := time.Parse(time.RFC3339, order.CreatedAt); err == nil {
+			entry.WaitSeconds = int64(now.Sub(createdAt).Seconds())
+		}
+
+		pending := false
+		for i, item := range order.Items {
+			line := models.QueueLine{
+				Line:       i,
+				ProductID:  item.ProductID,
+				Quantity:   item.Quantity,
+				Station:    models.StationBar,
+				PrepStatus: item.PrepStatus,
+				StartedAt:  item.StartedAt,
+				DoneAt:     item.DoneAt,
+			}
+			if line.PrepStatus == "" {
+				line.PrepStatus = models.PrepPending
+			}
+			// Lines for products that left the menu still have to be made
+			if menuItem, err := s.menuService.GetMenuItemByID(item.ProductID); err == nil {
+				line.Name = menuItem.Name
+				if menuItem.Station != "" {
+					line.Station = menuItem.Station
+				}
+			}
+			if station != "" && line.Station != station {
+				continue
+			}
+			if line.PrepStatus != models.PrepDone {
+				pending = true
+			}
+			entry.Lines = append(entry.Lines, line)
+		}
+
+		if len(entry.Lines) == 0 || (!pending && !includeDone) {
+			continue
+		}
+		queue = append(queue, entry)
+	}
+
+	// Longest waiting first; orders created in the same second keep their stored order
+	sort.SliceStable(queue, func(i, j int) bool {
+		return queue[i].WaitSeconds > queue[j].WaitSeconds
+	})
+	return queue, nil
+}
+
+// UpdateLineStatus moves a line of an open order to started or done. Lines only move forward.
+func (s *QueueService) UpdateLineStatus(ctx context.Context, orderID string, line int, status string) (*models.Order, error) {
+	if status != models.PrepStarted && status != models.PrepDone {
+		return nil, models.ValidationError("invalid_prep_status", "status must be "+models.PrepStarted+" or "+models.PrepDone)
+	}
+
+	s.orderRepo.Lock()
+	defer s.orderRepo.Unlock()
+	orders, err := s.orderRepo.LoadOrders()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		order := &orders[i]
+		if order.ID != orderID {
+			continue
+		}
+		if order.Status != "open" {
+			return nil, models.ErrOrderNotOpen
+		}
+		if line < 0 || line >= len(order.Items) {
+			return nil, models.NotFoundError("line_not_found", fmt.Sprintf("order has no line %d", line))
+		}
+
+		before := *order
+		before.Items = slices.Clone(order.Items)
+		item := &order.Items[line]
+		now := time.Now().Format(time.RFC3339)
+		switch {
+		case item.PrepStatus == models.PrepDone:
+			return nil, models.ConflictError("line_already_done", fmt.Sprintf("line %d is already done", line))
+		case item.PrepStatus == models.PrepStarted && status == models.PrepStarted:
+			return nil, models.ConflictError("line_already_started", fmt.Sprintf("line %d is already started", line))
+		case status == models.PrepStarted:
+			item.StartedAt = now
+		default:
+			if item.StartedAt == "" {
+				item.StartedAt = now
+			}
+			item.DoneAt = now
+		}
+		item.PrepStatus = status
+		order.Version++
+
+		if err := s.orderRepo.SaveOrders(orders); err != nil {
+			return nil, err
+		}
+		s.audit.Record(ctx, models.EntityOrder, orderID, models.AuditUpdate, before, order)
+		s.events.Publish(events.OrderUpdated, *order)
+		return order, nil
+	}
+	return nil, models.ErrOrderNotFound
+}
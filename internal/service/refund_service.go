@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hot-coffee/models"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+type RefundRepository interface {
+	// Locker is held from reading an order's refunds to saving a new one
+	sync.Locker
+	SaveRefund(refund *models.Refund) error
+	GetAllRefunds() ([]models.Refund, error)
+	GetRefundsByOrderID(orderID string) ([]models.Refund, error)
+}
+
+type RefundService struct {
+	refundRepo       RefundRepository
+	orderRepo        OrderRepository
+	menuService      MenuService
+	inventoryService InventoryService
+	loyaltyService   *LoyaltyService
+}
+
+func NewRefundService(refundRepo RefundRepository, orderRepo OrderRepository, menuService MenuService, inventoryService InventoryService, loyaltyService *LoyaltyService) *RefundService {
+	return &RefundService{
+		refundRepo:       refundRepo,
+		orderRepo:        orderRepo,
+		menuService:      menuService,
+		inventoryService: inventoryService,
+		loyaltyService:   loyaltyService,
+	}
+}
+
+func (s *RefundService) GetRefundsByOrderID(orderID string) ([]models.Refund, error) {
+	if _, err := s.orderRepo.GetOrderByID(orderID); err != nil {
+		return nil, models.ErrOrderNotFound
+	}
+	return s.refundRepo.GetRefundsByOrderID(orderID)
+}
+
+// CreateRefund refunds the requested lines of a closed order. When refund.Items is empty
+// everything that has not been refunded yet is refunded. Ingredients of the refunded
+// lines are either returned to the inventory or recorded on the refund as waste.
+func (s *RefundService) CreateRefund(ctx context.Context, orderID string, refund *models.Refund) error {
+	order, err := s.orderRepo.GetOrderByID(orderID)
+	if err != nil {
+		return models.ErrOrderNotFound
+	}
+	// Only paid (closed) orders can be refunded; open orders are simply updated or deleted
+	if order.Status != "closed" {
+		return models.ConflictError("order_not_closed", "only closed orders can be refunded")
+	}
+
+	// Refunds of the same order must see each other, or together they could give back more
+	// than was paid
+	s.refundRepo.Lock()
+	defer s.refundRepo.Unlock()
+	previous, err := s.refundRepo.GetRefundsByOrderID(orderID)
+	if err != nil {
+		return err
+	}
+
+	// Work out how many of each product is still refundable
+	remaining := make(map[string]int)
+	for _, item := range order.Items {
+		remaining[item.ProductID] += item.Quantity
+	}
+	var refunded float64
+	for _, r := range previous {
+		refunded += r.Amount
+		for _, item := range r.Items {
+			remaining[item.ProductID] -= item.Quantity
+		}
+	}
+
+	if len(refund.Items) == 0 {
+		for _, item := range order.Items {
+			if remaining[item.ProductID] > 0 {
+				refund.Items = append(refund.Items, models.RefundItem{ProductID: item.ProductID, Quantity: remaining[item.ProductID]})
+				remaining[item.ProductID] = 0
+			}
+		}
+		if len(refund.Items) == 0 {
+			return models.ConflictError("already_refunded", "order has already been fully refunded")
+		}
+	} else {
+		for _, item := range refund.Items {
+			if item.Quantity <= 0 {
+				return models.ValidationError("invalid_refund_quantity", fmt.Sprintf("refund quantity for item %s must be greater than zero", item.ProductID))
+			}
+			if item.Quantity > remaining[item.ProductID] {
+				return models.ValidationError("refund_exceeds_order", fmt.Sprintf("cannot refund %d of item %s, only %d left to refund", item.Quantity, item.ProductID, remaining[item.ProductID]))
+			}
+			remaining[item.ProductID] -= item.Quantity
+		}
+	}
+
+	// Price the refunded lines at what was charged for them, with the order's discount
+	// shared out over the lines in proportion to their price
+	prices, paid, err := paidPrices(order, s.menuService)
+	if err != nil {
+		return err
+	}
+	if paid <= 0 {
+		return models.ConflictError("nothing_paid", "nothing was paid for this order")
+	}
+	refund.Amount = 0
+	for i, item := range refund.Items {
+		refund.Items[i].Amount = roundMoney(prices[item.ProductID] * float64(item.Quantity))
+		refund.Amount += refund.Items[i].Amount
+	}
+
+	// Rounding the lines must not give back more than was paid
+	if refund.Amount > paid-refunded {
+		refund.Amount = math.Max(paid-refunded, 0)
+	}
+	if refund.Amount <= 0 {
+		return models.ConflictError("already_refunded", "nothing left to refund on this order")
+	}
+
+	if err := s.disposeIngredients(ctx, refund); err != nil {
+		return err
+	}
+
+	refund.ID = generateRefundID()
+	refund.OrderID = orderID
+	refund.PaymentType = order.PaymentType
+	if refund.PaymentType == "" {
+		refund.PaymentType = models.PaymentCash
+	}
+	refund.CreatedAt = time.Now().Format(time.RFC3339)
+	if err := s.refundRepo.SaveRefund(refund); err != nil {
+		return err
+	}
+
+	if err := s.loyaltyService.ReverseForRefund(order, refund); err != nil {
+		slog.ErrorContext(ctx, "Failed to reverse loyalty points", slog.String("orderID", orderID), slog.String("error", err.Error()))
+	}
+	return nil
+}
+
+// paidPrices returns the unit price each product of a closed order was actually paid at,
+// its discount taken off, and the order's total. Orders closed before line prices were
+// recorded are priced from the current menu; those closed before totals were recorded
+// have neither a total nor a discount, and are taken to be paid in full.
+func paidPrices(order *models.Order, menuService MenuService) (map[string]float64, float64, error) {
+	recorded := slices.ContainsFunc(order.Items, func(item models.OrderItem) bool { return item.Price > 0 })
+	prices := make(map[string]float64)
+	var subtotal float64
+	for _, item := range order.Items {
+		price := item.Price
+		if !recorded {
+			menuItem, err := menuService.GetMenuItemByID(item.ProductID)
+			if err != nil {
+				return nil, 0, models.ErrProductNotFound
+			}
+			price = menuItem.Price
+		}
+		prices[item.ProductID] = price
+		subtotal += price * float64(item.Quantity)
+	}
+
+	paid := order.Total
+	if !recorded && order.Total == 0 && order.Discount == 0 {
+		paid = subtotal
+	}
+	if subtotal > 0 {
+		for id := range prices {
+			prices[id] *= paid / subtotal
+		}
+	}
+	return prices, paid, nil
+}
+
+// disposeIngredients puts the ingredients of the refunded lines back into the inventory
+// or, when the drinks cannot be reused, records them on the refund as waste.
+func (s *RefundService) disposeIngredients(ctx context.Context, refund *models.Refund) error {
+	refund.Waste = nil
+	for _, item := range refund.Items {
+		menuItem, err := s.menuService.GetMenuItemByID(item.ProductID)
+		if err != nil {
+			return models.ErrProductNotFound
+		}
+		for _, ingredient := range menuItem.Ingredients {
+			quantity := ingredient.Quantity * float64(item.Quantity)
+			if !refund.Restock {
+				refund.Waste = append(refund.Waste, models.MenuItemIngredient{IngredientID: ingredient.IngredientID, Quantity: quantity})
+				continue
+			}
+			if err := s.inventoryService.AddInventory(ctx, ingredient.IngredientID, quantity); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func generateRefundID() string {
+	return fmt.Sprintf("refund_%d", time.Now().UnixNano())
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"hot-coffee/internal/dal"
+	"hot-coffee/models"
+	"testing"
+	"time"
+)
+
+// slowRefundRepository takes its time between reading an order's refunds and returning
+// them, so refunds running at the same time overlap.
+type slowRefundRepository struct {
+	*dal.FileRefundRepository
+}
+
+func (r slowRefundRepository) GetRefundsByOrderID(orderID string) ([]models.Refund, error) {
+	refunds, err := r.FileRefundRepository.GetRefundsByOrderID(orderID)
+	time.Sleep(20 * time.Millisecond)
+	return refunds, err
+}
+
+func TestConcurrentRefundsGiveBackAtMostWhatWasPaid(t *testing.T) {
+	s := newTestServices(t)
+	refundRepo := slowRefundRepository{&dal.FileRefundRepository{}}
+	refunds := NewRefundService(refundRepo, s.orderRepo, *s.menu, *s.inventory, s.loyalty)
+	order := s.closedOrder(t, 2)
+
+	// Each refund is for one of the two lattes, so only two of them can go through
+	succeeded := concurrently(8, func() error {
+		return refunds.CreateRefund(context.Background(), order.ID, &models.Refund{
+			Items: []models.RefundItem{{ProductID: "latte", Quantity: 1}}, Reason: "cold"})
+	})
+	if succeeded != 2 {
+		t.Errorf("%d refunds went through, want 2", succeeded)
+	}
+
+	saved, err := refundRepo.GetRefundsByOrderID(order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total float64
+	for _, refund := range saved {
+		total += refund.Amount
+	}
+	if total != order.Total {
+		t.Errorf("refunded %v in total, want the %v paid", total, order.Total)
+	}
+}
@@ -3,21 +3,34 @@ package service
 import (
 	"fmt"
 	"hot-coffee/models"
+	"math"
+	"slices"
+	"time"
 )
 
 type ReportsService struct {
 	orderRepo   OrderRepository
+	refundRepo  RefundRepository
 	menuService MenuService
+	pricing     models.Pricing
 }
 
-func NewReportsService(orderRepo OrderRepository, menuService MenuService) *ReportsService {
+func NewReportsService(orderRepo OrderRepository, refundRepo RefundRepository, menuService MenuService, pricing models.Pricing) *ReportsService {
 	return &ReportsService{
 		orderRepo:   orderRepo,
+		refundRepo:  refundRepo,
 		menuService: menuService,
+		pricing:     pricing,
 	}
 }
 
-// GetTotalSales calculates the total sales amount from all orders
+// Currency is the currency report amounts are in.
+func (s *ReportsService) Currency() string {
+	return s.pricing.Currency
+}
+
+// GetTotalSales sums what was paid for the closed orders, net of refunds. Both are valued
+// at the prices actually charged, discounts taken off; open orders are not sales yet.
 func (s *ReportsService) GetTotalSales() (float64, error) {
 	orders, err := s.orderRepo.GetAllOrders()
 	if err != nil {
@@ -26,16 +39,24 @@ func (s *ReportsService) GetTotalSales() (float64, error) {
 
 	var totalSales float64
 	for _, order := range orders {
-		// Assuming each order item has a price in the menu
-		for _, item := range order.Items {
-			menuItem, err := s.menuService.GetMenuItemByID(item.ProductID)
-			if err != nil {
-				return 0, err
-			}
-			totalSales += menuItem.Price * float64(item.Quantity)
+		if order.Status != models.OrderClosed {
+			continue
 		}
+		_, paid, err := paidPrices(&order, s.menuService)
+		if err != nil {
+			return 0, err
+		}
+		totalSales += paid
 	}
-	return totalSales, nil
+
+	refunds, err := s.refundRepo.GetAllRefunds()
+	if err != nil {
+		return 0, err
+	}
+	for _, refund := range refunds {
+		totalSales -= refund.Amount
+	}
+	return roundMoney(totalSales), nil
 }
 
 // GetPopularItems returns the list of most ordered menu items
@@ -67,3 +88,106 @@ func (s *ReportsService) GetPopularItems() ([]models.MenuItem, error) {
 
 	return popularItems, nil
 }
+
+// BuildZReport summarises the orders closed and refunds issued during the given shift.
+// The shift must already carry its closing time and counted cash.
+func (s *ReportsService) BuildZReport(shift *models.Shift) (*models.ZReport, error) {
+	openedAt, err := time.Parse(time.RFC3339, shift.OpenedAt)
+	if err != nil {
+		return nil, err
+	}
+	closedAt, err := time.Parse(time.RFC3339, shift.ClosedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := s.orderRepo.GetAllOrders()
+	if err != nil {
+		return nil, err
+	}
+	refunds, err := s.refundRepo.GetAllRefunds()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.ZReport{
+		ID:                   "z_" + shift.ID,
+		ShiftID:              shift.ID,
+		Date:                 openedAt.Format("2006-01-02"),
+		OpenedAt:             shift.OpenedAt,
+		ClosedAt:             shift.ClosedAt,
+		RevenueByPaymentType: make(map[string]float64),
+		OpeningCash:          shift.OpeningCash,
+		CountedCash:          shift.CountedCash,
+		Currency:             s.pricing.Currency,
+	}
+
+	paymentTypes := make(map[string]string)
+	for _, order := range orders {
+		// Orders closed before payment types were recorded were paid in cash
+		if order.PaymentType == "" {
+			order.PaymentType = models.PaymentCash
+		}
+		paymentTypes[order.ID] = order.PaymentType
+		if order.Status != "closed" || !withinShift(order.ClosedAt, openedAt, closedAt) {
+			continue
+		}
+		// Gross is what the lines were charged at; the discount is whatever of it was not paid,
+		// which is less than the order's discount when that was larger than the lines
+		gross := order.Total + order.Discount
+		if slices.ContainsFunc(order.Items, func(item models.OrderItem) bool { return item.Price > 0 }) {
+			gross = 0
+			for _, item := range order.Items {
+				gross += item.Price * float64(item.Quantity)
+			}
+		}
+		report.OrderCount++
+		report.GrossRevenue += gross
+		report.Discounts += gross - order.Total
+		report.RevenueByPaymentType[order.PaymentType] += order.Total
+	}
+
+	for _, refund := range refunds {
+		if !withinShift(refund.CreatedAt, openedAt, closedAt) {
+			continue
+		}
+		// Money goes back the same way it was paid. Refunds saved before they recorded it
+		// look it up on their order, and those whose order is gone are booked as unknown
+		paymentType := refund.PaymentType
+		if paymentType == "" {
+			paymentType = paymentTypes[refund.OrderID]
+		}
+		if paymentType == "" {
+			paymentType = models.PaymentUnknown
+		}
+		report.RefundCount++
+		report.Refunds += refund.Amount
+		report.RevenueByPaymentType[paymentType] -= refund.Amount
+	}
+
+	report.NetRevenue = roundMoney(report.GrossRevenue - report.Discounts - report.Refunds)
+	// Prices include tax, so the tax is the part of the net revenue above the untaxed amount
+	report.Tax = roundMoney(report.NetRevenue * s.pricing.TaxRate / (1 + s.pricing.TaxRate))
+	report.GrossRevenue = roundMoney(report.GrossRevenue)
+	report.Discounts = roundMoney(report.Discounts)
+	report.Refunds = roundMoney(report.Refunds)
+	for paymentType, amount := range report.RevenueByPaymentType {
+		report.RevenueByPaymentType[paymentType] = roundMoney(amount)
+	}
+	report.ExpectedCash = roundMoney(shift.OpeningCash + report.RevenueByPaymentType[models.PaymentCash])
+	report.Variance = roundMoney(shift.CountedCash - report.ExpectedCash)
+
+	return report, nil
+}
+
+func withinShift(timestamp string, openedAt, closedAt time.Time) bool {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return false
+	}
+	return !t.Before(openedAt) && !t.After(closedAt)
+}
+
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
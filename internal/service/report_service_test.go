@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"hot-coffee/models"
+	"testing"
+)
+
+func TestTotalSalesUsesWhatWasPaid(t *testing.T) {
+	s := newTestServices(t)
+	ctx := context.Background()
+
+	// Two lattes with a discount of 1 are paid 7
+	order := &models.Order{CustomerName: "Ann", Items: []models.OrderItem{{ProductID: "latte", Quantity: 2}}}
+	if err := s.orders.CreateOrder(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+	orders, err := s.orderRepo.LoadOrders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders[0].Discount = 1
+	if err := s.orderRepo.SaveOrders(orders); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.orders.CloseOrder(ctx, order.ID, models.PaymentCash); err != nil {
+		t.Fatal(err)
+	}
+	// An open order and a later price change do not count
+	if err := s.orders.CreateOrder(ctx, &models.Order{CustomerName: "Bea", Items: []models.OrderItem{{ProductID: "latte", Quantity: 3}}}); err != nil {
+		t.Fatal(err)
+	}
+	latte, err := s.menu.GetMenuItemByID("latte")
+	if err != nil {
+		t.Fatal(err)
+	}
+	latte.Price = 10
+	if err := s.menu.UpdateMenuItem(ctx, latte); err != nil {
+		t.Fatal(err)
+	}
+	if sales, err := s.reports.GetTotalSales(); err != nil || sales != 7 {
+		t.Fatalf("total sales = %v, %v; want 7", sales, err)
+	}
+
+	// Refunding one latte gives back half of what was paid
+	if err := s.refunds.CreateRefund(ctx, order.ID, &models.Refund{Items: []models.RefundItem{{ProductID: "latte", Quantity: 1}}, Reason: "cold"}); err != nil {
+		t.Fatal(err)
+	}
+	if sales, err := s.reports.GetTotalSales(); err != nil || sales != 3.5 {
+		t.Errorf("total sales after the refund = %v, %v; want 3.5", sales, err)
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"hot-coffee/models"
+	"sync"
+	"time"
+)
+
+// ErrNoOpenShift is returned when a shift operation needs an open shift and there is none.
+var ErrNoOpenShift = models.NotFoundError("no_open_shift", "no open shift")
+
+type ShiftRepository interface {
+	// Locker is held from reading the shifts to saving them when one is opened or closed
+	sync.Locker
+	GetAllShifts() ([]models.Shift, error)
+	SaveShifts(shifts []models.Shift) error
+}
+
+type ZReportRepository interface {
+	// Locker is held while a report is saved
+	sync.Locker
+	SaveZReport(report *models.ZReport) error
+	GetAllZReports() ([]models.ZReport, error)
+	GetZReportsByDate(date string) ([]models.ZReport, error)
+}
+
+type ShiftService struct {
+	shiftRepo      ShiftRepository
+	zReportRepo    ZReportRepository
+	reportsService *ReportsService
+}
+
+func NewShiftService(shiftRepo ShiftRepository, zReportRepo ZReportRepository, reportsService *ReportsService) *ShiftService {
+	return &ShiftService{
+		shiftRepo:      shiftRepo,
+		zReportRepo:    zReportRepo,
+		reportsService: reportsService,
+	}
+}
+
+// OpenShift starts a new shift with the cash counted into the drawer. Only one shift can be open at a time.
+func (s *ShiftService) OpenShift(openingCash float64) (*models.Shift, error) {
+	if openingCash < 0 {
+		return nil, models.ValidationError("invalid_cash", "opening cash cannot be negative")
+	}
+
+	s.shiftRepo.Lock()
+	defer s.shiftRepo.Unlock()
+	shifts, err := s.shiftRepo.GetAllShifts()
+	if err != nil {
+		return nil, err
+	}
+	for _, shift := range shifts {
+		if shift.Status == "open" {
+			return nil, models.ConflictError("shift_already_open", "shift "+shift.ID+" is already open")
+		}
+	}
+
+	now := time.Now()
+	shift := models.Shift{
+		ID:          "shift_" + now.Format("20060102150405"),
+		Status:      "open",
+		OpenedAt:    now.Format(time.RFC3339),
+		OpeningCash: openingCash,
+	}
+	if err := s.shiftRepo.SaveShifts(append(shifts, shift)); err != nil {
+		return nil, err
+	}
+	return &shift, nil
+}
+
+// CloseShift closes the open shift with the cash counted in the drawer and stores its Z report.
+func (s *ShiftService) CloseShift(countedCash float64) (*models.ZReport, error) {
+	if countedCash < 0 {
+		return nil, models.ValidationError("invalid_cash", "counted cash cannot be negative")
+	}
+
+	s.shiftRepo.Lock()
+	defer s.shiftRepo.Unlock()
+	shifts, err := s.shiftRepo.GetAllShifts()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, shift := range shifts {
+		if shift.Status != "open" {
+			continue
+		}
+		shift.Status = "closed"
+		shift.ClosedAt = time.Now().Format(time.RFC3339)
+		shift.CountedCash = countedCash
+
+		report, err := s.reportsService.BuildZReport(&shift)
+		if err != nil {
+			return nil, err
+		}
+		// Store the report first so a closed shift always has one
+		s.zReportRepo.Lock()
+		err = s.zReportRepo.SaveZReport(report)
+		s.zReportRepo.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		shifts[i] = shift
+		if err := s.shiftRepo.SaveShifts(shifts); err != nil {
+			return nil, err
+		}
+		return report, nil
+	}
+
+	return nil, ErrNoOpenShift
+}
+
+func (s *ShiftService) GetCurrentShift() (*models.Shift, error) {
+	shifts, err := s.shiftRepo.GetAllShifts()
+	if err != nil {
+		return nil, err
+	}
+	for _, shift := range shifts {
+		if shift.Status == "open" {
+			return &shift, nil
+		}
+	}
+	return nil, ErrNoOpenShift
+}
+
+// GetZReportsByDate returns the Z reports of the shifts opened on the given day (YYYY-MM-DD).
+func (s *ShiftService) GetZReportsByDate(date string) ([]models.ZReport, error) {
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return nil, models.ValidationError("invalid_date", "invalid date "+date+", expected YYYY-MM-DD")
+	}
+	return s.zReportRepo.GetZReportsByDate(date)
+}
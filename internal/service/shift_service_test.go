@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"hot-coffee/internal/dal"
+	"hot-coffee/models"
+	"maps"
+	"testing"
+	"time"
+)
+
+func TestShiftOpensAndClosesOnce(t *testing.T) {
+	s := newTestServices(t)
+
+	opened := concurrently(8, func() error {
+		_, err := s.shifts.OpenShift(100)
+		return err
+	})
+	if opened != 1 {
+		t.Fatalf("%d shifts were opened at once, want 1", opened)
+	}
+	shift, err := s.shifts.GetCurrentShift()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed := concurrently(8, func() error {
+		_, err := s.shifts.CloseShift(100)
+		return err
+	})
+	if closed != 1 {
+		t.Errorf("the shift was closed %d times, want once", closed)
+	}
+	reports, err := s.shifts.GetZReportsByDate(time.Now().Format("2006-01-02"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].ShiftID != shift.ID {
+		t.Errorf("Z reports = %+v, want one for %s", reports, shift.ID)
+	}
+}
+
+func TestZReportBooksWhatWasCharged(t *testing.T) {
+	s := newTestServices(t)
+	ctx := context.Background()
+	if _, err := s.shifts.OpenShift(50); err != nil {
+		t.Fatal(err)
+	}
+
+	// A discount larger than the order leaves it free: the gross is still what the lines cost
+	free := &models.Order{CustomerName: "Ann", Items: []models.OrderItem{{ProductID: "latte", Quantity: 2}}}
+	if err := s.orders.CreateOrder(ctx, free); err != nil {
+		t.Fatal(err)
+	}
+	orders, err := s.orderRepo.LoadOrders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders[0].Discount = 10
+	if err := s.orderRepo.SaveOrders(orders); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.orders.CloseOrder(ctx, free.ID, models.PaymentCash); err != nil {
+		t.Fatal(err)
+	}
+	paid := s.closedOrder(t, 1)
+	if err := s.refunds.CreateRefund(ctx, paid.ID, &models.Refund{Reason: "cold"}); err != nil {
+		t.Fatal(err)
+	}
+	// A refund saved before refunds recorded the payment type, of an order since deleted
+	if err := (&dal.FileRefundRepository{}).SaveRefund(&models.Refund{ID: "refund_old", OrderID: "order_gone", Reason: "cold",
+		Amount: 1.5, CreatedAt: time.Now().Format(time.RFC3339)}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.shifts.CloseShift(50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OrderCount != 2 || report.GrossRevenue != 12 || report.Discounts != 8 || report.Refunds != 5.5 {
+		t.Errorf("orders %d, gross %v, discounts %v, refunds %v; want 2, 12, 8 and 5.5",
+			report.OrderCount, report.GrossRevenue, report.Discounts, report.Refunds)
+	}
+	want := map[string]float64{models.PaymentCash: 0, models.PaymentCard: 0, models.PaymentUnknown: -1.5}
+	if !maps.Equal(report.RevenueByPaymentType, want) {
+		t.Errorf("revenue by payment type = %v, want %v", report.RevenueByPaymentType, want)
+	}
+}
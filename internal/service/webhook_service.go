@@ -0,0 +1,343 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hot-coffee/internal/events"
+	"hot-coffee/models"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebhookTestEvent is the event type sent by "send test event".
+const WebhookTestEvent = "webhook.test"
+
+var ErrWebhookNotFound = models.NotFoundError("webhook_not_found", "webhook not found")
+
+type WebhookRepository interface {
+	AddWebhook(webhook *models.Webhook) error
+	GetAllWebhooks() ([]models.Webhook, error)
+	SaveWebhooks(webhooks []models.Webhook) error
+	AddDelivery(delivery *models.WebhookDelivery) error
+	GetAllDeliveries() ([]models.WebhookDelivery, error)
+}
+
+// WebhookService manages webhook subscriptions and delivers bus events to them.
+// Failed deliveries are retried with exponential backoff and every attempt is logged.
+type WebhookService struct {
+	repo        WebhookRepository
+	bus         *events.Bus
+	client      *http.Client
+	maxAttempts int
+	baseDelay   time.Duration
+
+	// mu serialises changes to the subscriptions and guards webhooks, the copy of them
+	// events are matched against. It is loaded when first needed and dropped on every change.
+	mu       sync.Mutex
+	webhooks []models.Webhook
+
+	inFlight    sync.WaitGroup
+	stop        chan struct{}
+	unsubscribe func()
+}
+
+func NewWebhookService(repo WebhookRepository, bus *events.Bus, client *http.Client, maxAttempts int, baseDelay time.Duration) *WebhookService {
+	return &WebhookService{
+		repo:        repo,
+		bus:         bus,
+		client:      client,
+		maxAttempts: maxAttempts,
+		baseDelay:   baseDelay,
+		stop:        make(chan struct{}),
+	}
+}
+
+// Start begins delivering published events to the matching webhooks.
+func (s *WebhookService) Start() {
+	_, stream, unsubscribe := s.bus.Subscribe(0)
+	s.unsubscribe = unsubscribe
+	go func() {
+		for event := range stream {
+			s.dispatch(event)
+		}
+	}()
+}
+
+// Stop stops taking new events, abandons pending retries and waits for requests in flight.
+func (s *WebhookService) Stop() {
+	if s.unsubscribe != nil {
+		s.unsubscribe()
+	}
+	close(s.stop)
+	s.inFlight.Wait()
+}
+
+func (s *WebhookService) GetAllWebhooks() ([]models.Webhook, error) {
+	return s.repo.GetAllWebhooks()
+}
+
+func (s *WebhookService) GetWebhookByID(id string) (*models.Webhook, error) {
+	webhooks, err := s.repo.GetAllWebhooks()
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range webhooks {
+		if webhook.ID == id {
+			return &webhook, nil
+		}
+	}
+	return nil, ErrWebhookNotFound
+}
+
+// AddWebhook registers a subscription. A secret is generated when none is given.
+func (s *WebhookService) AddWebhook(webhook *models.Webhook) error {
+	if err := validateWebhook(webhook); err != nil {
+		return err
+	}
+	if webhook.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			return err
+		}
+		webhook.Secret = secret
+	}
+
+	webhook.ID = fmt.Sprintf("webhook_%d", time.Now().UnixNano())
+	webhook.CreatedAt = time.Now().Format(time.RFC3339)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhooks = nil
+	return s.repo.AddWebhook(webhook)
+}
+
+// UpdateWebhook replaces a subscription's settings, keeping its secret when none is given.
+func (s *WebhookService) UpdateWebhook(webhook *models.Webhook) error {
+	if err := validateWebhook(webhook); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	webhooks, err := s.repo.GetAllWebhooks()
+	if err != nil {
+		return err
+	}
+
+	for i, existing := range webhooks {
+		if existing.ID == webhook.ID {
+			if webhook.Secret == "" {
+				webhook.Secret = existing.Secret
+			}
+			webhook.CreatedAt = existing.CreatedAt
+			webhooks[i] = *webhook
+			s.webhooks = nil
+			return s.repo.SaveWebhooks(webhooks)
+		}
+	}
+	return ErrWebhookNotFound
+}
+
+func (s *WebhookService) DeleteWebhook(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	webhooks, err := s.repo.GetAllWebhooks()
+	if err != nil {
+		return err
+	}
+
+	for i, existing := range webhooks {
+		if existing.ID == id {
+			webhooks = append(webhooks[:i], webhooks[i+1:]...)
+			s.webhooks = nil
+			return s.repo.SaveWebhooks(webhooks)
+		}
+	}
+	return ErrWebhookNotFound
+}
+
+// GetDeliveries returns the logged delivery attempts for a webhook, oldest first.
+func (s *WebhookService) GetDeliveries(id string) ([]models.WebhookDelivery, error) {
+	if _, err := s.GetWebhookByID(id); err != nil {
+		return nil, err
+	}
+	deliveries, err := s.repo.GetAllDeliveries()
+	if err != nil {
+		return nil, err
+	}
+
+	webhookDeliveries := []models.WebhookDelivery{}
+	for _, delivery := range deliveries {
+		if delivery.WebhookID == id {
+			webhookDeliveries = append(webhookDeliveries, delivery)
+		}
+	}
+	return webhookDeliveries, nil
+}
+
+// SendTestEvent delivers a webhook.test event once, synchronously, and returns the attempt.
+func (s *WebhookService) SendTestEvent(id string) (*models.WebhookDelivery, error) {
+	webhook, err := s.GetWebhookByID(id)
+	if err != nil {
+		return nil, err
+	}
+	event := events.Event{
+		Type: WebhookTestEvent,
+		Time: time.Now().Format(time.RFC3339Nano),
+		Data: map[string]string{"webhook_id": webhook.ID},
+	}
+	delivery := s.attempt(webhook, event, 1)
+	return &delivery, nil
+}
+
+// subscriptions returns the webhooks events are matched against, reading them from the
+// repository only after they changed.
+func (s *WebhookService) subscriptions() ([]models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.webhooks == nil {
+		webhooks, err := s.repo.GetAllWebhooks()
+		if err != nil {
+			return nil, err
+		}
+		s.webhooks = append([]models.Webhook{}, webhooks...)
+	}
+	return s.webhooks, nil
+}
+
+func (s *WebhookService) dispatch(event events.Event) {
+	webhooks, err := s.subscriptions()
+	if err != nil {
+		slog.Error("Failed to load webhooks", slog.String("error", err.Error()))
+		return
+	}
+	for _, webhook := range webhooks {
+		if !webhook.Active || !events.Matches(webhook.Events, event.Type) {
+			continue
+		}
+		s.inFlight.Add(1)
+		go func(webhook models.Webhook) {
+			defer s.inFlight.Done()
+			s.deliver(&webhook, event)
+		}(webhook)
+	}
+}
+
+// deliver retries a delivery until it succeeds or runs out of attempts, doubling the wait each time.
+func (s *WebhookService) deliver(webhook *models.Webhook, event events.Event) {
+	delay := s.baseDelay
+	for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+		if delivery := s.attempt(webhook, event, attempt); delivery.Success {
+			return
+		}
+		if attempt == s.maxAttempts {
+			break
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	slog.Warn("Webhook delivery failed", slog.String("webhookID", webhook.ID), slog.Int64("eventID", event.ID), slog.Int("attempts", s.maxAttempts))
+}
+
+func (s *WebhookService) attempt(webhook *models.Webhook, event events.Event, attempt int) models.WebhookDelivery {
+	delivery := models.WebhookDelivery{
+		ID:        fmt.Sprintf("delivery_%d", time.Now().UnixNano()),
+		WebhookID: webhook.ID,
+		EventID:   event.ID,
+		EventType: event.Type,
+		Attempt:   attempt,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+
+	started := time.Now()
+	statusCode, err := s.post(webhook, event, delivery.ID)
+	delivery.DurationMs = time.Since(started).Milliseconds()
+	delivery.StatusCode = statusCode
+	if err != nil {
+		delivery.Error = err.Error()
+	} else {
+		delivery.Success = statusCode >= 200 && statusCode < 300
+	}
+
+	if err := s.repo.AddDelivery(&delivery); err != nil {
+		slog.Error("Failed to record webhook delivery", slog.String("webhookID", webhook.ID), slog.String("error", err.Error()))
+	}
+	return delivery
+}
+
+func (s *WebhookService) post(webhook *models.Webhook, event events.Event, deliveryID string) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Hot-Coffee-Event", event.Type)
+	request.Header.Set("X-Hot-Coffee-Delivery", deliveryID)
+	request.Header.Set("X-Hot-Coffee-Signature", "sha256="+SignWebhookPayload(webhook.Secret, body))
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	return response.StatusCode, nil
+}
+
+// SignWebhookPayload returns the hex HMAC-SHA256 of body keyed with secret, as sent in
+// the X-Hot-Coffee-Signature header. Receivers recompute it to verify a delivery.
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func validateWebhook(webhook *models.Webhook) error {
+	parsed, err := url.Parse(webhook.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return models.ValidationError("invalid_webhook_url", "webhook url must be an absolute http or https URL")
+	}
+	if len(webhook.Events) == 0 {
+		return models.ValidationError("invalid_webhook_events", "webhook must subscribe to at least one event type")
+	}
+	for _, eventType := range webhook.Events {
+		if !isKnownEventPattern(eventType) {
+			return models.ValidationError("invalid_webhook_events", "unknown event type "+eventType)
+		}
+	}
+	return nil
+}
+
+func isKnownEventPattern(pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+	for _, eventType := range events.Types {
+		if pattern == eventType || (strings.HasSuffix(pattern, ".*") && events.Matches([]string{pattern}, eventType)) {
+			return true
+		}
+	}
+	return false
+}
+
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"encoding/json"
+	"hot-coffee/internal/events"
+	"hot-coffee/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryWebhookRepository keeps webhooks and deliveries in memory and counts how often
+// the webhooks are read.
+type memoryWebhookRepository struct {
+	mu         sync.Mutex
+	webhooks   []models.Webhook
+	deliveries []models.WebhookDelivery
+	reads      int
+}
+
+func (r *memoryWebhookRepository) AddWebhook(webhook *models.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.webhooks = append(r.webhooks, *webhook)
+	return nil
+}
+
+func (r *memoryWebhookRepository) GetAllWebhooks() ([]models.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reads++
+	return slices.Clone(r.webhooks), nil
+}
+
+func (r *memoryWebhookRepository) SaveWebhooks(webhooks []models.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.webhooks = slices.Clone(webhooks)
+	return nil
+}
+
+func (r *memoryWebhookRepository) AddDelivery(delivery *models.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries = append(r.deliveries, *delivery)
+	return nil
+}
+
+func (r *memoryWebhookRepository) GetAllDeliveries() ([]models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.deliveries), nil
+}
+
+// receivedCall is one request that reached the test receiver.
+type receivedCall struct {
+	at        time.Time
+	body      []byte
+	signature string
+	event     string
+}
+
+// webhookReceiver answers each call with the next of statuses, then with 200s, and
+// hands every call it gets to calls.
+func webhookReceiver(t *testing.T, statuses ...int) (*httptest.Server, <-chan receivedCall) {
+	t.Helper()
+	calls := make(chan receivedCall, 16)
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		calls <- receivedCall{at: time.Now(), body: body, signature: r.Header.Get("X-Hot-Coffee-Signature"), event: r.Header.Get("X-Hot-Coffee-Event")}
+		mu.Lock()
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, calls
+}
+
+func receive(t *testing.T, calls <-chan receivedCall) receivedCall {
+	t.Helper()
+	select {
+	case call := <-calls:
+		return call
+	case <-time.After(5 * time.Second):
+		t.Fatal("the receiver got no delivery")
+		return receivedCall{}
+	}
+}
+
+func newTestWebhookService(t *testing.T, repo WebhookRepository, maxAttempts int, baseDelay time.Duration) (*WebhookService, *events.Bus) {
+	t.Helper()
+	bus := events.NewBus(10)
+	service := NewWebhookService(repo, bus, &http.Client{Timeout: 5 * time.Second}, maxAttempts, baseDelay)
+	service.Start()
+	t.Cleanup(func() {
+		service.Stop()
+		bus.Close()
+	})
+	return service, bus
+}
+
+func TestWebhookDeliveriesAreSigned(t *testing.T) {
+	receiver, calls := webhookReceiver(t)
+	repo := &memoryWebhookRepository{}
+	service, bus := newTestWebhookService(t, repo, 1, time.Millisecond)
+
+	webhook := &models.Webhook{URL: receiver.URL, Events: []string{"order.*"}, Secret: "s3cret", Active: true}
+	if err := service.AddWebhook(webhook); err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(events.OrderCreated, map[string]string{"order_id": "order_1"})
+
+	call := receive(t, calls)
+	if call.event != events.OrderCreated {
+		t.Errorf("X-Hot-Coffee-Event = %q, want %q", call.event, events.OrderCreated)
+	}
+	if want := "sha256=" + SignWebhookPayload("s3cret", call.body); call.signature != want {
+		t.Errorf("X-Hot-Coffee-Signature = %q, want %q", call.signature, want)
+	}
+	if forged := "sha256=" + SignWebhookPayload("other", call.body); call.signature == forged {
+		t.Error("the signature does not depend on the secret")
+	}
+	var event events.Event
+	if err := json.Unmarshal(call.body, &event); err != nil || event.Type != events.OrderCreated {
+		t.Errorf("body %q is not the published event: %v", call.body, err)
+	}
+}
+
+func TestSignWebhookPayloadKnownAnswer(t *testing.T) {
+	// HMAC-SHA256 of the pangram under "key", as published for HMAC test vectors
+	got := SignWebhookPayload("key", []byte("The quick brown fox jumps over the lazy dog"))
+	if want := "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"; got != want {
+		t.Errorf("SignWebhookPayload = %s, want %s", got, want)
+	}
+}
+
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	receiver, calls := webhookReceiver(t, http.StatusInternalServerError, http.StatusServiceUnavailable)
+	repo := &memoryWebhookRepository{}
+	baseDelay := 50 * time.Millisecond
+	service, bus := newTestWebhookService(t, repo, 4, baseDelay)
+
+	webhook := &models.Webhook{URL: receiver.URL, Events: []string{"*"}, Active: true}
+	if err := service.AddWebhook(webhook); err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(events.OrderClosed, map[string]string{"order_id": "order_1"})
+
+	// Two failures, then success: the waits are the base delay and then twice it
+	first, second, third := receive(t, calls), receive(t, calls), receive(t, calls)
+	for i, wait := range []struct {
+		got, want time.Duration
+	}{{second.at.Sub(first.at), baseDelay}, {third.at.Sub(second.at), 2 * baseDelay}} {
+		if wait.got < wait.want || wait.got > wait.want+time.Second {
+			t.Errorf("wait before attempt %d = %v, want about %v", i+2, wait.got, wait.want)
+		}
+	}
+	select {
+	case call := <-calls:
+		t.Fatalf("delivery was sent again after it succeeded: %s", call.body)
+	case <-time.After(4 * baseDelay):
+	}
+
+	deliveries, err := service.GetDeliveries(webhook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for i, delivery := range deliveries {
+		got = append(got, delivery.StatusCode)
+		if delivery.Attempt != i+1 || delivery.EventType != events.OrderClosed {
+			t.Errorf("delivery %d is logged as attempt %d of %s", i+1, delivery.Attempt, delivery.EventType)
+		}
+	}
+	if want := []int{500, 503, 200}; !slices.Equal(got, want) {
+		t.Fatalf("delivery statuses = %v, want %v", got, want)
+	}
+	if !deliveries[len(deliveries)-1].Success || deliveries[0].Success {
+		t.Errorf("only the last delivery should succeed: %+v", deliveries)
+	}
+}
+
+func TestWebhookGivesUpAfterMaxAttempts(t *testing.T) {
+	receiver, calls := webhookReceiver(t, 500, 500, 500, 500, 500)
+	repo := &memoryWebhookRepository{}
+	service, bus := newTestWebhookService(t, repo, 3, 10*time.Millisecond)
+
+	if err := service.AddWebhook(&models.Webhook{URL: receiver.URL, Events: []string{"*"}, Active: true}); err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(events.OrderDeleted, map[string]string{"order_id": "order_1"})
+
+	for range 3 {
+		receive(t, calls)
+	}
+	select {
+	case <-calls:
+		t.Fatal("a fourth attempt was made")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Each attempt is logged as a failure
+	deliveries, err := repo.GetAllDeliveries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 3 {
+		t.Fatalf("%d deliveries were logged, want 3", len(deliveries))
+	}
+	for i, delivery := range deliveries {
+		if delivery.Attempt != i+1 || delivery.Success || delivery.StatusCode != http.StatusInternalServerError {
+			t.Errorf("delivery %d = %+v, want failed attempt %d with status 500", i+1, delivery, i+1)
+		}
+	}
+}
+
+func TestWebhookDispatchReadsSubscriptionsOnlyAfterChanges(t *testing.T) {
+	receiver, calls := webhookReceiver(t)
+	repo := &memoryWebhookRepository{}
+	service, bus := newTestWebhookService(t, repo, 1, time.Millisecond)
+
+	webhook := &models.Webhook{URL: receiver.URL, Events: []string{"*"}, Active: true}
+	if err := service.AddWebhook(webhook); err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		bus.Publish(events.OrderUpdated, nil)
+		receive(t, calls)
+	}
+	repo.mu.Lock()
+	reads := repo.reads
+	repo.mu.Unlock()
+	if reads != 1 {
+		t.Errorf("webhooks were read %d times for 5 events, want once", reads)
+	}
+
+	// Switching the webhook off takes effect for the next event
+	webhook.Active = false
+	webhook.Secret = ""
+	if err := service.UpdateWebhook(webhook); err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(events.OrderUpdated, nil)
+	select {
+	case call := <-calls:
+		t.Fatalf("an inactive webhook got %s", call.body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,56 @@
+package models
+
+import "encoding/json"
+
+// Audited entity types and actions.
+const (
+	EntityInventoryItem = "inventory_item"
+	EntityMenuItem      = "menu_item"
+	EntityOrder         = "order"
+
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// AuditEntry records one change to an inventory item, menu item or order. Entries form
+// a hash chain: Hash covers the entry including PrevHash, the Hash of the entry before,
+// so editing or removing an entry breaks every hash after it.
+type AuditEntry struct {
+	Seq        int64                  `json:"seq"`
+	Time       string                 `json:"time"`
+	Actor      string                 `json:"actor"`
+	EntityType string                 `json:"entity_type"`
+	EntityID   string                 `json:"entity_id"`
+	Action     string                 `json:"action"`
+	Changes    map[string]AuditChange `json:"changes"`
+	PrevHash   string                 `json:"prev_hash"`
+	Hash       string                 `json:"hash"`
+}
+
+// AuditChange is the value of one top-level field before and after a change. Before is
+// absent for creations and After for deletions.
+type AuditChange struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditQuery filters audit entries. From and To bound the entry time and are inclusive.
+type AuditQuery struct {
+	EntityType string
+	EntityID   string
+	Actor      string
+	Action     string
+	From       string
+	To         string
+	Sort       Sort
+	Page       Page
+}
+
+// AuditVerification is the outcome of checking the audit hash chain.
+type AuditVerification struct {
+	Valid   bool   `json:"valid"`
+	Entries int    `json:"entries"`
+	BadSeq  int64  `json:"bad_seq,omitempty"`
+	Problem string `json:"problem,omitempty"`
+}
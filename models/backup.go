@@ -0,0 +1,25 @@
+package models
+
+// Backup is a backup archive of the data directory.
+type Backup struct {
+	Name      string          `json:"name"`
+	Size      int64           `json:"size"`
+	CreatedAt string          `json:"created_at"`
+	Manifest  *BackupManifest `json:"manifest,omitempty"`
+}
+
+// BackupManifest is the manifest.json at the start of a backup archive. It lists the data
+// files in the archive with their checksums, so an archive can be verified before it is
+// restored, and the schema version of the data they hold.
+type BackupManifest struct {
+	SchemaVersion int          `json:"schema_version"`
+	CreatedAt     string       `json:"created_at"`
+	Files         []BackupFile `json:"files"`
+}
+
+// BackupFile is one data file in a backup archive.
+type BackupFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
@@ -0,0 +1,17 @@
+package models
+
+type Customer struct {
+	ID        string `json:"customer_id"`
+	Name      string `json:"name"`
+	Phone     string `json:"phone,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Notes     string `json:"notes,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type CustomerStats struct {
+	CustomerID    string  `json:"customer_id"`
+	VisitCount    int     `json:"visit_count"`
+	LifetimeSpend float64 `json:"lifetime_spend"`
+	FavoriteItem  string  `json:"favorite_item,omitempty"`
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of domain errors. Every error the services return to a client wraps one of
+// these, and the HTTP layer maps each kind to one status code.
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrValidation         = errors.New("validation failed")
+	ErrConflict           = errors.New("conflict")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrUnprocessable      = errors.New("unprocessable")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrForbidden          = errors.New("forbidden")
+)
+
+// Error is a domain error: its Kind decides the HTTP status and Code is a stable,
+// machine-readable name clients can switch on.
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func NotFoundError(code, message string) *Error {
+	return &Error{Kind: ErrNotFound, Code: code, Message: message}
+}
+
+func ValidationError(code, message string) *Error {
+	return &Error{Kind: ErrValidation, Code: code, Message: message}
+}
+
+func ConflictError(code, message string) *Error {
+	return &Error{Kind: ErrConflict, Code: code, Message: message}
+}
+
+// Errors shared by several services.
+var (
+	ErrOrderNotFound      = NotFoundError("order_not_found", "order not found")
+	ErrProductNotFound    = NotFoundError("product_not_found", "product not found in menu")
+	ErrIngredientNotFound = NotFoundError("ingredient_not_found", "ingredient not found in inventory")
+	ErrItemNotFound       = NotFoundError("item_not_found", "item not found")
+	ErrOrderClosed        = ConflictError("order_closed", "order is already closed")
+	ErrOrderNotOpen       = ConflictError("order_not_open", "order is not open")
+	// ErrVersionConflict is returned when a change was based on an outdated version of a record.
+	ErrVersionConflict = &Error{Kind: ErrPreconditionFailed, Code: "version_conflict", Message: "the record was changed by someone else"}
+)
+
+// InsufficientStockError is returned when an ingredient does not have enough stock for an order.
+type InsufficientStockError struct {
+	IngredientID string
+	Required     float64
+	Available    float64
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient ingredient quantity for %s: %g needed, %g in stock", e.IngredientID, e.Required, e.Available)
+}
+
+// Shortfall is how much more of the ingredient would be needed.
+func (e *InsufficientStockError) Shortfall() float64 {
+	return e.Required - e.Available
+}
+
+func (e *InsufficientStockError) Unwrap() error {
+	return ErrConflict
+}
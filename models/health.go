@@ -0,0 +1,23 @@
+package models
+
+// Health statuses of a check and of the service as a whole.
+const (
+	HealthOK       = "ok"
+	HealthFailed   = "failed"
+	HealthDegraded = "degraded"
+)
+
+// HealthReport is the result of the readiness checks. Status is HealthOK when every
+// check passed and HealthDegraded otherwise.
+type HealthReport struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// HealthCheck is the outcome of one readiness check.
+type HealthCheck struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
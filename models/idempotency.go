@@ -0,0 +1,15 @@
+package models
+
+// IdempotencyRecord is the stored outcome of a mutating request sent with an Idempotency-Key.
+// Keys belong to the user who sent them; UserID is empty for requests made without
+// signing in.
+type IdempotencyRecord struct {
+	UserID      string              `json:"user_id,omitempty"`
+	Key         string              `json:"key"`
+	RequestHash string              `json:"request_hash"`
+	StatusCode  int                 `json:"status_code"`
+	Header      map[string][]string `json:"header"`
+	Body        []byte              `json:"body"`
+	CreatedAt   string              `json:"created_at"`
+	ExpiresAt   string              `json:"expires_at"`
+}
@@ -1,12 +1,15 @@
 package models
 
-import "errors"
-
-var ErrItemNotFound = errors.New("item not found")
-
 type InventoryItem struct {
 	IngredientID string  `json:"ingredient_id"`
 	Name         string  `json:"name"`
 	Quantity     float64 `json:"quantity"`
 	Unit         string  `json:"unit"`
+	ReorderLevel float64 `json:"reorder_level,omitempty"`
+	Version      int     `json:"version"`
+}
+
+// IsLowStock reports whether the item has dropped to its reorder level.
+func (i InventoryItem) IsLowStock() bool {
+	return i.ReorderLevel > 0 && i.Quantity <= i.ReorderLevel
 }
@@ -0,0 +1,52 @@
+package models
+
+// LoyaltySettings controls how customers earn and spend loyalty points.
+type LoyaltySettings struct {
+	// PointsPerCurrencyUnit is how many points one unit of money spent earns.
+	PointsPerCurrencyUnit float64 `json:"points_per_currency_unit"`
+	// ProductMultipliers boosts (or reduces) the points earned on specific products.
+	ProductMultipliers map[string]float64 `json:"product_multipliers,omitempty"`
+	// PointValue is the discount one point is worth when redeemed against an order.
+	PointValue float64 `json:"point_value"`
+	// FreeItemPoints lists the products that can be redeemed for free and their price in points.
+	FreeItemPoints map[string]int `json:"free_item_points,omitempty"`
+	// ExpiryDays is how long earned points stay valid; 0 means they never expire.
+	ExpiryDays int `json:"expiry_days"`
+}
+
+// Loyalty ledger entry types.
+const (
+	LoyaltyEarn    = "earn"
+	LoyaltyRedeem  = "redeem"
+	LoyaltyReverse = "reverse"
+	LoyaltyExpire  = "expire"
+)
+
+// LoyaltyEntry is one movement of points in a customer's ledger. Entries are only ever appended.
+type LoyaltyEntry struct {
+	ID         string `json:"entry_id"`
+	CustomerID string `json:"customer_id"`
+	OrderID    string `json:"order_id,omitempty"`
+	Type       string `json:"type"`
+	Points     int    `json:"points"`
+	Note       string `json:"note,omitempty"`
+	// ExpiresAt is set on earned points when the program has an expiry policy.
+	ExpiresAt string `json:"expires_at,omitempty"`
+	// LotID links an expire entry to the earned points that expired.
+	LotID string `json:"lot_id,omitempty"`
+	// ProductID is the product a redeem entry got for free.
+	ProductID string `json:"product_id,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type LoyaltyBalance struct {
+	CustomerID string  `json:"customer_id"`
+	Points     int     `json:"points"`
+	Value      float64 `json:"value"`
+}
+
+type LoyaltyRedemption struct {
+	OrderID   string `json:"order_id"`
+	Points    int    `json:"points,omitempty"`
+	ProductID string `json:"product_id,omitempty"`
+}
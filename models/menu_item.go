@@ -6,8 +6,16 @@ type MenuItem struct {
 	Description string               `json:"description"`
 	Price       float64              `json:"price"`
 	Ingredients []MenuItemIngredient `json:"ingredients"`
+	Station     string               `json:"station,omitempty"`
+	Version     int                  `json:"version"`
 }
 
+// Stations where menu items are prepared.
+const (
+	StationBar     = "bar"
+	StationKitchen = "kitchen"
+)
+
 type MenuItemIngredient struct {
 	IngredientID string  `json:"ingredient_id"`
 	Quantity     float64 `json:"quantity"`
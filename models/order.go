@@ -2,13 +2,50 @@ package models
 
 type Order struct {
 	ID           string      `json:"order_id"`
+	CustomerID   string      `json:"customer_id,omitempty"`
 	CustomerName string      `json:"customer_name"`
 	Items        []OrderItem `json:"items"`
 	Status       string      `json:"status"`
 	CreatedAt    string      `json:"created_at"`
+	ClosedAt     string      `json:"closed_at,omitempty"`
+	PaymentType  string      `json:"payment_type,omitempty"`
+	Discount     float64     `json:"discount,omitempty"`
+	Total        float64     `json:"total,omitempty"`
+	Version      int         `json:"version"`
+}
+
+// Order statuses.
+const (
+	OrderOpen   = "open"
+	OrderClosed = "closed"
+)
+
+// Payment types accepted when an order is closed.
+const (
+	PaymentCash   = "cash"
+	PaymentCard   = "card"
+	PaymentMobile = "mobile"
+	// PaymentUnknown books refunds in a Z report whose order, and so its payment type, is gone
+	PaymentUnknown = "unknown"
+)
+
+func IsValidPaymentType(paymentType string) bool {
+	return paymentType == PaymentCash || paymentType == PaymentCard || paymentType == PaymentMobile
 }
 
 type OrderItem struct {
-	ProductID string `json:"product_id"`
-	Quantity  int    `json:"quantity"`
+	ProductID  string `json:"product_id"`
+	Quantity   int    `json:"quantity"`
+	PrepStatus string `json:"prep_status,omitempty"`
+	StartedAt  string `json:"started_at,omitempty"`
+	DoneAt     string `json:"done_at,omitempty"`
+	// Price is the unit price charged, recorded when the order is closed
+	Price float64 `json:"price,omitempty"`
 }
+
+// Preparation states of an order line on the barista/kitchen queue.
+const (
+	PrepPending = "pending"
+	PrepStarted = "started"
+	PrepDone    = "done"
+)
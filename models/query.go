@@ -0,0 +1,63 @@
+package models
+
+// ErrInvalidQuery is wrapped by errors about unusable filter, sort or pagination parameters.
+var ErrInvalidQuery = ValidationError("invalid_query", "invalid query")
+
+// Pagination limits for list endpoints.
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+)
+
+// Page selects a slice of a list. Cursor is the NextCursor of the previous page, empty for the first.
+type Page struct {
+	Limit  int
+	Cursor string
+}
+
+// Sort orders a list by one field. An empty Field keeps the stored order.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// PageInfo describes the page returned and how to get the next one.
+type PageInfo struct {
+	Limit      int    `json:"limit"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// List is one page of a list endpoint.
+type List[T any] struct {
+	Data       []T      `json:"data"`
+	Pagination PageInfo `json:"pagination"`
+}
+
+// OrderQuery filters orders. From and To bound the creation time and are inclusive.
+type OrderQuery struct {
+	Status    string
+	Customer  string
+	ProductID string
+	From      string
+	To        string
+	Sort      Sort
+	Page      Page
+}
+
+// MenuQuery filters menu items. Nil prices leave that end of the range open.
+type MenuQuery struct {
+	MinPrice     *float64
+	MaxPrice     *float64
+	IngredientID string
+	Sort         Sort
+	Page         Page
+}
+
+// InventoryQuery filters inventory items. Name matches a case-insensitive substring.
+type InventoryQuery struct {
+	Name     string
+	LowStock bool
+	Sort     Sort
+	Page     Page
+}
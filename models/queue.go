@@ -0,0 +1,22 @@
+package models
+
+// QueueEntry is an open order as shown on the barista/kitchen display.
+type QueueEntry struct {
+	OrderID      string      `json:"order_id"`
+	CustomerName string      `json:"customer_name"`
+	CreatedAt    string      `json:"created_at"`
+	WaitSeconds  int64       `json:"wait_seconds"`
+	Lines        []QueueLine `json:"lines"`
+}
+
+type QueueLine struct {
+	// Line is the position of the item in the order, used to update its status.
+	Line       int    `json:"line"`
+	ProductID  string `json:"product_id"`
+	Name       string `json:"name"`
+	Quantity   int    `json:"quantity"`
+	Station    string `json:"station"`
+	PrepStatus string `json:"prep_status"`
+	StartedAt  string `json:"started_at,omitempty"`
+	DoneAt     string `json:"done_at,omitempty"`
+}
@@ -0,0 +1,21 @@
+package models
+
+// Refund records money returned to a customer for some or all of the lines of a closed order.
+type Refund struct {
+	ID        string               `json:"refund_id"`
+	OrderID   string               `json:"order_id"`
+	Items     []RefundItem         `json:"items"`
+	Reason    string               `json:"reason"`
+	Restock   bool                 `json:"restock"`
+	Waste     []MenuItemIngredient `json:"waste,omitempty"`
+	Amount    float64              `json:"amount"`
+	CreatedAt string               `json:"created_at"`
+	// PaymentType is how the order was paid, and so how the money goes back
+	PaymentType string `json:"payment_type,omitempty"`
+}
+
+type RefundItem struct {
+	ProductID string  `json:"product_id"`
+	Quantity  int     `json:"quantity"`
+	Amount    float64 `json:"amount"`
+}
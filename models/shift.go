@@ -0,0 +1,39 @@
+package models
+
+type Shift struct {
+	ID          string  `json:"shift_id"`
+	Status      string  `json:"status"`
+	OpenedAt    string  `json:"opened_at"`
+	ClosedAt    string  `json:"closed_at,omitempty"`
+	OpeningCash float64 `json:"opening_cash"`
+	CountedCash float64 `json:"counted_cash,omitempty"`
+}
+
+// Pricing is how the shop's prices are expressed: their currency and the tax they include,
+// as a fraction (0.2 for 20%).
+type Pricing struct {
+	Currency string
+	TaxRate  float64
+}
+
+// ZReport is the end-of-shift close-out. It is written once when the shift is closed and never changed.
+type ZReport struct {
+	ID                   string             `json:"report_id"`
+	ShiftID              string             `json:"shift_id"`
+	Date                 string             `json:"date"`
+	OpenedAt             string             `json:"opened_at"`
+	ClosedAt             string             `json:"closed_at"`
+	OrderCount           int                `json:"order_count"`
+	GrossRevenue         float64            `json:"gross_revenue"`
+	Discounts            float64            `json:"discounts"`
+	RefundCount          int                `json:"refund_count"`
+	Refunds              float64            `json:"refunds"`
+	NetRevenue           float64            `json:"net_revenue"`
+	Tax                  float64            `json:"tax"`
+	Currency             string             `json:"currency,omitempty"`
+	RevenueByPaymentType map[string]float64 `json:"revenue_by_payment_type"`
+	OpeningCash          float64            `json:"opening_cash"`
+	ExpectedCash         float64            `json:"expected_cash"`
+	CountedCash          float64            `json:"counted_cash"`
+	Variance             float64            `json:"variance"`
+}
@@ -0,0 +1,52 @@
+package models
+
+// Staff roles. Each route allows a set of roles; admins may use every route.
+const (
+	RoleCashier = "cashier"
+	RoleBarista = "barista"
+	RoleManager = "manager"
+	RoleAdmin   = "admin"
+)
+
+// User is a member of staff who can sign in to the API. PasswordHash is never sent to clients.
+type User struct {
+	ID           string `json:"user_id"`
+	Username     string `json:"username"`
+	Role         string `json:"role"`
+	Password     string `json:"password,omitempty"`
+	PasswordHash string `json:"password_hash,omitempty"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// APIKey lets a device or script act as a user without a password. Only a hash of the
+// key is stored; Prefix identifies it in listings.
+type APIKey struct {
+	ID        string `json:"key_id"`
+	UserID    string `json:"user_id"`
+	Name      string `json:"name"`
+	Prefix    string `json:"prefix"`
+	Hash      string `json:"key_hash,omitempty"`
+	Key       string `json:"key,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Session is a signed-in bearer token. Only a hash of the token is stored.
+type Session struct {
+	TokenHash string `json:"token_hash"`
+	UserID    string `json:"user_id"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// Credentials is the body of a sign-in request.
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// LoginResult is the bearer token handed out by a successful sign-in.
+type LoginResult struct {
+	Token     string `json:"token"`
+	ExpiresAt string `json:"expires_at"`
+	User      User   `json:"user"`
+}
@@ -0,0 +1,26 @@
+package models
+
+// Webhook is a subscription that receives events as signed HTTP callbacks.
+type Webhook struct {
+	ID     string   `json:"webhook_id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret is the HMAC-SHA256 key used to sign deliveries.
+	Secret    string `json:"secret,omitempty"`
+	Active    bool   `json:"active"`
+	CreatedAt string `json:"created_at"`
+}
+
+// WebhookDelivery records one attempt to deliver an event to a webhook.
+type WebhookDelivery struct {
+	ID         string `json:"delivery_id"`
+	WebhookID  string `json:"webhook_id"`
+	EventID    int64  `json:"event_id"`
+	EventType  string `json:"event_type"`
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	CreatedAt  string `json:"created_at"`
+}